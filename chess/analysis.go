@@ -0,0 +1,200 @@
+package chess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrNoMoveToAnalyze = errors.New("game has no move to analyze")
+
+// How good a played move was compared to the engine's choice
+type Classification string
+
+const (
+	BestMove   Classification = "best"
+	GoodMove   Classification = "good"
+	Inaccuracy Classification = "inaccuracy"
+	Mistake    Classification = "mistake"
+	Blunder    Classification = "blunder"
+)
+
+// Evaluations are capped so a found mate doesn't outweigh everything else
+// when averaged
+const maxAnalysisScore = 1000
+
+func capScore(score int) int {
+	return max(-maxAnalysisScore, min(maxAnalysisScore, score))
+}
+
+// Winning chances lost by a move, in percent, from which it's classified as
+// an inaccuracy, a mistake or a blunder
+const (
+	inaccuracyThreshold = 5
+	mistakeThreshold    = 10
+	blunderThreshold    = 15
+)
+
+type PlyAnalysis struct {
+	Move           Move           `json:"move"`
+	SAN            string         `json:"san"`
+	Color          Color          `json:"color"`
+	BestMove       Move           `json:"bestMove"`
+	BestSAN        string         `json:"bestSan"`
+	Eval           int            `json:"eval"` // Centipawns from white's point of view after the move
+	Mate           int            `json:"mate"` // Moves until mate for white, negative for black, 0 if none
+	Loss           int            `json:"loss"` // Centipawns lost compared to the best move
+	Classification Classification `json:"classification"`
+	Accuracy       float64        `json:"accuracy"`
+}
+
+type SideAnalysis struct {
+	Accuracy     float64 `json:"accuracy"`
+	AverageLoss  int     `json:"averageLoss"`
+	Inaccuracies int     `json:"inaccuracies"`
+	Mistakes     int     `json:"mistakes"`
+	Blunders     int     `json:"blunders"`
+}
+
+type Analysis struct {
+	Depth int           `json:"depth"`
+	Plies []PlyAnalysis `json:"plies"`
+	White SideAnalysis  `json:"white"`
+	Black SideAnalysis  `json:"black"`
+}
+
+// Score of the side to move in centipawns. A finished game is scored by its
+// result and the best move is left empty.
+func evaluatePly(ctx context.Context, g *ChessEngine, depth int) (SearchResult, error) {
+	if g.finished {
+		if g.result.Reason == Checkmate {
+			return SearchResult{Score: -MateScore}, nil
+		}
+		return SearchResult{}, nil
+	}
+	return g.Search(ctx, depth)
+}
+
+// Return the chances of winning in percent of a side with the given score,
+// following the curve fitted on online games by lichess
+func winningChances(score int) float64 {
+	return 50 + 50*(2/(1+math.Exp(-0.00368208*float64(capScore(score))))-1)
+}
+
+func classify(move, best Move, lost float64) Classification {
+	switch {
+	case move == best:
+		return BestMove
+	case lost >= blunderThreshold:
+		return Blunder
+	case lost >= mistakeThreshold:
+		return Mistake
+	case lost >= inaccuracyThreshold:
+		return Inaccuracy
+	}
+	return GoodMove
+}
+
+// Return the accuracy in percent of a move losing the given winning chances
+func moveAccuracy(lost float64) float64 {
+	accuracy := 103.1668*math.Exp(-0.04354*lost) - 3.1669
+	return max(0, min(100, accuracy))
+}
+
+// Replay the moves from the given position, search every position to the
+// given depth and grade each move against the engine's best one
+func Analyze(ctx context.Context, fen string, moves []Move, depth int) (*Analysis, error) {
+	if len(moves) == 0 {
+		return nil, ErrNoMoveToAnalyze
+	}
+	game, err := ParseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &Analysis{
+		Depth: depth,
+		Plies: make([]PlyAnalysis, 0, len(moves)),
+	}
+	before, err := evaluatePly(ctx, game, depth)
+	if err != nil {
+		return nil, err
+	}
+	for i, move := range moves {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		color := game.GetTurn()
+		san, err := game.SAN(move)
+		if err != nil {
+			return nil, fmt.Errorf("ply %d: %w", i+1, err)
+		}
+		bestSAN, _ := game.SAN(before.Move)
+		if err := game.Play(color, move); err != nil {
+			return nil, fmt.Errorf("ply %d: %w", i+1, err)
+		}
+		after, err := evaluatePly(ctx, game, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		// Both scores from the point of view of the player who moved
+		score := -after.Score
+		lost := max(0, winningChances(before.Score)-winningChances(score))
+		loss := max(0, capScore(before.Score)-capScore(score))
+		classification := classify(move, before.Move, lost)
+		if classification == BestMove {
+			// A deeper look after the move can change the score of the best move
+			lost, loss = 0, 0
+		}
+		ply := PlyAnalysis{
+			Move:           move,
+			SAN:            san,
+			Color:          color,
+			BestMove:       before.Move,
+			BestSAN:        bestSAN,
+			Eval:           score,
+			Mate:           -after.MateIn(),
+			Loss:           loss,
+			Classification: classification,
+			Accuracy:       moveAccuracy(lost),
+		}
+		if color == Black {
+			ply.Eval, ply.Mate = -ply.Eval, -ply.Mate
+		}
+		analysis.Plies = append(analysis.Plies, ply)
+		before = after
+	}
+
+	analysis.White = summarize(analysis.Plies, White)
+	analysis.Black = summarize(analysis.Plies, Black)
+	return analysis, nil
+}
+
+func summarize(plies []PlyAnalysis, color Color) SideAnalysis {
+	side := SideAnalysis{}
+	count, loss := 0, 0
+	for _, ply := range plies {
+		if ply.Color != color {
+			continue
+		}
+		count++
+		loss += ply.Loss
+		side.Accuracy += ply.Accuracy
+		switch ply.Classification {
+		case Inaccuracy:
+			side.Inaccuracies++
+		case Mistake:
+			side.Mistakes++
+		case Blunder:
+			side.Blunders++
+		}
+	}
+	if count > 0 {
+		side.Accuracy = math.Round(side.Accuracy/float64(count)*10) / 10
+		side.AverageLoss = loss / count
+	}
+	return side
+}
@@ -0,0 +1,64 @@
+package chess
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseUCIMoves(t *testing.T, ucis ...string) []Move {
+	t.Helper()
+	moves := make([]Move, len(ucis))
+	for i, uci := range ucis {
+		move, err := ParseUCI(uci)
+		assert.Nil(t, err)
+		moves[i] = move
+	}
+	return moves
+}
+
+func TestAnalyze(t *testing.T) {
+	// Fool's mate
+	moves := parseUCIMoves(t, "f2f3", "e7e5", "g2g4", "d8h4")
+	analysis, err := Analyze(context.Background(), StartingFEN, moves, 3)
+	assert.Nil(t, err)
+	assert.Len(t, analysis.Plies, 4)
+
+	assert.Equal(t, White, analysis.Plies[2].Color)
+	assert.Equal(t, "g4", analysis.Plies[2].SAN)
+	assert.Equal(t, Blunder, analysis.Plies[2].Classification)
+	assert.Equal(t, -1, analysis.Plies[2].Mate)
+	assert.Less(t, analysis.Plies[2].Accuracy, 20.0)
+
+	assert.Equal(t, "Qh4#", analysis.Plies[3].SAN)
+	assert.Equal(t, BestMove, analysis.Plies[3].Classification)
+	assert.Equal(t, "Qh4#", analysis.Plies[3].BestSAN)
+	assert.Equal(t, 0, analysis.Plies[3].Loss)
+	assert.Less(t, analysis.Plies[3].Eval, -maxAnalysisScore)
+
+	assert.Equal(t, 1, analysis.White.Blunders)
+	assert.Equal(t, 0, analysis.Black.Blunders)
+	assert.Greater(t, analysis.Black.Accuracy, analysis.White.Accuracy)
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	_, err := Analyze(context.Background(), StartingFEN, nil, 2)
+	assert.ErrorIs(t, err, ErrNoMoveToAnalyze)
+
+	_, err = Analyze(context.Background(), StartingFEN, parseUCIMoves(t, "e2e4", "e2e4"), 2)
+	assert.NotNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Analyze(ctx, StartingFEN, parseUCIMoves(t, "e2e4"), 2)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMoveAccuracy(t *testing.T) {
+	assert.InDelta(t, 100, moveAccuracy(0), 0.01)
+	assert.Equal(t, 0.0, moveAccuracy(100))
+	assert.InDelta(t, 50, winningChances(0), 0.01)
+	assert.Greater(t, winningChances(300), 70.0)
+	assert.Equal(t, winningChances(maxAnalysisScore), winningChances(MateScore))
+}
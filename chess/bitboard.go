@@ -0,0 +1,381 @@
+package chess
+
+import "math/bits"
+
+// One bit per square, bit 0 is a1, bit 7 is h1 and bit 63 is h8
+type bitboard uint64
+
+func squareBit(sq int) bitboard {
+	return 1 << sq
+}
+
+func squareOf(loc Location) int {
+	return loc.Row*8 + loc.Col
+}
+
+func locationOf(sq int) Location {
+	return Location{Row: sq / 8, Col: sq % 8}
+}
+
+// Castling rights packed in four bits
+const (
+	whiteKingside uint8 = 1 << iota
+	whiteQueenside
+	blackKingside
+	blackQueenside
+)
+
+// Ray directions. The first four increase the square index.
+const (
+	north = iota
+	east
+	northEast
+	northWest
+	south
+	west
+	southEast
+	southWest
+)
+
+var directionSteps = [8][2]int{
+	{1, 0}, {0, 1}, {1, 1}, {1, -1},
+	{-1, 0}, {0, -1}, {-1, 1}, {-1, -1},
+}
+
+var (
+	knightAttacks [64]bitboard
+	kingAttacks   [64]bitboard
+	pawnAttacks   [2][64]bitboard // Squares attacked by a pawn of the given color
+	rays          [8][64]bitboard // Squares from a square to the edge of the board in a direction
+
+	// Rights kept when a piece leaves or lands on the square
+	castlingMasks [64]uint8
+)
+
+func init() {
+	// Return the square at the given offset or -1 if it's outside the board
+	offset := func(sq, dRow, dCol int) int {
+		row, col := sq/8+dRow, sq%8+dCol
+		if row < 0 || row > 7 || col < 0 || col > 7 {
+			return -1
+		}
+		return row*8 + col
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		for _, d := range [][2]int{{2, 1}, {2, -1}, {-2, 1}, {-2, -1}, {1, 2}, {1, -2}, {-1, 2}, {-1, -2}} {
+			if to := offset(sq, d[0], d[1]); to >= 0 {
+				knightAttacks[sq] |= squareBit(to)
+			}
+		}
+		for dir, d := range directionSteps {
+			if to := offset(sq, d[0], d[1]); to >= 0 {
+				kingAttacks[sq] |= squareBit(to)
+			}
+			for to := offset(sq, d[0], d[1]); to >= 0; to = offset(to, d[0], d[1]) {
+				rays[dir][sq] |= squareBit(to)
+			}
+		}
+		for _, dCol := range []int{1, -1} {
+			if to := offset(sq, 1, dCol); to >= 0 {
+				pawnAttacks[White][sq] |= squareBit(to)
+			}
+			if to := offset(sq, -1, dCol); to >= 0 {
+				pawnAttacks[Black][sq] |= squareBit(to)
+			}
+		}
+		castlingMasks[sq] = whiteKingside | whiteQueenside | blackKingside | blackQueenside
+	}
+
+	castlingMasks[0] &^= whiteQueenside
+	castlingMasks[7] &^= whiteKingside
+	castlingMasks[4] &^= whiteKingside | whiteQueenside
+	castlingMasks[56] &^= blackQueenside
+	castlingMasks[63] &^= blackKingside
+	castlingMasks[60] &^= blackKingside | blackQueenside
+}
+
+// Return the squares attacked along a ray, up to and including the first blocker
+func rayAttacks(dir, sq int, occupied bitboard) bitboard {
+	attacks := rays[dir][sq]
+	blockers := attacks & occupied
+	if blockers == 0 {
+		return attacks
+	}
+	var first int
+	if dir < south {
+		first = bits.TrailingZeros64(uint64(blockers))
+	} else {
+		first = 63 - bits.LeadingZeros64(uint64(blockers))
+	}
+	return attacks ^ rays[dir][first]
+}
+
+func rookAttacks(sq int, occupied bitboard) bitboard {
+	return rayAttacks(north, sq, occupied) | rayAttacks(east, sq, occupied) |
+		rayAttacks(south, sq, occupied) | rayAttacks(west, sq, occupied)
+}
+
+func bishopAttacks(sq int, occupied bitboard) bitboard {
+	return rayAttacks(northEast, sq, occupied) | rayAttacks(northWest, sq, occupied) |
+		rayAttacks(southEast, sq, occupied) | rayAttacks(southWest, sq, occupied)
+}
+
+// Remove and return the lowest square of the bitboard
+func popSquare(b *bitboard) int {
+	sq := bits.TrailingZeros64(uint64(*b))
+	*b &= *b - 1
+	return sq
+}
+
+// A move in the bitboard representation. Promotion is King when the move
+// isn't a promotion, the same convention as Move.
+type bitMove struct {
+	from, to  int8
+	piece     PieceType
+	promotion PieceType
+}
+
+func (m bitMove) toMove() Move {
+	return Move{From: locationOf(int(m.from)), To: locationOf(int(m.to)), Promotion: m.promotion}
+}
+
+// A compact copy of the position used for move generation. It's a plain
+// value so playing a move on a copy is cheap and needs no rollback.
+type position struct {
+	pieces    [2][6]bitboard // Indexed by Color and PieceType
+	occupied  [2]bitboard
+	turn      Color
+	castling  uint8
+	enPassant int // Square passed over by the last two-square pawn push or -1
+}
+
+// Build the bitboard position of the engine
+func (g *ChessEngine) position() position {
+	p := position{turn: g.turn, enPassant: -1}
+	for _, color := range []Color{White, Black} {
+		for _, piece := range g.pieces[color] {
+			if piece.Captured {
+				continue
+			}
+			bit := squareBit(squareOf(piece.Location))
+			p.pieces[color][piece.Type] |= bit
+			p.occupied[color] |= bit
+		}
+	}
+	if g.castleRights[White].right {
+		p.castling |= whiteKingside
+	}
+	if g.castleRights[White].left {
+		p.castling |= whiteQueenside
+	}
+	if g.castleRights[Black].right {
+		p.castling |= blackKingside
+	}
+	if g.castleRights[Black].left {
+		p.castling |= blackQueenside
+	}
+	if g.enPassant != nil {
+		p.enPassant = squareOf(*g.enPassant)
+	}
+	return p
+}
+
+// Check if any piece of the given color attacks the square
+func (p *position) attacked(sq int, by Color) bool {
+	occupied := p.occupied[White] | p.occupied[Black]
+	pieces := &p.pieces[by]
+	return pawnAttacks[by.OppositeColor()][sq]&pieces[Pawn] != 0 ||
+		knightAttacks[sq]&pieces[Knight] != 0 ||
+		kingAttacks[sq]&pieces[King] != 0 ||
+		bishopAttacks(sq, occupied)&(pieces[Bishop]|pieces[Queen]) != 0 ||
+		rookAttacks(sq, occupied)&(pieces[Rook]|pieces[Queen]) != 0
+}
+
+// Check if the king of the given color is attacked
+func (p *position) inCheck(color Color) bool {
+	king := p.pieces[color][King]
+	if king == 0 {
+		return false
+	}
+	return p.attacked(bits.TrailingZeros64(uint64(king)), color.OppositeColor())
+}
+
+// Return the position after the move, which must be pseudo-legal
+func (p position) play(m bitMove) position {
+	us, them := p.turn, p.turn.OppositeColor()
+	from, to := int(m.from), int(m.to)
+	fromTo := squareBit(from) | squareBit(to)
+
+	if p.occupied[them]&squareBit(to) != 0 {
+		for t := range p.pieces[them] {
+			p.pieces[them][t] &^= squareBit(to)
+		}
+		p.occupied[them] &^= squareBit(to)
+	}
+	p.pieces[us][m.piece] ^= fromTo
+	p.occupied[us] ^= fromTo
+
+	switch m.piece {
+	case Pawn:
+		if to == p.enPassant {
+			// The captured pawn stands beside the moving pawn
+			captured := squareBit(from/8*8 + to%8)
+			p.pieces[them][Pawn] &^= captured
+			p.occupied[them] &^= captured
+		}
+		if m.promotion != King {
+			p.pieces[us][Pawn] &^= squareBit(to)
+			p.pieces[us][m.promotion] |= squareBit(to)
+		}
+	case King:
+		rookFrom, rookTo := -1, -1
+		if to-from == 2 {
+			rookFrom, rookTo = from+3, from+1
+		} else if from-to == 2 {
+			rookFrom, rookTo = from-4, from-1
+		}
+		if rookFrom >= 0 {
+			rook := squareBit(rookFrom) | squareBit(rookTo)
+			p.pieces[us][Rook] ^= rook
+			p.occupied[us] ^= rook
+		}
+	}
+
+	p.enPassant = -1
+	if m.piece == Pawn && (to-from == 16 || from-to == 16) {
+		p.enPassant = (from + to) / 2
+	}
+	p.castling &= castlingMasks[from] & castlingMasks[to]
+	p.turn = them
+	return p
+}
+
+// Append every pseudo-legal move of the side to move, which may leave
+// its own king in check
+func (p *position) pseudoLegalMoves(moves []bitMove) []bitMove {
+	us, them := p.turn, p.turn.OppositeColor()
+	own, enemy := p.occupied[us], p.occupied[them]
+	occupied := own | enemy
+
+	addTargets := func(from int, piece PieceType, targets bitboard) {
+		for targets != 0 {
+			moves = append(moves, bitMove{from: int8(from), to: int8(popSquare(&targets)), piece: piece})
+		}
+	}
+
+	for _, piece := range []PieceType{Knight, Bishop, Rook, Queen, King} {
+		for pieces := p.pieces[us][piece]; pieces != 0; {
+			from := popSquare(&pieces)
+			var targets bitboard
+			switch piece {
+			case Knight:
+				targets = knightAttacks[from]
+			case Bishop:
+				targets = bishopAttacks(from, occupied)
+			case Rook:
+				targets = rookAttacks(from, occupied)
+			case Queen:
+				targets = bishopAttacks(from, occupied) | rookAttacks(from, occupied)
+			case King:
+				targets = kingAttacks[from]
+			}
+			addTargets(from, piece, targets&^own)
+		}
+	}
+
+	forward, startRow, lastRow := 8, 1, 7
+	if us == Black {
+		forward, startRow, lastRow = -8, 6, 0
+	}
+	addPawnMove := func(from, to int) {
+		if to/8 != lastRow {
+			moves = append(moves, bitMove{from: int8(from), to: int8(to), piece: Pawn})
+			return
+		}
+		for _, promotion := range []PieceType{Queen, Rook, Bishop, Knight} {
+			moves = append(moves, bitMove{from: int8(from), to: int8(to), piece: Pawn, promotion: promotion})
+		}
+	}
+	for pawns := p.pieces[us][Pawn]; pawns != 0; {
+		from := popSquare(&pawns)
+		if to := from + forward; occupied&squareBit(to) == 0 {
+			addPawnMove(from, to)
+			if from/8 == startRow && occupied&squareBit(to+forward) == 0 {
+				addPawnMove(from, to+forward)
+			}
+		}
+		captures := pawnAttacks[us][from] & enemy
+		if p.enPassant >= 0 {
+			captures |= pawnAttacks[us][from] & squareBit(p.enPassant)
+		}
+		for captures != 0 {
+			addPawnMove(from, popSquare(&captures))
+		}
+	}
+
+	p.appendCastling(&moves)
+	return moves
+}
+
+// Append the castling moves of the side to move. The king may neither
+// start in, pass through nor land on an attacked square.
+func (p *position) appendCastling(moves *[]bitMove) {
+	us, them := p.turn, p.turn.OppositeColor()
+	kingside, queenside, king := whiteKingside, whiteQueenside, 4
+	if us == Black {
+		kingside, queenside, king = blackKingside, blackQueenside, 60
+	}
+	if p.pieces[us][King]&squareBit(king) == 0 || p.castling&(kingside|queenside) == 0 {
+		return
+	}
+	if p.attacked(king, them) {
+		return
+	}
+
+	occupied := p.occupied[White] | p.occupied[Black]
+	rooks := p.pieces[us][Rook]
+	if p.castling&kingside != 0 && rooks&squareBit(king+3) != 0 &&
+		occupied&(squareBit(king+1)|squareBit(king+2)) == 0 &&
+		!p.attacked(king+1, them) && !p.attacked(king+2, them) {
+		*moves = append(*moves, bitMove{from: int8(king), to: int8(king + 2), piece: King})
+	}
+	if p.castling&queenside != 0 && rooks&squareBit(king-4) != 0 &&
+		occupied&(squareBit(king-1)|squareBit(king-2)|squareBit(king-3)) == 0 &&
+		!p.attacked(king-1, them) && !p.attacked(king-2, them) {
+		*moves = append(*moves, bitMove{from: int8(king), to: int8(king - 2), piece: King})
+	}
+}
+
+// Append every legal move of the side to move
+func (p *position) legalMoves(moves []bitMove) []bitMove {
+	start := len(moves)
+	moves = p.pseudoLegalMoves(moves)
+
+	legal := moves[:start]
+	for _, m := range moves[start:] {
+		next := p.play(m)
+		if !next.inCheck(p.turn) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// Count the leaf nodes of the legal move tree of the given depth
+func (p *position) perft(depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	moves := p.legalMoves(make([]bitMove, 0, 64))
+	if depth == 1 {
+		return len(moves)
+	}
+	nodes := 0
+	for _, m := range moves {
+		next := p.play(m)
+		nodes += next.perft(depth - 1)
+	}
+	return nodes
+}
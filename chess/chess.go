@@ -1,7 +1,9 @@
 package chess
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 )
 
 var (
@@ -10,11 +12,52 @@ var (
 	ErrChecked          = errors.New("error checked cant move there")
 	ErrInvalidPieceMove = errors.New("piece can't move like that")
 	ErrNotPlayersTurn   = errors.New("it's not your turn")
+	ErrInvalidPromotion = errors.New("pawn can only be promoted to knight, bishop, rook or queen")
+	ErrNoPromotion      = errors.New("promotion piece is required when a pawn reaches the last row")
+	ErrInvalidUCI       = errors.New("invalid UCI move")
 )
 
 type Move struct {
 	From Location `json:"from"`
 	To   Location `json:"to"`
+
+	// The piece a pawn reaching the last row turns into. The zero value (King)
+	// means no promotion, which is the case for every other move.
+	Promotion PieceType `json:"promotion,omitempty"`
+}
+
+// A move as sent in JSON, where the promotion piece is given by its name
+type moveJSON struct {
+	From      Location `json:"from"`
+	To        Location `json:"to"`
+	Promotion string   `json:"promotion,omitempty"`
+}
+
+func (m Move) MarshalJSON() ([]byte, error) {
+	msg := moveJSON{From: m.From, To: m.To}
+	if m.Promotion != King {
+		if !m.Promotion.IsPromotable() {
+			return nil, ErrInvalidPromotion
+		}
+		msg.Promotion = m.Promotion.GetName()
+	}
+	return json.Marshal(msg)
+}
+
+func (m *Move) UnmarshalJSON(data []byte) error {
+	msg := moveJSON{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = Move{From: msg.From, To: msg.To}
+	if msg.Promotion != "" {
+		promotion, err := ParsePieceType(msg.Promotion)
+		if err != nil {
+			return err
+		}
+		m.Promotion = promotion
+	}
+	return nil
 }
 
 func (m Move) Validate() error {
@@ -24,11 +67,55 @@ func (m Move) Validate() error {
 	if err := m.To.Validate(); err != nil {
 		return err
 	}
+	if m.Promotion != King && !m.Promotion.IsPromotable() {
+		return ErrInvalidPromotion
+	}
 	return nil
 }
 
+// Return the move in long algebraic notation as used by UCI, e.g. "e2e4" or "e7e8q"
+func (m Move) UCI() string {
+	uci := m.From.Square() + m.To.Square()
+	if m.Promotion != King {
+		uci += string(fenPieceLetters[m.Promotion])
+	}
+	return uci
+}
+
+// Parse a move in long algebraic notation as used by UCI
+func ParseUCI(uci string) (Move, error) {
+	if len(uci) != 4 && len(uci) != 5 {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidUCI, uci)
+	}
+	from, err := ParseSquare(uci[0:2])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidUCI, uci)
+	}
+	to, err := ParseSquare(uci[2:4])
+	if err != nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidUCI, uci)
+	}
+
+	move := Move{From: from, To: to}
+	if len(uci) == 5 {
+		move.Promotion = parseSANLetter(uci[4:])
+		if !move.Promotion.IsPromotable() {
+			return Move{}, fmt.Errorf("%w: %q", ErrInvalidUCI, uci)
+		}
+	}
+	return move, nil
+}
+
 type Chess interface {
 	GetResult() Result // Return game result if game is finished otherwise return NoResult
 	Play(playerColor Color, m Move) error
-	Exit() // Clear the game state
+	SAN(m Move) (string, error)        // Encode a move of the side to move in SAN
+	ParseSAN(san string) (Move, error) // Decode a move of the side to move from SAN
+	ClaimDraw(playerColor Color) error // Claim a draw by threefold repetition or the fifty-move rule
+	Undo() error                       // Take back the last ply
+	History() []HistoryEntry           // Return every ply played so far
+	GetTurn() Color                    // Return the color of the side to move
+	LegalMoves() []Move                // Return every legal move of the side to move
+	FEN() string                       // Encode the current position in FEN
+	Exit()                             // Clear the game state
 }
@@ -0,0 +1,106 @@
+package chess
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrNoDrawClaim = errors.New("there is no threefold repetition or fifty-move rule to claim a draw")
+
+// Return a key identifying the position for repetition detection. Two
+// positions are the same when pieces, side to move, castling rights and
+// possible en passant captures are the same.
+func (g *ChessEngine) positionKey() string {
+	fields := strings.Fields(g.FEN())
+	if fields[3] != "-" && !g.canCaptureEnPassant() {
+		fields[3] = "-"
+	}
+	return strings.Join(fields[:4], " ")
+}
+
+func (g *ChessEngine) canCaptureEnPassant() bool {
+	if g.enPassant == nil {
+		return false
+	}
+	for _, piece := range g.pieces[g.turn] {
+		if !piece.Captured && piece.Type == Pawn && g.IsInPossibleMoves(piece, *g.enPassant) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *ChessEngine) recordPosition() {
+	g.repetitions[g.positionKey()]++
+}
+
+// Check if neither side has enough pieces left to checkmate
+func (g *ChessEngine) insufficientMaterial() bool {
+	minors := []*Piece{}
+	for _, color := range []Color{White, Black} {
+		for _, piece := range g.pieces[color] {
+			if piece.Captured || piece.Type == King {
+				continue
+			}
+			if piece.Type != Bishop && piece.Type != Knight {
+				return false
+			}
+			minors = append(minors, piece)
+		}
+	}
+
+	if len(minors) <= 1 {
+		return true
+	}
+	// Any number of bishops all on squares of the same color
+	squareColor := (minors[0].Location.Row + minors[0].Location.Col) % 2
+	for _, piece := range minors {
+		if piece.Type != Bishop || (piece.Location.Row+piece.Location.Col)%2 != squareColor {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the draw that ends the game automatically, if any
+func (g *ChessEngine) checkDrawRules() Result {
+	switch {
+	case g.insufficientMaterial():
+		return Result{Reason: InsufficientMaterial, WinnerColor: Empty}
+	case g.repetitions[g.positionKey()] >= 5:
+		return Result{Reason: FivefoldRepetition, WinnerColor: Empty}
+	case g.halfMoveClock >= 150:
+		return Result{Reason: SeventyFiveMoveRule, WinnerColor: Empty}
+	}
+	return NoResult
+}
+
+// Return how many times the current position has occurred
+func (g *ChessEngine) Repetitions() int {
+	return g.repetitions[g.positionKey()]
+}
+
+func (g *ChessEngine) HalfMoveClock() int {
+	return g.halfMoveClock
+}
+
+// Claim a draw by threefold repetition or the fifty-move rule.
+// Only the player whose turn it is can claim.
+func (g *ChessEngine) ClaimDraw(playerColor Color) error {
+	if g.finished {
+		return ErrGameEnd
+	}
+	if playerColor != g.turn {
+		return ErrNotPlayersTurn
+	}
+
+	switch {
+	case g.Repetitions() >= 3:
+		g.finish(ThreefoldRepetition, Empty)
+	case g.halfMoveClock >= 100:
+		g.finish(FiftyMoveRule, Empty)
+	default:
+		return ErrNoDrawClaim
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Both the engine and a session, which also runs the clocks
+type uciPlayer interface {
+	Play(playerColor Color, m Move) error
+	GetTurn() Color
+}
+
+func playUCI(t *testing.T, game uciPlayer, moves ...string) {
+	t.Helper()
+	for _, uci := range moves {
+		move, err := ParseUCI(uci)
+		assert.Nil(t, err)
+		assert.Nil(t, game.Play(game.GetTurn(), move), uci)
+	}
+}
+
+func TestThreefoldRepetition(t *testing.T) {
+	game := NewEngine()
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+
+	playUCI(t, game, shuffle...)
+	assert.Equal(t, 2, game.Repetitions())
+	assert.ErrorIs(t, game.ClaimDraw(White), ErrNoDrawClaim)
+
+	playUCI(t, game, shuffle...)
+	assert.Equal(t, 3, game.Repetitions())
+	assert.ErrorIs(t, game.ClaimDraw(Black), ErrNotPlayersTurn)
+	assert.Nil(t, game.ClaimDraw(White))
+	assert.Equal(t, Result{Reason: ThreefoldRepetition, WinnerColor: Empty}, game.GetResult())
+}
+
+func TestFivefoldRepetition(t *testing.T) {
+	game := NewEngine()
+	shuffle := []string{"b1c3", "b8c6", "c3b1", "c6b8"}
+	for i := 0; i < 3; i++ {
+		playUCI(t, game, shuffle...)
+	}
+	assert.Equal(t, NoResult, game.GetResult())
+
+	playUCI(t, game, shuffle...)
+	assert.Equal(t, Result{Reason: FivefoldRepetition, WinnerColor: Empty}, game.GetResult())
+}
+
+func TestRepetitionIgnoresImpossibleEnPassant(t *testing.T) {
+	game := NewEngine()
+	// After e4 the en passant square is set but no black pawn can use it,
+	// so the position repeats once the knights return
+	playUCI(t, game, "e2e4", "g8f6", "g1f3", "f6g8", "f3g1")
+	assert.Equal(t, 2, game.Repetitions())
+}
+
+func TestFiftyMoveRule(t *testing.T) {
+	game, err := ParseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 98 80")
+	assert.Nil(t, err)
+
+	playUCI(t, game, "a1a2")
+	assert.ErrorIs(t, game.ClaimDraw(Black), ErrNoDrawClaim)
+
+	playUCI(t, game, "e8d8")
+	assert.Equal(t, 100, game.HalfMoveClock())
+	assert.Nil(t, game.ClaimDraw(White))
+	assert.Equal(t, Result{Reason: FiftyMoveRule, WinnerColor: Empty}, game.GetResult())
+}
+
+func TestSeventyFiveMoveRule(t *testing.T) {
+	game, err := ParseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 148 100")
+	assert.Nil(t, err)
+
+	playUCI(t, game, "a1a2")
+	assert.Equal(t, NoResult, game.GetResult())
+
+	playUCI(t, game, "e8d8")
+	assert.Equal(t, Result{Reason: SeventyFiveMoveRule, WinnerColor: Empty}, game.GetResult())
+}
+
+func TestSeventyFiveMoveRuleCheckmate(t *testing.T) {
+	game, err := ParseFEN("6k1/5ppp/8/8/8/8/8/R3K3 w - - 149 100")
+	assert.Nil(t, err)
+
+	playUCI(t, game, "a1a8")
+	assert.Equal(t, Result{Reason: Checkmate, WinnerColor: White}, game.GetResult())
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	tests := map[string]bool{
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":     true,
+		"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1":   true,
+		"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1":   true,
+		"2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1": false,
+		"2b1k3/8/8/8/8/8/8/3BK3 w - - 0 1":  true,
+		"1n2k3/8/8/8/8/8/8/1N2K3 w - - 0 1": false,
+		"4k3/8/8/8/8/8/8/1NB1K3 w - - 0 1":  false,
+		"4k3/8/8/8/8/8/P7/4K3 w - - 0 1":    false,
+		"4k3/8/8/8/8/8/8/R3K3 w - - 0 1":    false,
+	}
+	for fen, draw := range tests {
+		game, err := ParseFEN(fen)
+		assert.Nil(t, err)
+		assert.Equal(t, draw, game.GetResult().Reason == InsufficientMaterial, fen)
+	}
+
+	game, err := ParseFEN("4k3/8/8/8/8/8/3q4/4K3 w - - 0 1")
+	assert.Nil(t, err)
+	playUCI(t, game, "e1d2")
+	assert.Equal(t, Result{Reason: InsufficientMaterial, WinnerColor: Empty}, game.GetResult())
+}
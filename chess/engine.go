@@ -2,7 +2,7 @@ package chess
 
 import (
 	"fmt"
-	"math"
+	"maps"
 )
 
 type Reason string
@@ -14,6 +14,12 @@ const (
 	Abandoned Reason = "abandoned"
 	Resign    Reason = "resign"
 	Draw      Reason = "draw"
+
+	InsufficientMaterial Reason = "insufficientMaterial"
+	ThreefoldRepetition  Reason = "threefoldRepetition"
+	FivefoldRepetition   Reason = "fivefoldRepetition"
+	FiftyMoveRule        Reason = "fiftyMoveRule"
+	SeventyFiveMoveRule  Reason = "seventyFiveMoveRule"
 )
 
 type Result struct {
@@ -34,6 +40,14 @@ type ChessEngine struct {
 	pieces       map[Color][]*Piece
 	castleRights map[Color]castling
 	turn         Color
+	enPassant    *Location // Square passed over by the last two-square pawn push
+
+	halfMoveClock  int // Plies since the last capture or pawn move
+	fullMoveNumber int // Starts at 1 and is incremented after each black move
+	repetitions    map[string]int
+
+	history   []*RollBackMovement // Every ply played so far, in order
+	redoMoves []Move              // Plies taken back by Undo, the last one is redone first
 
 	possibleMoves map[*Piece][]Location
 	finished      bool
@@ -57,7 +71,9 @@ func NewEngine() *ChessEngine {
 				right: true,
 			},
 		},
-		result: NoResult,
+		result:         NoResult,
+		fullMoveNumber: 1,
+		repetitions:    map[string]int{},
 	}
 	engine.kings = map[Color]*Piece{
 		White: engine.board[0][4],
@@ -69,6 +85,7 @@ func NewEngine() *ChessEngine {
 	engine.pieces[Black] = append(engine.pieces[Black], engine.board[6][:]...)
 
 	engine.generatePossibleMoves()
+	engine.recordPosition()
 	return engine
 }
 
@@ -93,6 +110,8 @@ func NewFromPieces(pieces []*Piece) *ChessEngine {
 				right: true,
 			},
 		},
+		fullMoveNumber: 1,
+		repetitions:    map[string]int{},
 	}
 
 	for _, piece := range pieces {
@@ -103,6 +122,7 @@ func NewFromPieces(pieces []*Piece) *ChessEngine {
 	}
 
 	engine.generatePossibleMoves()
+	engine.recordPosition()
 	return engine
 }
 
@@ -110,260 +130,122 @@ func (g *ChessEngine) GetTurn() Color {
 	return g.turn
 }
 
+func (g *ChessEngine) FullMoveNumber() int {
+	return g.fullMoveNumber
+}
+
 func (g *ChessEngine) GetResult() Result {
 	if g.finished {
 		return g.result
 	}
 	return NoResult
 }
-func (g *ChessEngine) generatePossibleMoves() {
-	clear(g.possibleMoves)
-	pieces := g.pieces[g.turn]
 
-	for i := range pieces {
-		if pieces[i].Captured {
-			continue
-		}
-		switch pieces[i].Type {
-		case King:
-			g.possibleMoves[pieces[i]] = g.generateKingPossibleMoves(pieces[i])
-		case Pawn:
-			g.possibleMoves[pieces[i]] = g.generatePawnPossibleMoves(pieces[i])
-		case Bishop:
-			g.possibleMoves[pieces[i]] = g.generateBishopPossibleMoves(pieces[i])
-		case Rook:
-			g.possibleMoves[pieces[i]] = g.generateRookPossibleMoves(pieces[i])
-		case Knight:
-			g.possibleMoves[pieces[i]] = g.generateKnightPossibleMoves(pieces[i])
-		case Queen:
-			g.possibleMoves[pieces[i]] = append(g.generateBishopPossibleMoves(pieces[i]), g.generateRookPossibleMoves(pieces[i])...)
+// Return a deep copy of the engine which can be played on independently.
+// The copy starts with an empty history.
+func (g *ChessEngine) Clone() *ChessEngine {
+	clone := &ChessEngine{
+		kings:  map[Color]*Piece{White: nil, Black: nil},
+		pieces: map[Color][]*Piece{White: {}, Black: {}},
+		castleRights: map[Color]castling{
+			White: g.castleRights[White],
+			Black: g.castleRights[Black],
+		},
+		turn:           g.turn,
+		halfMoveClock:  g.halfMoveClock,
+		fullMoveNumber: g.fullMoveNumber,
+		possibleMoves:  map[*Piece][]Location{},
+		repetitions:    maps.Clone(g.repetitions),
+		finished:       g.finished,
+		result:         g.result,
+	}
+	if g.enPassant != nil {
+		enPassant := *g.enPassant
+		clone.enPassant = &enPassant
+	}
+
+	for _, color := range []Color{White, Black} {
+		for _, piece := range g.pieces[color] {
+			if piece.Captured {
+				continue
+			}
+			p := *piece
+			clone.board[p.Location.Row][p.Location.Col] = &p
+			clone.pieces[color] = append(clone.pieces[color], &p)
+			if p.Type == King {
+				clone.kings[color] = &p
+			}
 		}
 	}
-}
-
-// Check if a location is in the board and occupiable
-func (g *ChessEngine) occupiable(piece *Piece, loc Location) bool {
-	if err := loc.Validate(); err != nil {
-		return false
-	}
-	if (g.board[loc.Row][loc.Col] != nil) && (g.board[loc.Row][loc.Col].Color == piece.Color) {
-		return false
-	}
-	return true
-}
 
-// Check if we move the piece to given location the king will be in check or not
-func (g *ChessEngine) checkable(piece *Piece, loc Location) bool {
-	rb := NewRollBack(g)
-	rb.Do(Move{From: piece.Location, To: loc})
-	isChecked := g.isChecked(piece.Color)
-	rb.RollBack()
-	return isChecked
+	clone.generatePossibleMoves()
+	return clone
 }
 
-func (g *ChessEngine) occupiableAndSafe(piece *Piece, loc Location) bool {
-	return g.occupiable(piece, loc) && !g.checkable(piece, loc)
+// Return every legal move of the side to move, none once the game has ended.
+// A promotion is listed once per promotion piece.
+func (g *ChessEngine) LegalMoves() []Move {
+	if g.finished {
+		return []Move{}
+	}
+	return g.legalMoves()
 }
 
-func (g *ChessEngine) generateRookPossibleMoves(piece *Piece) []Location {
-	possibleMoves := []Location{}
-	i := 0
-	j := 0
-
-	for i = piece.Location.Row + 1; i < 8; i++ {
-		if !g.occupiable(piece, Location{Row: i, Col: piece.Location.Col}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: i, Col: piece.Location.Col}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: piece.Location.Col})
-		}
-	}
-	for i = piece.Location.Row - 1; i >= 0; i-- {
-		if !g.occupiable(piece, Location{Row: i, Col: piece.Location.Col}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: i, Col: piece.Location.Col}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: piece.Location.Col})
-		}
-	}
-	for j = piece.Location.Col + 1; j < 8; j++ {
-		if !g.occupiable(piece, Location{Row: piece.Location.Row, Col: j}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: piece.Location.Row, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row, Col: j})
+// Return the legal moves of the piece on the given square
+func (g *ChessEngine) LegalMovesFrom(loc Location) []Move {
+	moves := []Move{}
+	for _, move := range g.LegalMoves() {
+		if move.From.Equals(loc) {
+			moves = append(moves, move)
 		}
 	}
-	for j = piece.Location.Col - 1; j >= 0; j-- {
-		if !g.occupiable(piece, Location{Row: piece.Location.Row, Col: j}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: piece.Location.Row, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row, Col: j})
-		}
-	}
-	return possibleMoves
+	return moves
 }
 
-func (g *ChessEngine) generatePawnPossibleMoves(piece *Piece) []Location {
-	possibleMoves := []Location{}
-
-	if piece.Color == White {
-		if g.board[piece.Location.Row+1][piece.Location.Col] == nil {
-			possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row + 1, Col: piece.Location.Col})
-			// First move
-			if piece.Location.Row == 1 && g.board[piece.Location.Row+2][piece.Location.Col] == nil {
-				possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row + 2, Col: piece.Location.Col})
-			}
-		}
-
-		destinations := []Location{
-			{Row: piece.Location.Row + 1, Col: piece.Location.Col + 1},
-			{Row: piece.Location.Row + 1, Col: piece.Location.Col - 1},
-		}
-		for _, destination := range destinations {
-			if err := destination.Validate(); err != nil {
-				continue
-			}
-			if (g.board[destination.Row][destination.Col] != nil) && (g.board[destination.Row][destination.Col].Color != piece.Color) {
-				possibleMoves = append(possibleMoves, destination)
-			}
-		}
-	} else {
-		if g.board[piece.Location.Row-1][piece.Location.Col] == nil {
-			possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row - 1, Col: piece.Location.Col})
-			// First move
-			if piece.Location.Row == 6 && g.board[piece.Location.Row-2][piece.Location.Col] == nil {
-				possibleMoves = append(possibleMoves, Location{Row: piece.Location.Row - 2, Col: piece.Location.Col})
-			}
-		}
-		destinations := []Location{
-			{Row: piece.Location.Row - 1, Col: piece.Location.Col + 1},
-			{Row: piece.Location.Row - 1, Col: piece.Location.Col - 1},
+// Return every legal move of the side to move, one per promotion piece for promotions
+func (g *ChessEngine) legalMoves() []Move {
+	moves := []Move{}
+	for _, piece := range g.pieces[g.turn] {
+		if piece.Captured {
+			continue
 		}
-		for _, destination := range destinations {
-			if err := destination.Validate(); err != nil {
+		for _, loc := range g.possibleMoves[piece] {
+			move := Move{From: piece.Location, To: loc}
+			if piece.Type == Pawn && loc.Row == piece.Color.LastRow() {
+				for _, promotion := range []PieceType{Queen, Rook, Bishop, Knight} {
+					move.Promotion = promotion
+					moves = append(moves, move)
+				}
 				continue
 			}
-			if (g.board[destination.Row][destination.Col] != nil) && (g.board[destination.Row][destination.Col].Color != piece.Color) {
-				possibleMoves = append(possibleMoves, destination)
-			}
+			moves = append(moves, move)
 		}
 	}
-
-	finalPossibleMoves := []Location{}
-	for _, location := range possibleMoves {
-		if g.occupiableAndSafe(piece, location) {
-			finalPossibleMoves = append(finalPossibleMoves, location)
-		}
-	}
-	return finalPossibleMoves
+	return moves
 }
-
-func (g *ChessEngine) generateBishopPossibleMoves(piece *Piece) []Location {
-	possibleMoves := []Location{}
-
-	j := piece.Location.Col + 1
-	// Down-right
-	for i := piece.Location.Row + 1; i < 8; i++ {
-		if !g.occupiable(piece, Location{Row: i, Col: j}) {
-			break
-		}
-
-		if !g.checkable(piece, Location{Row: i, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: j})
-		}
-		j += 1
-	}
-	j = piece.Location.Col - 1
-	for i := piece.Location.Row + 1; i < 8; i++ {
-		// Down-left
-		if !g.occupiable(piece, Location{Row: i, Col: j}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: i, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: j})
-		}
-		j -= 1
-	}
-	j = piece.Location.Col + 1
-	for i := piece.Location.Row - 1; i >= 0; i-- {
-		// Up-right
-		if !g.occupiable(piece, Location{Row: i, Col: j}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: i, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: j})
-		}
-		j += 1
-	}
-	j = piece.Location.Col - 1
-	for i := piece.Location.Row - 1; i >= 0; i-- {
-		// Up-left
-		if !g.occupiable(piece, Location{Row: i, Col: j}) {
-			break
-		}
-		if !g.checkable(piece, Location{Row: i, Col: j}) {
-			possibleMoves = append(possibleMoves, Location{Row: i, Col: j})
+func (g *ChessEngine) generatePossibleMoves() {
+	clear(g.possibleMoves)
+	for _, piece := range g.pieces[g.turn] {
+		if !piece.Captured {
+			g.possibleMoves[piece] = []Location{}
 		}
-		j -= 1
 	}
-	return possibleMoves
-}
 
-func (g *ChessEngine) generateKingPossibleMoves(king *Piece) []Location {
-	locations := []Location{
-		{king.Location.Row, king.Location.Col - 1},
-		{king.Location.Row, king.Location.Col + 1},
-		{king.Location.Row + 1, king.Location.Col},
-		{king.Location.Row - 1, king.Location.Col},
-		{king.Location.Row + 1, king.Location.Col + 1},
-		{king.Location.Row + 1, king.Location.Col - 1},
-		{king.Location.Row - 1, king.Location.Col + 1},
-		{king.Location.Row - 1, king.Location.Col - 1},
-	}
-	possibleMoves := []Location{}
-	for _, location := range locations {
-		if !g.occupiableAndSafe(king, location) {
+	pos := g.position()
+	for _, m := range pos.legalMoves(make([]bitMove, 0, 64)) {
+		// possibleMoves holds destinations, so a promotion is listed once
+		if m.promotion != King && m.promotion != Queen {
 			continue
 		}
-		possibleMoves = append(possibleMoves, location)
+		from := locationOf(int(m.from))
+		piece := g.board[from.Row][from.Col]
+		g.possibleMoves[piece] = append(g.possibleMoves[piece], locationOf(int(m.to)))
 	}
-
-	if g.castleRights[king.Color].left {
-		if (g.board[king.Location.Row][3] == nil) && (g.board[king.Location.Row][2] == nil) && (g.board[king.Location.Row][1] == nil) {
-			possibleMoves = append(possibleMoves, Location{Row: king.Location.Row, Col: king.Location.Col - 2})
-		}
-	}
-	if g.castleRights[king.Color].right {
-		if (g.board[king.Location.Row][5] == nil) && (g.board[king.Location.Row][6] == nil) {
-			possibleMoves = append(possibleMoves, Location{Row: king.Location.Row, Col: king.Location.Col + 2})
-		}
-	}
-	return possibleMoves
 }
 
-func (g *ChessEngine) generateKnightPossibleMoves(piece *Piece) []Location {
-	possibleMoves := []Location{}
-	destinations := []Location{
-		{Row: piece.Location.Row + 2, Col: piece.Location.Col + 1},
-		{Row: piece.Location.Row + 2, Col: piece.Location.Col - 1},
-		{Row: piece.Location.Row - 2, Col: piece.Location.Col + 1},
-		{Row: piece.Location.Row - 2, Col: piece.Location.Col - 1},
-		{Row: piece.Location.Row + 1, Col: piece.Location.Col + 2},
-		{Row: piece.Location.Row + 1, Col: piece.Location.Col - 2},
-		{Row: piece.Location.Row - 1, Col: piece.Location.Col + 2},
-		{Row: piece.Location.Row - 1, Col: piece.Location.Col - 2},
-	}
-
-	for _, location := range destinations {
-		if !g.occupiableAndSafe(piece, location) {
-			continue
-		}
-		possibleMoves = append(possibleMoves, location)
-	}
-
-	return possibleMoves
+// Check if a pawn capturing on the given location would be an en passant capture
+func (g *ChessEngine) isEnPassantTarget(loc Location) bool {
+	return g.enPassant != nil && g.enPassant.Equals(loc)
 }
 
 func (g *ChessEngine) finish(reason Reason, winner Color) {
@@ -409,10 +291,31 @@ func (g *ChessEngine) Play(playerColor Color, move Move) error {
 		return ErrInvalidPieceMove
 	}
 
+	if piece.Type == Pawn && move.To.Row == piece.Color.LastRow() {
+		if move.Promotion == King {
+			return ErrNoPromotion
+		}
+	} else if move.Promotion != King {
+		return ErrInvalidPromotion
+	}
+
 	rb := NewRollBack(g)
+
+	if piece.Type == Pawn || g.board[move.To.Row][move.To.Col] != nil {
+		g.halfMoveClock = 0
+	} else {
+		g.halfMoveClock++
+	}
+	if piece.Color == Black {
+		g.fullMoveNumber++
+	}
+
 	rb.Do(move)
+	g.history = append(g.history, rb)
+	g.redoMoves = g.redoMoves[:0]
 
 	g.switchTurn()
+	g.recordPosition()
 
 	if result := g.checkResult(); result != NoResult {
 		g.finish(result.Reason, result.WinnerColor)
@@ -423,7 +326,7 @@ func (g *ChessEngine) Play(playerColor Color, move Move) error {
 func (g *ChessEngine) checkResult() Result {
 	for _, locations := range g.possibleMoves {
 		if len(locations) != 0 {
-			return NoResult
+			return g.checkDrawRules()
 		}
 	}
 	king := g.kings[g.turn]
@@ -463,209 +366,11 @@ func (g *ChessEngine) switchTurn() {
 	g.generatePossibleMoves()
 }
 func (g *ChessEngine) isChecked(color Color) bool {
-	king := g.kings[color]
-	if king == nil {
+	if g.kings[color] == nil {
 		panic("king is not there")
 	}
-
-	opponentPieces := g.pieces[king.Color.OppositeColor()]
-	for _, piece := range opponentPieces {
-		if (!piece.Captured) && g.isValidMove(piece.Location, king.Location) {
-			return true
-		}
-	}
-	return false
-}
-
-func (g *ChessEngine) isValidMove(src, dst Location) bool {
-	piece := g.board[src.Row][src.Col]
-
-	if piece == nil {
-		return false
-	}
-
-	if g.board[dst.Row][dst.Col] != nil {
-		if g.board[src.Row][src.Col].Color == g.board[dst.Row][dst.Col].Color {
-			return false
-		}
-	}
-
-	switch piece.Type {
-	case King:
-		return g.isValidKingMove(src, dst)
-	case Rook:
-		return g.isValidRookMove(src, dst)
-	case Pawn:
-		return g.isValidPawnMove(src, dst)
-	case Bishop:
-		return g.isValidBishopMove(src, dst)
-	case Queen:
-		return g.isValidBishopMove(src, dst) || g.isValidRookMove(src, dst)
-	case Knight:
-		return g.isValidKnightMove(src, dst)
-	default:
-		return false
-	}
-}
-
-func (g *ChessEngine) isValidCastling(src, dst Location) bool {
-	color := g.board[src.Row][src.Col].Color
-	backRow := 0
-	if color == Black {
-		backRow = 7
-	}
-	if src.Row != backRow || dst.Row != backRow || src.Col != 4 {
-		return false
-	}
-	if src.Col == 4 && dst.Col == 6 {
-		// Left castle
-		if g.board[backRow][5] == nil && g.board[backRow][6] == nil {
-			if g.castleRights[color].left {
-				return true
-			} else {
-				return false
-			}
-		} else {
-			return false
-		}
-	} else if src.Col == 4 && dst.Col == 2 {
-		// Right castle
-		if g.board[backRow][3] == nil && g.board[backRow][2] == nil && g.board[backRow][1] == nil {
-			if g.castleRights[color].right {
-				return true
-			} else {
-				return false
-			}
-		}
-		return false
-	}
-	return false
-}
-
-func (g *ChessEngine) isValidKingMove(src, dst Location) bool {
-	// Castling
-	if math.Abs(float64(src.Col)-float64(dst.Col)) == 2 && math.Abs(float64(src.Row)-float64(dst.Row)) == 0 {
-		return g.isValidCastling(src, dst)
-	}
-
-	return (src.Col == dst.Col &&
-		math.Abs(float64(src.Row)-float64(dst.Row)) == 1) ||
-		(src.Row == dst.Row &&
-			math.Abs(float64(src.Col)-float64(dst.Col)) == 1) ||
-		(src.Col == dst.Col+1) && (src.Row == dst.Row+1) ||
-		(src.Col == dst.Col+1) && (src.Row == dst.Row-1) ||
-		(src.Col == dst.Col-1) && (src.Row == dst.Row+1) ||
-		(src.Col == dst.Col-1) && (src.Row == dst.Row-1)
-}
-
-func (g *ChessEngine) isValidRookMove(src, dst Location) bool {
-	if src.Col == dst.Col && src.Row < dst.Row {
-		// Move down
-		for rowStep := src.Row + 1; rowStep < dst.Row; rowStep++ {
-			if g.board[rowStep][dst.Col] != nil {
-				return false
-			}
-		}
-		return true
-	} else if src.Col == dst.Col && src.Row > dst.Row {
-		// Move up
-		for rowStep := src.Row - 1; rowStep > dst.Row; rowStep-- {
-			if g.board[rowStep][dst.Col] != nil {
-				return false
-			}
-		}
-		return true
-	} else if src.Row == dst.Row && src.Col < dst.Col {
-		// Move right
-		for colStep := src.Col + 1; colStep < dst.Col; colStep++ {
-			if g.board[src.Row][colStep] != nil {
-				return false
-			}
-		}
-		return true
-	} else if src.Row == dst.Row && src.Col > dst.Col {
-		// Move left
-		for colStep := src.Col - 1; colStep > dst.Col; colStep-- {
-			if g.board[src.Row][colStep] != nil {
-				return false
-			}
-		}
-		return true
-	}
-	return false
-}
-
-func (g *ChessEngine) isValidBishopMove(src, dst Location) bool {
-	if ((dst.Col - src.Col) == (dst.Row - src.Row)) && ((dst.Col - src.Col) > 0) {
-		// Move up-right
-		colStep := src.Col + 1
-		for rowStep := src.Row + 1; rowStep < dst.Row; rowStep++ {
-			if g.board[rowStep][colStep] != nil {
-				return false
-			}
-			colStep++
-		}
-		return true
-	} else if ((dst.Col - src.Col) == (dst.Row - src.Row)) && ((dst.Col - src.Col) < 0) {
-		// Move down-left
-		colStep := src.Col - 1
-		for rowStep := src.Row - 1; rowStep > dst.Row; rowStep-- {
-			if g.board[rowStep][colStep] != nil {
-				return false
-			}
-			colStep--
-		}
-		return true
-	} else if ((dst.Col - src.Col) == (dst.Row-src.Row)*(-1)) && ((dst.Col - src.Col) < 0) {
-		// Move up-left
-		rowStep := src.Row + 1
-		for colStep := src.Col - 1; colStep > dst.Col; colStep-- {
-			if g.board[rowStep][colStep] != nil {
-				return false
-			}
-			rowStep++
-		}
-		return true
-	} else if ((dst.Col - src.Col) == (dst.Row-src.Row)*(-1)) && ((dst.Col - src.Col) > 0) {
-		// Move up-right
-		rowStep := src.Row - 1
-		for colStep := src.Col + 1; colStep < dst.Col; colStep++ {
-			if g.board[rowStep][colStep] != nil {
-				return false
-			}
-			rowStep--
-		}
-		return true
-	}
-	return false
-}
-
-func (g *ChessEngine) isValidKnightMove(src, dst Location) bool {
-	return dst.Row == src.Row+2 && math.Abs(float64(dst.Col-src.Col)) == 1 ||
-		dst.Row == src.Row-2 && math.Abs(float64(dst.Col-src.Col)) == 1 ||
-		dst.Col == src.Col+2 && math.Abs(float64(dst.Row-src.Row)) == 1 ||
-		dst.Col == src.Col-2 && math.Abs(float64(dst.Row-src.Row)) == 1
-}
-
-func (g *ChessEngine) isValidPawnMove(src, dst Location) bool {
-	if g.board[src.Row][src.Col].Color == White {
-		if src.Col == dst.Col && dst.Row == src.Row+1 && g.board[dst.Row][dst.Col] == nil {
-			return true
-		} else if src.Col == dst.Col && dst.Row == src.Row+2 && g.board[dst.Row][dst.Col] == nil && src.Row == 1 {
-			return true
-		} else if (dst.Col == src.Col+1 || dst.Col == src.Col-1) && dst.Row == src.Row+1 && g.board[dst.Row][dst.Col] != nil {
-			return true
-		}
-	} else {
-		if src.Col == dst.Col && dst.Row == src.Row-1 && g.board[dst.Row][dst.Col] == nil {
-			return true
-		} else if src.Col == dst.Col && dst.Row == src.Row-2 && g.board[dst.Row][dst.Col] == nil && src.Row == 6 {
-			return true
-		} else if (dst.Col == src.Col-1 || dst.Col == src.Col+1) && dst.Row == src.Row-1 && g.board[dst.Row][dst.Col] != nil {
-			return true
-		}
-	}
-	return false
+	pos := g.position()
+	return pos.inCheck(color)
 }
 
 func newBoardFromPieces(pieces []*Piece) [8][8]*Piece {
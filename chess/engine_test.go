@@ -1,6 +1,7 @@
 package chess
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -131,11 +132,18 @@ func TestPromotion(t *testing.T) {
 	}
 
 	game := NewFromPieces(pieces)
+	t.Run("promote without piece", func(t *testing.T) {
+		assert.ErrorIs(t, game.Play(White, Move{From: Location{Row: 6, Col: 1}, To: Location{Row: 7, Col: 1}}), ErrNoPromotion)
+	})
+	t.Run("promote to pawn", func(t *testing.T) {
+		assert.ErrorIs(t, game.Play(White, Move{From: Location{Row: 6, Col: 1}, To: Location{Row: 7, Col: 1}, Promotion: Pawn}), ErrInvalidPromotion)
+	})
 	t.Run("promote pawn", func(t *testing.T) {
-		assert.Nil(t, game.Play(White, Move{From: Location{Row: 6, Col: 1}, To: Location{Row: 7, Col: 1}}))
+		assert.Nil(t, game.Play(White, Move{From: Location{Row: 6, Col: 1}, To: Location{Row: 7, Col: 1}, Promotion: Queen}))
+		assert.Equal(t, Queen, pieces[2].Type)
 	})
 	t.Run("king checked", func(t *testing.T) {
-		assert.ErrorIs(t, game.Play(Black, Move{From: Location{Row: 7, Col: 5}, To: Location{Row: 7, Col: 4}}), ErrChecked)
+		assert.ErrorIs(t, game.Play(Black, Move{From: Location{Row: 7, Col: 5}, To: Location{Row: 7, Col: 4}}), ErrInvalidPieceMove)
 	})
 	game.Print()
 }
@@ -441,7 +449,7 @@ func TestKingCapture(t *testing.T) {
 		},
 	}
 	game := NewFromPieces(pieces)
-	game.SwitchTurn()
+	game.switchTurn()
 
 	err := game.Play(Black, Move{From: Location{Row: 0, Col: 0}, To: Location{Row: 1, Col: 1}})
 	assert.Nil(t, err)
@@ -531,7 +539,7 @@ func TestBlackRightCastling(t *testing.T) {
 		},
 	}
 	game := NewFromPieces(pieces)
-	game.turn = Black
+	game.switchTurn()
 	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 7, Col: 4}, To: Location{Row: 7, Col: 6}}))
 	assert.Equal(t, game.board[7][6], pieces[1])
 	assert.Equal(t, game.board[7][5], pieces[3])
@@ -658,7 +666,7 @@ func TestStaleMate(t *testing.T) {
 		},
 	}
 	game := NewFromPieces(pieces)
-	game.turn = Black
+	game.switchTurn()
 
 	game.Play(Black, Move{
 		From: Location{
@@ -673,3 +681,213 @@ func TestStaleMate(t *testing.T) {
 
 	assert.Equal(t, Stalemate, game.GetResult().Reason)
 }
+
+func TestEnPassant(t *testing.T) {
+	pieces := []*Piece{
+		{
+			Type:     King,
+			Color:    White,
+			Location: Location{Row: 0, Col: 4},
+		},
+		{
+			Type:     King,
+			Color:    Black,
+			Location: Location{Row: 7, Col: 4},
+		},
+		{
+			Type:     Pawn,
+			Color:    White,
+			Location: Location{Row: 4, Col: 4},
+		},
+		{
+			Type:     Pawn,
+			Color:    Black,
+			Location: Location{Row: 6, Col: 3},
+		},
+	}
+	game := NewFromPieces(pieces)
+	game.switchTurn()
+
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 6, Col: 3}, To: Location{Row: 4, Col: 3}}))
+	assert.True(t, game.IsInPossibleMoves(pieces[2], Location{Row: 5, Col: 3}))
+
+	t.Run("rollback en passant", func(t *testing.T) {
+		rb := NewRollBack(game)
+		rb.Do(Move{From: Location{Row: 4, Col: 4}, To: Location{Row: 5, Col: 3}})
+		rb.RollBack()
+		assert.Equal(t, pieces[2], game.board[4][4])
+		assert.Equal(t, pieces[3], game.board[4][3])
+		assert.Nil(t, game.board[5][3])
+		assert.False(t, pieces[3].Captured)
+		assert.Equal(t, Location{Row: 5, Col: 3}, *game.enPassant)
+	})
+
+	t.Run("capture en passant", func(t *testing.T) {
+		assert.Nil(t, game.Play(White, Move{From: Location{Row: 4, Col: 4}, To: Location{Row: 5, Col: 3}}))
+		assert.Equal(t, pieces[2], game.board[5][3])
+		assert.Nil(t, game.board[4][3])
+		assert.True(t, pieces[3].Captured)
+		assert.Nil(t, game.enPassant)
+	})
+}
+
+func TestEnPassantExpires(t *testing.T) {
+	pieces := []*Piece{
+		{
+			Type:     King,
+			Color:    White,
+			Location: Location{Row: 0, Col: 4},
+		},
+		{
+			Type:     King,
+			Color:    Black,
+			Location: Location{Row: 7, Col: 4},
+		},
+		{
+			Type:     Pawn,
+			Color:    White,
+			Location: Location{Row: 1, Col: 3},
+		},
+		{
+			Type:     Pawn,
+			Color:    Black,
+			Location: Location{Row: 3, Col: 4},
+		},
+	}
+	game := NewFromPieces(pieces)
+
+	assert.Nil(t, game.Play(White, Move{From: Location{Row: 1, Col: 3}, To: Location{Row: 3, Col: 3}}))
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 7, Col: 4}, To: Location{Row: 7, Col: 5}}))
+	assert.Nil(t, game.Play(White, Move{From: Location{Row: 0, Col: 4}, To: Location{Row: 0, Col: 5}}))
+
+	assert.ErrorIs(t,
+		game.Play(Black, Move{From: Location{Row: 3, Col: 4}, To: Location{Row: 2, Col: 3}}),
+		ErrInvalidPieceMove,
+	)
+}
+
+func TestPinnedEnPassant(t *testing.T) {
+	pieces := []*Piece{
+		{
+			Type:     King,
+			Color:    White,
+			Location: Location{Row: 4, Col: 0},
+		},
+		{
+			Type:     King,
+			Color:    Black,
+			Location: Location{Row: 7, Col: 4},
+		},
+		{
+			Type:     Pawn,
+			Color:    White,
+			Location: Location{Row: 4, Col: 1},
+		},
+		{
+			Type:     Pawn,
+			Color:    Black,
+			Location: Location{Row: 6, Col: 2},
+		},
+		{
+			Type:     Rook,
+			Color:    Black,
+			Location: Location{Row: 4, Col: 7},
+		},
+	}
+	game := NewFromPieces(pieces)
+	game.switchTurn()
+
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 6, Col: 2}, To: Location{Row: 4, Col: 2}}))
+	// Capturing would expose the king to the rook along the rank
+	assert.ErrorIs(t,
+		game.Play(White, Move{From: Location{Row: 4, Col: 1}, To: Location{Row: 5, Col: 2}}),
+		ErrInvalidPieceMove,
+	)
+}
+
+func TestUnderPromotion(t *testing.T) {
+	pieces := []*Piece{
+		{
+			Type:     King,
+			Color:    White,
+			Location: Location{Row: 7, Col: 7},
+		},
+		{
+			Type:     King,
+			Color:    Black,
+			Location: Location{Row: 5, Col: 5},
+		},
+		{
+			Type:     Pawn,
+			Color:    Black,
+			Location: Location{Row: 1, Col: 2},
+		},
+	}
+	game := NewFromPieces(pieces)
+	game.switchTurn()
+
+	t.Run("promotion on a normal move", func(t *testing.T) {
+		assert.ErrorIs(t, game.Play(Black, Move{From: Location{Row: 5, Col: 5}, To: Location{Row: 4, Col: 5}, Promotion: Rook}), ErrInvalidPromotion)
+	})
+	t.Run("promote to knight", func(t *testing.T) {
+		assert.Nil(t, game.Play(Black, Move{From: Location{Row: 1, Col: 2}, To: Location{Row: 0, Col: 2}, Promotion: Knight}))
+		assert.Equal(t, Knight, pieces[2].Type)
+	})
+	t.Run("rollback promotion", func(t *testing.T) {
+		game.switchTurn()
+		pieces[2].Type = Pawn
+		game.board[1][2], game.board[0][2] = pieces[2], nil
+		pieces[2].Location = Location{Row: 1, Col: 2}
+
+		rb := NewRollBack(game)
+		rb.Do(Move{From: Location{Row: 1, Col: 2}, To: Location{Row: 0, Col: 2}, Promotion: Bishop})
+		assert.Equal(t, Bishop, pieces[2].Type)
+		rb.RollBack()
+		assert.Equal(t, Pawn, pieces[2].Type)
+	})
+}
+
+func TestMoveJSON(t *testing.T) {
+	move := Move{From: Location{Row: 6, Col: 0}, To: Location{Row: 7, Col: 0}, Promotion: Rook}
+	data, err := json.Marshal(move)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"from":{"row":6,"col":0},"to":{"row":7,"col":0},"promotion":"rook"}`, string(data))
+
+	decoded := Move{}
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, move, decoded)
+
+	data, err = json.Marshal(Move{From: Location{Row: 1, Col: 0}, To: Location{Row: 2, Col: 0}})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"from":{"row":1,"col":0},"to":{"row":2,"col":0}}`, string(data))
+
+	_, err = json.Marshal(Move{Promotion: PieceType(42)})
+	assert.ErrorIs(t, err, ErrInvalidPromotion)
+	assert.Error(t, json.Unmarshal([]byte(`{"promotion":"dragon"}`), &decoded))
+
+	// Piece types elsewhere, like on the board, stay numbers
+	data, err = json.Marshal(Piece{Type: Rook, Color: White})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"Type":1`)
+}
+
+func TestLegalMoves(t *testing.T) {
+	game := NewEngine()
+	assert.Len(t, game.LegalMoves(), 20)
+	assert.ElementsMatch(t, []Move{
+		{From: Location{Row: 0, Col: 6}, To: Location{Row: 2, Col: 5}},
+		{From: Location{Row: 0, Col: 6}, To: Location{Row: 2, Col: 7}},
+	}, game.LegalMovesFrom(Location{Row: 0, Col: 6}))
+	assert.Empty(t, game.LegalMovesFrom(Location{Row: 0, Col: 0}))
+	assert.Empty(t, game.LegalMovesFrom(Location{Row: 4, Col: 4}))
+
+	// One move per promotion piece
+	game, err := ParseFEN("4k3/P7/8/8/8/8/8/4K3 w - - 0 1")
+	assert.Nil(t, err)
+	assert.Len(t, game.LegalMovesFrom(Location{Row: 6, Col: 0}), 4)
+
+	// No moves once the game has ended
+	game, err = ParseFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	assert.Nil(t, err)
+	assert.Empty(t, game.LegalMoves())
+}
@@ -0,0 +1,137 @@
+package chess
+
+import "math/bits"
+
+// Piece values in centipawns, indexed by PieceType
+var pieceValues = [6]int{
+	King:   0,
+	Rook:   500,
+	Bishop: 330,
+	Queen:  900,
+	Knight: 320,
+	Pawn:   100,
+}
+
+// Piece-square tables from white's point of view, written with the eighth
+// rank first so they read like a board diagram
+var pieceSquareTables = [6][64]int{
+	King: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+	Rook: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	Bishop: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	Queen: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	Knight: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+}
+
+// Once the queens are gone the king should walk to the center
+var kingEndgameTable = [64]int{
+	-50, -40, -30, -20, -20, -30, -40, -50,
+	-30, -20, -10, 0, 0, -10, -20, -30,
+	-30, -10, 20, 30, 30, 20, -10, -30,
+	-30, -10, 30, 40, 40, 30, -10, -30,
+	-30, -10, 30, 40, 40, 30, -10, -30,
+	-30, -10, 20, 30, 30, 20, -10, -30,
+	-30, -30, 0, 0, 0, 0, -30, -30,
+	-50, -30, -30, -30, -30, -30, -30, -50,
+}
+
+// Return the index of the square in the tables for a piece of the given color
+func tableIndex(sq int, color Color) int {
+	if color == White {
+		return (7-sq/8)*8 + sq%8
+	}
+	return sq
+}
+
+// Check if the position is an endgame, where a side with a queen has
+// at most one minor piece besides it
+func (p *position) isEndgame() bool {
+	for _, color := range []Color{White, Black} {
+		pieces := &p.pieces[color]
+		if pieces[Queen] == 0 {
+			continue
+		}
+		minors := bits.OnesCount64(uint64(pieces[Knight] | pieces[Bishop]))
+		if pieces[Rook] != 0 || minors > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the static evaluation in centipawns from the side to move's point of view
+func (p *position) evaluate() int {
+	endgame := p.isEndgame()
+	score := 0
+	for _, color := range []Color{White, Black} {
+		sign := 1
+		if color != p.turn {
+			sign = -1
+		}
+		for piece := range p.pieces[color] {
+			table := &pieceSquareTables[piece]
+			if piece == int(King) && endgame {
+				table = &kingEndgameTable
+			}
+			for b := p.pieces[color][piece]; b != 0; {
+				sq := popSquare(&b)
+				score += sign * (pieceValues[piece] + table[tableIndex(sq, color)])
+			}
+		}
+	}
+	return score
+}
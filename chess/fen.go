@@ -0,0 +1,266 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const StartingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+var ErrInvalidFEN = errors.New("invalid FEN")
+
+var fenPieceLetters = map[PieceType]rune{
+	King:   'k',
+	Queen:  'q',
+	Rook:   'r',
+	Bishop: 'b',
+	Knight: 'n',
+	Pawn:   'p',
+}
+
+func fenError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFEN, fmt.Sprintf(format, args...))
+}
+
+// Build an engine from a position in Forsyth-Edwards Notation.
+// The halfmove clock and fullmove number may be omitted.
+func ParseFEN(fen string) (*ChessEngine, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 4 && len(fields) != 6 {
+		return nil, fenError("expected 6 fields, got %d", len(fields))
+	}
+
+	pieces, err := parseFENBoard(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	engine := NewFromPieces(pieces)
+
+	switch fields[1] {
+	case "w":
+		engine.turn = White
+	case "b":
+		engine.turn = Black
+	default:
+		return nil, fenError("invalid side to move %q", fields[1])
+	}
+
+	if err := engine.parseFENCastling(fields[2]); err != nil {
+		return nil, err
+	}
+	if err := engine.parseFENEnPassant(fields[3]); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 6 {
+		engine.halfMoveClock, err = strconv.Atoi(fields[4])
+		if err != nil || engine.halfMoveClock < 0 {
+			return nil, fenError("invalid halfmove clock %q", fields[4])
+		}
+		engine.fullMoveNumber, err = strconv.Atoi(fields[5])
+		if err != nil || engine.fullMoveNumber < 1 {
+			return nil, fenError("invalid fullmove number %q", fields[5])
+		}
+	}
+
+	if engine.isChecked(engine.turn.OppositeColor()) {
+		return nil, fenError("%s is in check but it's not their turn", engine.turn.OppositeColor())
+	}
+
+	engine.generatePossibleMoves()
+	clear(engine.repetitions)
+	engine.recordPosition()
+	if result := engine.checkResult(); result != NoResult {
+		engine.finish(result.Reason, result.WinnerColor)
+	}
+	return engine, nil
+}
+
+func parseFENBoard(placement string) ([]*Piece, error) {
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return nil, fenError("expected 8 ranks, got %d", len(ranks))
+	}
+
+	pieces := []*Piece{}
+	kings := map[Color]int{White: 0, Black: 0}
+	for i, rank := range ranks {
+		row := 7 - i
+		col := 0
+		for _, c := range rank {
+			if c >= '1' && c <= '8' {
+				col += int(c - '0')
+				continue
+			}
+
+			pieceType, found := King, false
+			for t, letter := range fenPieceLetters {
+				if unicode.ToLower(c) == letter {
+					pieceType, found = t, true
+				}
+			}
+			if !found {
+				return nil, fenError("invalid piece %q", c)
+			}
+			if col > 7 {
+				return nil, fenError("rank %d is too long", row+1)
+			}
+
+			color := Black
+			if unicode.IsUpper(c) {
+				color = White
+			}
+			if pieceType == King {
+				kings[color]++
+			}
+			if pieceType == Pawn && (row == 0 || row == 7) {
+				return nil, fenError("pawn on the back rank %s", Location{Row: row, Col: col}.Square())
+			}
+
+			pieces = append(pieces, &Piece{Type: pieceType, Color: color, Location: Location{Row: row, Col: col}})
+			col++
+		}
+		if col != 8 {
+			return nil, fenError("rank %d doesn't have 8 squares", row+1)
+		}
+	}
+
+	for color, count := range kings {
+		if count != 1 {
+			return nil, fenError("%s has %d kings", color, count)
+		}
+	}
+	return pieces, nil
+}
+
+func (g *ChessEngine) parseFENCastling(field string) error {
+	g.castleRights = map[Color]castling{White: {}, Black: {}}
+	if field == "-" {
+		return nil
+	}
+
+	for _, c := range field {
+		color := Black
+		if unicode.IsUpper(c) {
+			color = White
+		}
+		rights := g.castleRights[color]
+		rookCol := 0
+		switch unicode.ToLower(c) {
+		case 'k':
+			rights.right = true
+			rookCol = 7
+		case 'q':
+			rights.left = true
+		default:
+			return fenError("invalid castling rights %q", field)
+		}
+
+		backRow := 0
+		if color == Black {
+			backRow = 7
+		}
+		king := g.board[backRow][4]
+		rook := g.board[backRow][rookCol]
+		if king == nil || king.Type != King || king.Color != color || rook == nil || rook.Type != Rook || rook.Color != color {
+			return fenError("%s can't castle without king and rook on their squares", color)
+		}
+		g.castleRights[color] = rights
+	}
+	return nil
+}
+
+func (g *ChessEngine) parseFENEnPassant(field string) error {
+	if field == "-" {
+		return nil
+	}
+
+	loc, err := ParseSquare(field)
+	if err != nil {
+		return fenError("invalid en passant square %q", field)
+	}
+
+	// The square must be right behind a pawn of the side that just moved
+	pawnRow, fromRow := 4, 6
+	if g.turn == Black {
+		pawnRow, fromRow = 3, 1
+	}
+	pawn := g.board[pawnRow][loc.Col]
+	if loc.Row != (pawnRow+fromRow)/2 || g.board[loc.Row][loc.Col] != nil || g.board[fromRow][loc.Col] != nil ||
+		pawn == nil || pawn.Type != Pawn || pawn.Color == g.turn {
+		return fenError("invalid en passant square %q", field)
+	}
+	g.enPassant = &loc
+	return nil
+}
+
+// Return the current position in Forsyth-Edwards Notation
+func (g *ChessEngine) FEN() string {
+	sb := strings.Builder{}
+	for row := 7; row >= 0; row-- {
+		empty := 0
+		for col := 0; col < 8; col++ {
+			piece := g.board[row][col]
+			if piece == nil {
+				empty++
+				continue
+			}
+			if empty != 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			letter := fenPieceLetters[piece.Type]
+			if piece.Color == White {
+				letter = unicode.ToUpper(letter)
+			}
+			sb.WriteRune(letter)
+		}
+		if empty != 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+		if row != 0 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if g.turn == White {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	sb.WriteString(formatCastlingRights(g.castleRights))
+
+	if g.enPassant != nil {
+		sb.WriteString(" " + g.enPassant.Square())
+	} else {
+		sb.WriteString(" -")
+	}
+
+	sb.WriteString(fmt.Sprintf(" %d %d", g.halfMoveClock, g.fullMoveNumber))
+	return sb.String()
+}
+
+// Write castling rights as the third field of FEN
+func formatCastlingRights(rights map[Color]castling) string {
+	sb := strings.Builder{}
+	if rights[White].right {
+		sb.WriteString("K")
+	}
+	if rights[White].left {
+		sb.WriteString("Q")
+	}
+	if rights[Black].right {
+		sb.WriteString("k")
+	}
+	if rights[Black].left {
+		sb.WriteString("q")
+	}
+	if sb.Len() == 0 {
+		return "-"
+	}
+	return sb.String()
+}
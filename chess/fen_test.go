@@ -0,0 +1,83 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFEN(t *testing.T) {
+	game, err := ParseFEN(StartingFEN)
+	assert.Nil(t, err)
+	assert.Equal(t, NewEngine().FEN(), game.FEN())
+	assert.Equal(t, StartingFEN, game.FEN())
+
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"r3k2r/8/8/8/8/8/8/R3K2R b Kq - 12 40",
+	}
+	for _, fen := range fens {
+		game, err := ParseFEN(fen)
+		assert.Nil(t, err, fen)
+		assert.Equal(t, fen, game.FEN())
+	}
+}
+
+func TestParseShortFEN(t *testing.T) {
+	game, err := ParseFEN("4k3/8/8/8/8/8/8/4K3 b - -")
+	assert.Nil(t, err)
+	assert.Equal(t, Black, game.GetTurn())
+	assert.Equal(t, "4k3/8/8/8/8/8/8/4K3 b - - 0 1", game.FEN())
+}
+
+func TestParseInvalidFEN(t *testing.T) {
+	fens := map[string]string{
+		"empty":                    "",
+		"missing ranks":            "8/8/8/8/8/8/8 w - - 0 1",
+		"long rank":                "4k3/9/8/8/8/8/8/4K3 w - - 0 1",
+		"short rank":               "4k3/7/8/8/8/8/8/4K3 w - - 0 1",
+		"unknown piece":            "4k3/8/8/8/8/8/8/4K2X w - - 0 1",
+		"no white king":            "4k3/8/8/8/8/8/8/8 w - - 0 1",
+		"two black kings":          "3kk3/8/8/8/8/8/8/4K3 w - - 0 1",
+		"pawn on first rank":       "4k3/8/8/8/8/8/8/P3K3 w - - 0 1",
+		"pawn on last rank":        "p3k3/8/8/8/8/8/8/4K3 w - - 0 1",
+		"invalid side":             "4k3/8/8/8/8/8/8/4K3 x - - 0 1",
+		"castling without rook":    "4k3/8/8/8/8/8/8/4K3 w K - 0 1",
+		"castling with moved king": "4k3/8/8/8/8/8/8/R2K3R w KQ - 0 1",
+		"invalid castling":         "4k3/8/8/8/8/8/8/4K3 w X - 0 1",
+		"invalid en passant":       "4k3/8/8/8/8/8/8/4K3 w e6 0 1",
+		"en passant without pawn":  "4k3/8/8/8/8/8/8/4K3 w - e6 0 1",
+		"negative halfmove clock":  "4k3/8/8/8/8/8/8/4K3 w - - -1 1",
+		"zero fullmove number":     "4k3/8/8/8/8/8/8/4K3 w - - 0 0",
+		"opponent in check":        "4k3/8/8/8/8/8/8/4K2r b - - 0 1",
+	}
+	for name, fen := range fens {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFEN(fen)
+			assert.ErrorIs(t, err, ErrInvalidFEN)
+		})
+	}
+}
+
+func TestFENAfterMoves(t *testing.T) {
+	game := NewEngine()
+	assert.Nil(t, game.Play(White, Move{From: Location{Row: 1, Col: 4}, To: Location{Row: 3, Col: 4}}))
+	assert.Equal(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", game.FEN())
+
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 7, Col: 6}, To: Location{Row: 5, Col: 5}}))
+	assert.Nil(t, game.Play(White, Move{From: Location{Row: 0, Col: 6}, To: Location{Row: 2, Col: 5}}))
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 5, Col: 5}, To: Location{Row: 3, Col: 4}}))
+	assert.Equal(t, "rnbqkb1r/pppppppp/8/8/4n3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 3", game.FEN())
+}
+
+func TestParseFENResult(t *testing.T) {
+	game, err := ParseFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	assert.Nil(t, err)
+	assert.Equal(t, Stalemate, game.GetResult().Reason)
+
+	game, err = ParseFEN("7k/6Q1/6K1/8/8/8/8/8 b - - 0 1")
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Reason: Checkmate, WinnerColor: White}, game.GetResult())
+}
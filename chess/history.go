@@ -0,0 +1,91 @@
+package chess
+
+import "errors"
+
+var (
+	ErrNoMoveToUndo = errors.New("there is no move to take back")
+	ErrNoMoveToRedo = errors.New("there is no move to replay")
+)
+
+// A ply of the game along with the state of the game before it was played
+type HistoryEntry struct {
+	Move  Move      `json:"move"`
+	Color Color     `json:"color"`
+	Piece PieceType `json:"piece"`
+
+	// Type of the captured piece. The zero value (King) means nothing was captured.
+	Captured PieceType `json:"captured,omitempty"`
+
+	CastlingRights string `json:"castlingRights"` // As written in FEN
+	EnPassant      string `json:"enPassant"`      // As written in FEN
+	HalfMoveClock  int    `json:"halfMoveClock"`
+	FullMoveNumber int    `json:"fullMoveNumber"`
+}
+
+// Return every ply played so far, in order
+func (g *ChessEngine) History() []HistoryEntry {
+	entries := make([]HistoryEntry, len(g.history))
+	for i, rb := range g.history {
+		entries[i] = HistoryEntry{
+			Move:           rb.move,
+			Color:          rb.pieceColor,
+			Piece:          rb.pieceType,
+			CastlingRights: formatCastlingRights(rb.castleRightsBackup),
+			EnPassant:      "-",
+			HalfMoveClock:  rb.halfMoveClockBackup,
+			FullMoveNumber: rb.fullMoveNumberBackup,
+		}
+		if rb.capturedPiece != nil {
+			entries[i].Captured = rb.capturedPiece.Type
+		}
+		if rb.enPassantBackup != nil {
+			entries[i].EnPassant = rb.enPassantBackup.Square()
+		}
+	}
+	return entries
+}
+
+// Return the moves played so far, in order
+func (g *ChessEngine) Moves() []Move {
+	moves := make([]Move, len(g.history))
+	for i, rb := range g.history {
+		moves[i] = rb.move
+	}
+	return moves
+}
+
+// Take back the last ply. A finished game is resumed.
+func (g *ChessEngine) Undo() error {
+	if len(g.history) == 0 {
+		return ErrNoMoveToUndo
+	}
+
+	g.repetitions[g.positionKey()]--
+	rb := g.history[len(g.history)-1]
+	g.history = g.history[:len(g.history)-1]
+
+	rb.RollBack()
+	g.halfMoveClock = rb.halfMoveClockBackup
+	g.fullMoveNumber = rb.fullMoveNumberBackup
+	g.redoMoves = append(g.redoMoves, rb.move)
+
+	g.finished = false
+	g.result = NoResult
+	g.switchTurn()
+	return nil
+}
+
+// Play again the last ply taken back by Undo
+func (g *ChessEngine) Redo() error {
+	if len(g.redoMoves) == 0 {
+		return ErrNoMoveToRedo
+	}
+
+	move := g.redoMoves[len(g.redoMoves)-1]
+	redoMoves := g.redoMoves[:len(g.redoMoves)-1]
+	if err := g.Play(g.turn, move); err != nil {
+		return err
+	}
+	g.redoMoves = redoMoves
+	return nil
+}
@@ -0,0 +1,92 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Play the moves, take every one of them back and replay them, checking
+// the position after each step
+func assertUndoRedo(t *testing.T, fen string, moves ...string) {
+	t.Helper()
+	game, err := ParseFEN(fen)
+	assert.Nil(t, err)
+
+	fens := []string{game.FEN()}
+	for _, uci := range moves {
+		playUCI(t, game, uci)
+		fens = append(fens, game.FEN())
+	}
+
+	for i := len(moves) - 1; i >= 0; i-- {
+		assert.Nil(t, game.Undo())
+		assert.Equal(t, fens[i], game.FEN(), moves[i])
+	}
+	assert.ErrorIs(t, game.Undo(), ErrNoMoveToUndo)
+
+	for i := range moves {
+		assert.Nil(t, game.Redo())
+		assert.Equal(t, fens[i+1], game.FEN(), moves[i])
+	}
+	assert.ErrorIs(t, game.Redo(), ErrNoMoveToRedo)
+}
+
+func TestUndoRedo(t *testing.T) {
+	// Captures
+	assertUndoRedo(t, StartingFEN, "e2e4", "d7d5", "e4d5", "d8d5", "b1c3", "d5a5")
+	// Castling on both sides
+	assertUndoRedo(t, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "e8c8", "f1f8", "d8f8")
+	// En passant
+	assertUndoRedo(t, "4k3/4p3/8/3P4/8/8/8/4K3 b - - 0 1", "e7e5", "d5e6", "e8e7")
+	// Promotion with capture
+	assertUndoRedo(t, "1r2k3/P6p/8/8/8/8/7P/4K3 w - - 0 1", "a7b8n", "e8e7")
+}
+
+func TestUndoRestoresGameState(t *testing.T) {
+	game := NewEngine()
+	playUCI(t, game, "g1f3", "g8f6", "f3g1", "f6g8")
+	assert.Equal(t, 2, game.Repetitions())
+	assert.Equal(t, 4, game.HalfMoveClock())
+
+	assert.Nil(t, game.Undo())
+	assert.Equal(t, 1, game.Repetitions())
+	assert.Equal(t, 3, game.HalfMoveClock())
+	assert.Equal(t, Black, game.GetTurn())
+
+	// A new move drops the moves that could be redone
+	playUCI(t, game, "f6e4")
+	assert.ErrorIs(t, game.Redo(), ErrNoMoveToRedo)
+}
+
+func TestUndoFinishedGame(t *testing.T) {
+	game := NewEngine()
+	playUCI(t, game, "f2f3", "e7e5", "g2g4", "d8h4")
+	assert.Equal(t, Checkmate, game.GetResult().Reason)
+
+	assert.Nil(t, game.Undo())
+	assert.Equal(t, NoResult, game.GetResult())
+	assert.Nil(t, game.Play(Black, Move{From: Location{Row: 6, Col: 3}, To: Location{Row: 4, Col: 3}}))
+}
+
+func TestHistory(t *testing.T) {
+	game := NewEngine()
+	playUCI(t, game, "e2e4", "d7d5", "e4d5")
+
+	history := game.History()
+	assert.Len(t, history, 3)
+
+	assert.Equal(t, White, history[0].Color)
+	assert.Equal(t, Pawn, history[0].Piece)
+	assert.Equal(t, "KQkq", history[0].CastlingRights)
+	assert.Equal(t, "-", history[0].EnPassant)
+	assert.Equal(t, 1, history[0].FullMoveNumber)
+
+	assert.Equal(t, Black, history[1].Color)
+	assert.Equal(t, "e3", history[1].EnPassant)
+	assert.Equal(t, King, history[1].Captured)
+
+	assert.Equal(t, Pawn, history[2].Captured)
+	assert.Equal(t, 2, history[2].FullMoveNumber)
+	assert.Equal(t, "e4d5", history[2].Move.UCI())
+}
@@ -0,0 +1,24 @@
+package chess
+
+// Count the leaf nodes of the legal move tree of the given depth from the
+// current position. Comparing with published counts verifies move generation.
+func (g *ChessEngine) Perft(depth int) int {
+	pos := g.position()
+	return pos.perft(depth)
+}
+
+// Return the perft count below each legal move, keyed by the move in UCI
+// notation. Comparing with another engine's output narrows down a wrong count.
+func (g *ChessEngine) Divide(depth int) map[string]int {
+	counts := map[string]int{}
+	if depth < 1 {
+		return counts
+	}
+
+	pos := g.position()
+	for _, m := range pos.legalMoves(make([]bitMove, 0, 64)) {
+		next := pos.play(m)
+		counts[m.toMove().UCI()] = next.perft(depth - 1)
+	}
+	return counts
+}
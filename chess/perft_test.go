@@ -0,0 +1,93 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const kiwipeteFEN = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+// Standard perft positions with their published node counts, indexed by depth
+// starting from 1. See https://www.chessprogramming.org/Perft_Results
+var perftPositions = []struct {
+	name  string
+	fen   string
+	nodes []int
+}{
+	{"initial", StartingFEN, []int{20, 400, 8902, 197281, 4865609}},
+	{"kiwipete", kiwipeteFEN, []int{48, 2039, 97862, 4085603}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238, 674624}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467, 422333}},
+	{"position 4 mirrored", "r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1", []int{6, 264, 9467, 422333}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379, 2103487}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890, 3894594}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, position := range perftPositions {
+		game, err := ParseFEN(position.fen)
+		assert.Nil(t, err, position.name)
+
+		for i, nodes := range position.nodes {
+			if testing.Short() && nodes > 1000000 {
+				break
+			}
+			assert.Equal(t, nodes, game.Perft(i+1), "%s depth %d", position.name, i+1)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	game := NewEngine()
+	counts := game.Divide(3)
+	assert.Len(t, counts, 20)
+	assert.Equal(t, 600, counts["e2e4"])
+	assert.Equal(t, 440, counts["g1f3"])
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	assert.Equal(t, game.Perft(3), total)
+}
+
+// Count the leaf nodes by playing and taking back every move on the engine
+// itself, which exercises Play and the rollback instead of the bitboards
+func playPerft(g *ChessEngine, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	nodes := 0
+	for _, move := range g.legalMoves() {
+		if err := g.Play(g.turn, move); err != nil {
+			panic(err)
+		}
+		nodes += playPerft(g, depth-1)
+		if err := g.Undo(); err != nil {
+			panic(err)
+		}
+	}
+	return nodes
+}
+
+func TestPlayPerft(t *testing.T) {
+	for _, position := range perftPositions {
+		game, err := ParseFEN(position.fen)
+		assert.Nil(t, err, position.name)
+		// Playing on the engine is slow, so stop at a few thousand nodes
+		depth := 1
+		for depth < len(position.nodes) && position.nodes[depth] <= 10000 {
+			depth++
+		}
+		assert.Equal(t, position.nodes[depth-1], playPerft(game, depth), position.name)
+		assert.Equal(t, position.fen, game.FEN(), position.name)
+	}
+}
+
+func BenchmarkPerft(b *testing.B) {
+	game, _ := ParseFEN(kiwipeteFEN)
+	for i := 0; i < b.N; i++ {
+		game.Perft(3)
+	}
+}
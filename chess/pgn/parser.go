@@ -0,0 +1,348 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sina-am/chess/chess"
+)
+
+type tokenType int
+
+const (
+	tagToken tokenType = iota
+	commentToken
+	nagToken
+	openVariationToken
+	closeVariationToken
+	symbolToken
+	resultToken
+)
+
+type token struct {
+	typ   tokenType
+	name  string
+	value string
+}
+
+// Suffix annotations and the NAGs they stand for
+var suffixAnnotations = map[string]int{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+func isResult(s string) bool {
+	return s == WhiteWins || s == BlackWins || s == DrawResult || s == NoResult
+}
+
+func isSymbolRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_+#=:-/.", r)
+}
+
+func tokenize(r io.Reader) ([]token, error) {
+	reader := bufio.NewReader(r)
+	tokens := []token{}
+	lineStart := true
+
+	readUntil := func(end rune) (string, error) {
+		sb := strings.Builder{}
+		for {
+			c, _, err := reader.ReadRune()
+			if err != nil {
+				if err == io.EOF {
+					return "", fmt.Errorf("%w: missing %q", ErrInvalidPGN, end)
+				}
+				return "", err
+			}
+			if c == end {
+				return sb.String(), nil
+			}
+			sb.WriteRune(c)
+		}
+	}
+
+	for {
+		c, _, err := reader.ReadRune()
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if c == '%' && lineStart {
+			// Escaped line
+			if _, err := reader.ReadString('\n'); err != nil && err != io.EOF {
+				return nil, err
+			}
+			continue
+		}
+		lineStart = c == '\n'
+
+		switch {
+		case unicode.IsSpace(c):
+		case c == '[':
+			content, err := readUntil(']')
+			if err != nil {
+				return nil, err
+			}
+			tag, err := parseTag(content)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tag)
+		case c == '{':
+			comment, err := readUntil('}')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{typ: commentToken, value: strings.TrimSpace(comment)})
+		case c == ';':
+			comment, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			lineStart = true
+			tokens = append(tokens, token{typ: commentToken, value: strings.TrimSpace(comment)})
+		case c == '(':
+			tokens = append(tokens, token{typ: openVariationToken})
+		case c == ')':
+			tokens = append(tokens, token{typ: closeVariationToken})
+		case c == '*':
+			tokens = append(tokens, token{typ: resultToken, value: NoResult})
+		case c == '$':
+			digits := ""
+			for {
+				next, _, err := reader.ReadRune()
+				if err != nil || !unicode.IsDigit(next) {
+					if err == nil {
+						reader.UnreadRune()
+					}
+					break
+				}
+				digits += string(next)
+			}
+			if digits == "" {
+				return nil, fmt.Errorf("%w: NAG without a number", ErrInvalidPGN)
+			}
+			tokens = append(tokens, token{typ: nagToken, value: digits})
+		case c == '!' || c == '?':
+			suffix := string(c)
+			for {
+				next, _, err := reader.ReadRune()
+				if err != nil || (next != '!' && next != '?') {
+					if err == nil {
+						reader.UnreadRune()
+					}
+					break
+				}
+				suffix += string(next)
+			}
+			nag, ok := suffixAnnotations[suffix]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown annotation %q", ErrInvalidPGN, suffix)
+			}
+			tokens = append(tokens, token{typ: nagToken, value: strconv.Itoa(nag)})
+		case isSymbolRune(c):
+			symbol := string(c)
+			for {
+				next, _, err := reader.ReadRune()
+				if err != nil || !isSymbolRune(next) {
+					if err == nil {
+						reader.UnreadRune()
+					}
+					break
+				}
+				symbol += string(next)
+			}
+			if isResult(symbol) {
+				tokens = append(tokens, token{typ: resultToken, value: symbol})
+			} else {
+				tokens = append(tokens, token{typ: symbolToken, value: symbol})
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrInvalidPGN, c)
+		}
+	}
+}
+
+func parseTag(content string) (token, error) {
+	content = strings.TrimSpace(content)
+	name, value, found := strings.Cut(content, " ")
+	value = strings.TrimSpace(value)
+	if !found || len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return token{}, fmt.Errorf("%w: invalid tag [%s]", ErrInvalidPGN, content)
+	}
+	value = value[1 : len(value)-1]
+	value = strings.ReplaceAll(value, `\"`, `"`)
+	value = strings.ReplaceAll(value, `\\`, `\`)
+	return token{typ: tagToken, name: name, value: value}, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// Parse every game in a PGN file
+func Parse(r io.Reader) ([]*Game, error) {
+	tokens, err := tokenize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	games := []*Game{}
+	for !p.done() {
+		game, err := p.parseGame()
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", len(games)+1, err)
+		}
+		games = append(games, game)
+	}
+	return games, nil
+}
+
+// Parse a single game
+func ParseGame(s string) (*Game, error) {
+	games, err := Parse(strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(games) != 1 {
+		return nil, fmt.Errorf("%w: expected one game, got %d", ErrInvalidPGN, len(games))
+	}
+	return games[0], nil
+}
+
+func (p *parser) parseGame() (*Game, error) {
+	game := &Game{Tags: map[string]string{}, Result: NoResult}
+	for !p.done() && p.tokens[p.pos].typ == tagToken {
+		tag := p.next()
+		game.Tags[tag.name] = tag.value
+	}
+	if result, ok := game.Tags["Result"]; ok {
+		game.Result = result
+	}
+
+	engine, err := game.Engine()
+	if err != nil {
+		return nil, err
+	}
+	game.Moves, err = p.parseMoves(engine, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		switch tok := p.next(); tok.typ {
+		case resultToken:
+			game.Result = tok.value
+		case closeVariationToken:
+			return nil, fmt.Errorf("%w: unexpected ')'", ErrInvalidPGN)
+		}
+	}
+	return game, nil
+}
+
+// Parse a line of moves played from the given position, stopping at the
+// end of the game or of the variation
+func (p *parser) parseMoves(engine *chess.ChessEngine, depth int) ([]*Move, error) {
+	moves := []*Move{}
+	var before *chess.ChessEngine
+	commentBefore := ""
+
+	for !p.done() {
+		tok := p.tokens[p.pos]
+		switch tok.typ {
+		case tagToken:
+			if depth == 0 {
+				// Next game starts without a result
+				return moves, nil
+			}
+			return nil, fmt.Errorf("%w: tag inside a variation", ErrInvalidPGN)
+		case resultToken, closeVariationToken:
+			return moves, nil
+		}
+		p.next()
+
+		var last *Move
+		if len(moves) != 0 {
+			last = moves[len(moves)-1]
+		}
+
+		switch tok.typ {
+		case commentToken:
+			if last == nil {
+				commentBefore = strings.TrimSpace(commentBefore + " " + tok.value)
+			} else {
+				last.Comment = strings.TrimSpace(last.Comment + " " + tok.value)
+			}
+		case nagToken:
+			if last == nil {
+				return nil, fmt.Errorf("%w: annotation before any move", ErrInvalidPGN)
+			}
+			nag, _ := strconv.Atoi(tok.value)
+			last.NAGs = append(last.NAGs, nag)
+		case openVariationToken:
+			if last == nil {
+				return nil, fmt.Errorf("%w: variation before any move", ErrInvalidPGN)
+			}
+			variation, err := p.parseMoves(before.Clone(), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if p.done() || p.next().typ != closeVariationToken {
+				return nil, fmt.Errorf("%w: missing ')'", ErrInvalidPGN)
+			}
+			last.Variations = append(last.Variations, variation)
+		case symbolToken:
+			text := stripMoveNumber(tok.value)
+			if text == "" {
+				continue
+			}
+			move, err := engine.ParseSAN(text)
+			if err != nil {
+				return nil, fmt.Errorf("move %d: %w", engine.FullMoveNumber(), err)
+			}
+			san, err := engine.SAN(move)
+			if err != nil {
+				return nil, err
+			}
+			before = engine.Clone()
+			if err := engine.Play(engine.GetTurn(), move); err != nil {
+				return nil, err
+			}
+			moves = append(moves, &Move{Move: move, SAN: san, CommentBefore: commentBefore})
+			commentBefore = ""
+		}
+	}
+	return moves, nil
+}
+
+// Remove a move number indication like "12." or "12..." from the start of a symbol
+func stripMoveNumber(s string) string {
+	digits := strings.TrimLeft(s, "0123456789")
+	if digits == s || !strings.HasPrefix(digits, ".") {
+		return s
+	}
+	return strings.TrimLeft(digits, ".")
+}
@@ -0,0 +1,228 @@
+package pgn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sina-am/chess/chess"
+)
+
+const (
+	WhiteWins  = "1-0"
+	BlackWins  = "0-1"
+	DrawResult = "1/2-1/2"
+	NoResult   = "*"
+)
+
+var ErrInvalidPGN = errors.New("invalid PGN")
+
+// Tags every PGN game must have, in the order they are written
+var SevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type Move struct {
+	Move chess.Move
+	SAN  string
+	NAGs []int
+
+	CommentBefore string
+	Comment       string
+
+	// Alternative lines starting from the position before this move
+	Variations [][]*Move
+}
+
+type Game struct {
+	Tags   map[string]string
+	Moves  []*Move
+	Result string
+}
+
+// Convert an engine result to its PGN notation
+func ResultString(result chess.Result) string {
+	if result == chess.NoResult {
+		return NoResult
+	}
+	switch result.WinnerColor {
+	case chess.White:
+		return WhiteWins
+	case chess.Black:
+		return BlackWins
+	default:
+		return DrawResult
+	}
+}
+
+// Build a game from moves played from the standard starting position,
+// or from fen if it's not empty
+func NewGame(fen string, moves []chess.Move, result chess.Result) (*Game, error) {
+	game := &Game{
+		Tags: map[string]string{
+			"Event":  "?",
+			"Site":   "?",
+			"Date":   "????.??.??",
+			"Round":  "?",
+			"White":  "?",
+			"Black":  "?",
+			"Result": ResultString(result),
+		},
+		Moves:  []*Move{},
+		Result: ResultString(result),
+	}
+	if fen != "" {
+		game.Tags["SetUp"] = "1"
+		game.Tags["FEN"] = fen
+	}
+
+	engine, err := game.Engine()
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range moves {
+		san, err := engine.SAN(move)
+		if err != nil {
+			return nil, fmt.Errorf("move %d: %w", len(game.Moves)+1, err)
+		}
+		if err := engine.Play(engine.GetTurn(), move); err != nil {
+			return nil, err
+		}
+		game.Moves = append(game.Moves, &Move{Move: move, SAN: san})
+	}
+	return game, nil
+}
+
+// Return an engine set up at the starting position of the game
+func (g *Game) Engine() (*chess.ChessEngine, error) {
+	if fen, ok := g.Tags["FEN"]; ok {
+		return chess.ParseFEN(fen)
+	}
+	return chess.NewEngine(), nil
+}
+
+// Return the moves of the main line
+func (g *Game) MainLine() []chess.Move {
+	moves := make([]chess.Move, len(g.Moves))
+	for i := range g.Moves {
+		moves[i] = g.Moves[i].Move
+	}
+	return moves
+}
+
+func (g *Game) String() string {
+	sb := strings.Builder{}
+	g.Write(&sb)
+	return sb.String()
+}
+
+// Write the game in PGN export format
+func (g *Game) Write(w io.Writer) error {
+	result := g.Result
+	if result == "" {
+		result = NoResult
+	}
+
+	tags := []string{}
+	for name := range g.Tags {
+		if !isRosterTag(name) {
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+	tags = append(SevenTagRoster, tags...)
+
+	sb := strings.Builder{}
+	for _, name := range tags {
+		value, ok := g.Tags[name]
+		if name == "Result" {
+			value, ok = result, true
+		}
+		if !ok && name == "Date" {
+			value = "????.??.??"
+		} else if !ok {
+			value = "?"
+		}
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `"`, `\"`)
+		fmt.Fprintf(&sb, "[%s \"%s\"]\n", name, value)
+	}
+	sb.WriteString("\n")
+
+	engine, err := g.Engine()
+	if err != nil {
+		return err
+	}
+	ply := (engine.FullMoveNumber() - 1) * 2
+	if engine.GetTurn() == chess.Black {
+		ply++
+	}
+
+	movetext := []string{}
+	writeMoves(&movetext, g.Moves, ply)
+	movetext = append(movetext, result)
+
+	lineLength := 0
+	for i, token := range movetext {
+		if i != 0 && lineLength+len(token)+1 > 79 {
+			sb.WriteString("\n")
+			lineLength = 0
+		} else if i != 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+		sb.WriteString(token)
+		lineLength += len(token)
+	}
+	sb.WriteString("\n\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func isRosterTag(name string) bool {
+	for _, tag := range SevenTagRoster {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMoves(tokens *[]string, moves []*Move, ply int) {
+	forceNumber := true
+	for _, move := range moves {
+		if move.CommentBefore != "" {
+			*tokens = append(*tokens, "{"+move.CommentBefore+"}")
+			forceNumber = true
+		}
+		// Move numbers are kept on the same line as their move
+		if ply%2 == 0 {
+			*tokens = append(*tokens, fmt.Sprintf("%d. %s", ply/2+1, move.SAN))
+		} else if forceNumber {
+			*tokens = append(*tokens, fmt.Sprintf("%d... %s", ply/2+1, move.SAN))
+		} else {
+			*tokens = append(*tokens, move.SAN)
+		}
+		forceNumber = false
+
+		for _, nag := range move.NAGs {
+			*tokens = append(*tokens, fmt.Sprintf("$%d", nag))
+		}
+		if move.Comment != "" {
+			*tokens = append(*tokens, "{"+move.Comment+"}")
+			forceNumber = true
+		}
+		for _, variation := range move.Variations {
+			if len(variation) == 0 {
+				continue
+			}
+			start := len(*tokens)
+			writeMoves(tokens, variation, ply)
+			(*tokens)[start] = "(" + (*tokens)[start]
+			(*tokens)[len(*tokens)-1] += ")"
+			forceNumber = true
+		}
+		ply++
+	}
+}
@@ -0,0 +1,138 @@
+package pgn
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/stretchr/testify/assert"
+)
+
+const operaGame = `[Event "Paris"]
+[Site "Paris FRA"]
+[Date "1858.??.??"]
+[Round "?"]
+[White "Paul Morphy"]
+[Black "Duke Karl / Count Isouard"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 3. d4 Bg4 4. dxe5 Bxf3 5. Qxf3 dxe5 6. Bc4 Nf6 7. Qb3 Qe7
+8. Nc3 c6 9. Bg5 b5 10. Nxb5 cxb5 11. Bxb5+ Nbd7 12. O-O-O Rd8 13. Rxd7 Rxd7
+14. Rd1 Qe6 15. Bxd7+ Nxd7 16. Qb8+ Nxb8 17. Rd8# 1-0
+
+`
+
+func TestParseGame(t *testing.T) {
+	game, err := ParseGame(operaGame)
+	assert.Nil(t, err)
+	assert.Equal(t, WhiteWins, game.Result)
+	assert.Equal(t, "Paul Morphy", game.Tags["White"])
+	assert.Len(t, game.Moves, 33)
+	assert.Equal(t, "Rd8#", game.Moves[32].SAN)
+
+	engine := chess.NewEngine()
+	for _, move := range game.MainLine() {
+		assert.Nil(t, engine.Play(engine.GetTurn(), move))
+	}
+	assert.Equal(t, chess.Result{Reason: chess.Checkmate, WinnerColor: chess.White}, engine.GetResult())
+
+	assert.Equal(t, operaGame, game.String())
+}
+
+func TestParseAnnotations(t *testing.T) {
+	text := `[Event "?"]
+[Result "*"]
+
+{Opening} 1. e4! {best by test} e5 $2 (1... c5 {Sicilian} 2. Nf3 (2. c3) d6) (1... e6?!)
+; french is fine too
+2. Nf3 *`
+	game, err := ParseGame(text)
+	assert.Nil(t, err)
+	assert.Len(t, game.Moves, 3)
+
+	e4 := game.Moves[0]
+	assert.Equal(t, "Opening", e4.CommentBefore)
+	assert.Equal(t, []int{1}, e4.NAGs)
+	assert.Equal(t, "best by test", e4.Comment)
+
+	e5 := game.Moves[1]
+	assert.Equal(t, []int{2}, e5.NAGs)
+	assert.Equal(t, "french is fine too", e5.Comment)
+	assert.Len(t, e5.Variations, 2)
+	assert.Equal(t, "c5", e5.Variations[0][0].SAN)
+	assert.Equal(t, "Sicilian", e5.Variations[0][0].Comment)
+	assert.Equal(t, "c3", e5.Variations[0][1].Variations[0][0].SAN)
+	assert.Equal(t, []int{6}, e5.Variations[1][0].NAGs)
+
+	written := game.String()
+	assert.Contains(t, strings.ReplaceAll(written, "\n", " "), "{Opening} 1. e4 $1 {best by test} 1... e5 $2 {french is fine too} (1... c5 {Sicilian} 2. Nf3 (2. c3) 2... d6) (1... e6 $6) 2. Nf3 *")
+
+	reparsed, err := ParseGame(written)
+	assert.Nil(t, err)
+	assert.Equal(t, written, reparsed.String())
+}
+
+func TestParseMultipleGames(t *testing.T) {
+	text := `[Event "First"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/8/R3K3 b Q - 0 30"]
+
+30... Kd7 31. O-O-O+ 1/2-1/2
+`
+	games, err := Parse(strings.NewReader(text))
+	assert.Nil(t, err)
+	assert.Len(t, games, 2)
+	assert.Equal(t, BlackWins, games[0].Result)
+	assert.Equal(t, DrawResult, games[1].Result)
+	assert.Equal(t, "O-O-O+", games[1].Moves[1].SAN)
+	assert.Contains(t, games[1].String(), "30... Kd7 31. O-O-O+ 1/2-1/2")
+}
+
+func TestParseInvalidPGN(t *testing.T) {
+	texts := map[string]string{
+		"illegal move":         "1. e4 e4 *",
+		"unclosed comment":     "1. e4 {comment",
+		"unclosed variation":   "1. e4 (1. d4 *",
+		"unexpected variation": "1. e4 ) *",
+		"invalid tag":          "[Event]\n1. e4 *",
+		"leading annotation":   "$1 1. e4 *",
+	}
+	for name, text := range texts {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseGame(text)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewGame(t *testing.T) {
+	moves := []chess.Move{
+		{From: chess.Location{Row: 1, Col: 5}, To: chess.Location{Row: 2, Col: 5}},
+		{From: chess.Location{Row: 6, Col: 4}, To: chess.Location{Row: 4, Col: 4}},
+		{From: chess.Location{Row: 1, Col: 6}, To: chess.Location{Row: 3, Col: 6}},
+		{From: chess.Location{Row: 7, Col: 3}, To: chess.Location{Row: 3, Col: 7}},
+	}
+	game, err := NewGame("", moves, chess.Result{Reason: chess.Checkmate, WinnerColor: chess.Black})
+	assert.Nil(t, err)
+	game.Tags["White"] = `Fool "the" Player`
+
+	expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "Fool \"the\" Player"]
+[Black "?"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+`
+	assert.Equal(t, expected, game.String())
+
+	_, err = NewGame("", moves[1:], chess.NoResult)
+	assert.ErrorIs(t, err, chess.ErrInvalidPieceMove)
+}
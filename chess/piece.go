@@ -1,6 +1,9 @@
 package chess
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type Location struct {
 	Row int `json:"row"`
@@ -23,6 +26,23 @@ func (loc *Location) Equals(loc2 Location) bool {
 	return loc.Row == loc2.Row && loc.Col == loc2.Col
 }
 
+// Return the algebraic name of the square, e.g. "e4"
+func (loc Location) Square() string {
+	return string([]byte{byte('a' + loc.Col), byte('1' + loc.Row)})
+}
+
+// Parse an algebraic square name like "e4"
+func ParseSquare(square string) (Location, error) {
+	if len(square) != 2 {
+		return Location{}, fmt.Errorf("invalid square %q", square)
+	}
+	loc := Location{Row: int(square[1]) - '1', Col: int(square[0]) - 'a'}
+	if err := loc.Validate(); err != nil {
+		return Location{}, fmt.Errorf("invalid square %q", square)
+	}
+	return loc, nil
+}
+
 type PieceType int
 
 const (
@@ -53,6 +73,21 @@ func (p PieceType) GetName() string {
 	}
 }
 
+// Parse a piece name as returned by GetName
+func ParsePieceType(name string) (PieceType, error) {
+	for _, p := range []PieceType{King, Rook, Bishop, Queen, Knight, Pawn} {
+		if strings.EqualFold(p.GetName(), name) {
+			return p, nil
+		}
+	}
+	return King, fmt.Errorf("invalid piece type %q", name)
+}
+
+// Check if a pawn is allowed to be promoted to this piece type
+func (p PieceType) IsPromotable() bool {
+	return p == Knight || p == Bishop || p == Rook || p == Queen
+}
+
 type Color int
 
 func (c Color) String() string {
@@ -84,6 +119,14 @@ func (color Color) OppositeColor() Color {
 	}
 }
 
+// Return the row where pawns of this color get promoted
+func (color Color) LastRow() int {
+	if color == Black {
+		return 0
+	}
+	return 7
+}
+
 type Piece struct {
 	Type     PieceType
 	Color    Color
@@ -9,8 +9,14 @@ type RollBackMovement struct {
 	castled       bool
 	rolledBack    bool
 	promoted      bool
-
-	castleRightsBackup map[Color]castling
+	enPassant     bool
+
+	castleRightsBackup   map[Color]castling
+	enPassantBackup      *Location
+	halfMoveClockBackup  int
+	fullMoveNumberBackup int
+	pieceType            PieceType // Type of the moved piece before any promotion
+	pieceColor           Color
 }
 
 func NewRollBack(game *ChessEngine) *RollBackMovement {
@@ -20,21 +26,20 @@ func NewRollBack(game *ChessEngine) *RollBackMovement {
 			White: game.castleRights[White],
 			Black: game.castleRights[Black],
 		},
+		enPassantBackup:      game.enPassant,
+		halfMoveClockBackup:  game.halfMoveClock,
+		fullMoveNumberBackup: game.fullMoveNumber,
 	}
 }
 
 func (r *RollBackMovement) CheckPromotion(move Move) {
 	piece := r.game.board[move.From.Row][move.From.Col]
-	if piece.Type == Pawn {
-		if piece.Color == Black && move.To.Row == 0 {
-			piece.Type = Queen
-			r.promoted = true
-		} else if move.To.Row == 7 {
-			piece.Type = Queen
-			r.promoted = true
-		}
+	if piece.Type == Pawn && move.To.Row == piece.Color.LastRow() && move.Promotion.IsPromotable() {
+		piece.Type = move.Promotion
+		r.promoted = true
 	}
 }
+
 func (r *RollBackMovement) isCastling() bool {
 	if (r.game.board[r.move.From.Row][r.move.From.Col].Type == King) && (math.Abs(float64(r.move.From.Col)-float64(r.move.To.Col)) == 2) {
 		return true
@@ -78,24 +83,66 @@ func (r *RollBackMovement) doCastling() {
 	}
 }
 
+// Check if the move is a pawn capturing diagonally onto the en passant square
+func (r *RollBackMovement) isEnPassant() bool {
+	piece := r.game.board[r.move.From.Row][r.move.From.Col]
+	return piece.Type == Pawn && r.move.From.Col != r.move.To.Col && r.game.isEnPassantTarget(r.move.To)
+}
+
+// A rook leaving or being captured on its starting corner loses its castling right
+func (r *RollBackMovement) revokeRookCastling(loc Location) {
+	for _, color := range []Color{White, Black} {
+		backRow := 0
+		if color == Black {
+			backRow = 7
+		}
+		if loc.Row != backRow {
+			continue
+		}
+		rights := r.game.castleRights[color]
+		if loc.Col == 0 {
+			rights.left = false
+		} else if loc.Col == 7 {
+			rights.right = false
+		}
+		r.game.castleRights[color] = rights
+	}
+}
+
 func (r *RollBackMovement) Do(move Move) {
 	r.move = move
 
 	piece := r.game.board[move.From.Row][move.From.Col]
-	if piece != nil && piece.Type == King {
+	r.pieceType, r.pieceColor = piece.Type, piece.Color
+	if piece.Type == King {
 		r.game.castleRights[piece.Color] = castling{left: false, right: false}
 	}
 	if r.isCastling() {
+		r.game.enPassant = nil
 		r.doCastling()
 		r.castled = true
 		return
 	}
 
-	if r.game.board[move.To.Row][move.To.Col] != nil {
+	if r.isEnPassant() {
+		// The captured pawn stands beside the moving pawn, not on the destination square
+		r.capturedPiece = r.game.board[move.From.Row][move.To.Col]
+		r.capturedPiece.Captured = true
+		r.game.board[move.From.Row][move.To.Col] = nil
+		r.enPassant = true
+	} else if r.game.board[move.To.Row][move.To.Col] != nil {
 		r.capturedPiece = r.game.board[move.To.Row][move.To.Col]
 		r.capturedPiece.Captured = true
 	}
 
+	r.revokeRookCastling(move.From)
+	r.revokeRookCastling(move.To)
+
+	r.game.enPassant = nil
+	if piece.Type == Pawn && math.Abs(float64(move.To.Row)-float64(move.From.Row)) == 2 {
+		r.game.enPassant = &Location{Row: (move.From.Row + move.To.Row) / 2, Col: move.From.Col}
+	}
+
 	r.CheckPromotion(move)
 
 	r.game.board[move.To.Row][move.To.Col] = r.game.board[move.From.Row][move.From.Col]
@@ -109,9 +156,11 @@ func (r *RollBackMovement) rollBackCastle() {
 
 	r.game.board[r.move.To.Row][4] = r.game.board[r.move.To.Row][r.move.To.Col]
 	r.game.board[r.move.To.Row][r.move.To.Col] = nil
+	r.game.board[r.move.To.Row][4].Location.Col = 4
 	if r.move.To.Col == 2 {
 		r.game.board[r.move.To.Row][0] = r.game.board[r.move.From.Row][3]
 		r.game.board[r.move.To.Row][3] = nil
+		r.game.board[r.move.To.Row][0].Location.Col = 0
 		r.game.castleRights[color] = castling{
 			left:  true,
 			right: r.game.castleRights[color].right,
@@ -119,6 +168,7 @@ func (r *RollBackMovement) rollBackCastle() {
 	} else {
 		r.game.board[r.move.To.Row][7] = r.game.board[r.move.To.Row][5]
 		r.game.board[r.move.To.Row][5] = nil
+		r.game.board[r.move.To.Row][7].Location.Col = 7
 		r.game.castleRights[color] = castling{
 			left:  r.game.castleRights[color].left,
 			right: true,
@@ -132,6 +182,7 @@ func (r *RollBackMovement) RollBack() {
 	}
 
 	r.game.castleRights = r.castleRightsBackup
+	r.game.enPassant = r.enPassantBackup
 	if r.castled {
 		r.rollBackCastle()
 		r.rolledBack = true
@@ -142,7 +193,12 @@ func (r *RollBackMovement) RollBack() {
 	}
 
 	r.game.board[r.move.From.Row][r.move.From.Col] = r.game.board[r.move.To.Row][r.move.To.Col]
-	r.game.board[r.move.To.Row][r.move.To.Col] = r.capturedPiece
+	if r.enPassant {
+		r.game.board[r.move.To.Row][r.move.To.Col] = nil
+		r.game.board[r.move.From.Row][r.move.To.Col] = r.capturedPiece
+	} else {
+		r.game.board[r.move.To.Row][r.move.To.Col] = r.capturedPiece
+	}
 	r.game.board[r.move.From.Row][r.move.From.Col].Location.Col = r.move.From.Col
 	r.game.board[r.move.From.Row][r.move.From.Col].Location.Row = r.move.From.Row
 
@@ -0,0 +1,170 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidSAN = errors.New("invalid SAN move")
+
+var sanPattern = regexp.MustCompile(`^([NBRQK])?([a-h])?([1-8])?(x)?([a-h][1-8])(=?([NBRQ]))?$`)
+
+// Return the piece letter used in algebraic notation, empty for pawns
+func (p PieceType) SANLetter() string {
+	if p == Pawn {
+		return ""
+	}
+	return string(unicode.ToUpper(fenPieceLetters[p]))
+}
+
+func parseSANLetter(letter string) PieceType {
+	for pieceType, l := range fenPieceLetters {
+		if strings.EqualFold(string(l), letter) {
+			return pieceType
+		}
+	}
+	return Pawn
+}
+
+// Check if the move is one of the legal moves of the side to move
+func (g *ChessEngine) isLegalMove(move Move) bool {
+	for _, m := range g.legalMoves() {
+		if m == move {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode a legal move of the side to move in Standard Algebraic Notation
+func (g *ChessEngine) SAN(move Move) (string, error) {
+	if g.finished {
+		return "", ErrGameEnd
+	}
+	if !g.isLegalMove(move) {
+		return "", ErrInvalidPieceMove
+	}
+
+	piece := g.board[move.From.Row][move.From.Col]
+	san := ""
+	if piece.Type == King && move.To.Col-move.From.Col == 2 {
+		san = "O-O"
+	} else if piece.Type == King && move.From.Col-move.To.Col == 2 {
+		san = "O-O-O"
+	} else {
+		capture := g.board[move.To.Row][move.To.Col] != nil ||
+			(piece.Type == Pawn && move.From.Col != move.To.Col)
+
+		san = piece.Type.SANLetter()
+		if piece.Type == Pawn {
+			if capture {
+				san += move.From.Square()[:1]
+			}
+		} else {
+			san += g.disambiguate(piece, move.To)
+		}
+		if capture {
+			san += "x"
+		}
+		san += move.To.Square()
+		if move.Promotion != King {
+			san += "=" + move.Promotion.SANLetter()
+		}
+	}
+
+	next := g.Clone()
+	if err := next.Play(g.turn, move); err != nil {
+		return "", err
+	}
+	if next.GetResult().Reason == Checkmate {
+		san += "#"
+	} else if next.isChecked(next.turn) {
+		san += "+"
+	}
+	return san, nil
+}
+
+// Return the file and/or rank needed to tell the piece apart from
+// other pieces of the same type that can also reach the destination
+func (g *ChessEngine) disambiguate(piece *Piece, to Location) string {
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range g.pieces[piece.Color] {
+		if other == piece || other.Captured || other.Type != piece.Type || !g.IsInPossibleMoves(other, to) {
+			continue
+		}
+		ambiguous = true
+		if other.Location.Col == piece.Location.Col {
+			sameFile = true
+		}
+		if other.Location.Row == piece.Location.Row {
+			sameRank = true
+		}
+	}
+
+	square := piece.Location.Square()
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return square[:1]
+	case !sameRank:
+		return square[1:]
+	default:
+		return square
+	}
+}
+
+// Decode a move of the side to move written in Standard Algebraic Notation.
+// Check, mate and annotation suffixes are accepted and ignored.
+func (g *ChessEngine) ParseSAN(san string) (Move, error) {
+	text := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+
+	if text == "O-O" || text == "0-0" || text == "O-O-O" || text == "0-0-0" {
+		king := g.kings[g.turn]
+		to := Location{Row: king.Location.Row, Col: king.Location.Col + 2}
+		if len(text) == 5 {
+			to.Col = king.Location.Col - 2
+		}
+		move := Move{From: king.Location, To: to}
+		if !g.isLegalMove(move) {
+			return Move{}, fmt.Errorf("%w: %q is not legal", ErrInvalidSAN, san)
+		}
+		return move, nil
+	}
+
+	matches := sanPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return Move{}, fmt.Errorf("%w: %q", ErrInvalidSAN, san)
+	}
+	pieceType := parseSANLetter(matches[1])
+	to, _ := ParseSquare(matches[5])
+	promotion := King
+	if matches[7] != "" {
+		promotion = parseSANLetter(matches[7])
+	}
+
+	found := []Move{}
+	for _, move := range g.legalMoves() {
+		piece := g.board[move.From.Row][move.From.Col]
+		from := move.From.Square()
+		if piece.Type != pieceType || move.To != to || move.Promotion != promotion {
+			continue
+		}
+		if (matches[2] != "" && matches[2] != from[:1]) || (matches[3] != "" && matches[3] != from[1:]) {
+			continue
+		}
+		found = append(found, move)
+	}
+
+	switch len(found) {
+	case 0:
+		return Move{}, fmt.Errorf("%w: %q is not legal", ErrInvalidSAN, san)
+	case 1:
+		return found[0], nil
+	default:
+		return Move{}, fmt.Errorf("%w: %q is ambiguous", ErrInvalidSAN, san)
+	}
+}
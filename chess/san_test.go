@@ -0,0 +1,82 @@
+package chess
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSAN(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		move Move
+		san  string
+	}{
+		{"pawn push", StartingFEN, Move{From: Location{Row: 1, Col: 4}, To: Location{Row: 3, Col: 4}}, "e4"},
+		{"knight", StartingFEN, Move{From: Location{Row: 0, Col: 6}, To: Location{Row: 2, Col: 5}}, "Nf3"},
+		{"pawn capture", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", Move{From: Location{Row: 3, Col: 4}, To: Location{Row: 4, Col: 3}}, "exd5"},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", Move{From: Location{Row: 4, Col: 4}, To: Location{Row: 5, Col: 3}}, "exd6"},
+		{"king side castling", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", Move{From: Location{Row: 0, Col: 4}, To: Location{Row: 0, Col: 6}}, "O-O"},
+		{"queen side castling", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", Move{From: Location{Row: 7, Col: 4}, To: Location{Row: 7, Col: 2}}, "O-O-O"},
+		{"file disambiguation", "7k/8/8/8/8/8/8/R4R1K w - - 0 1", Move{From: Location{Row: 0, Col: 0}, To: Location{Row: 0, Col: 3}}, "Rad1"},
+		{"rank disambiguation", "4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", Move{From: Location{Row: 4, Col: 0}, To: Location{Row: 2, Col: 0}}, "R5a3"},
+		{"square disambiguation", "k7/8/8/8/8/2Q1Q3/8/4Q2K w - - 0 1", Move{From: Location{Row: 2, Col: 4}, To: Location{Row: 1, Col: 3}}, "Qe3d2"},
+		{"promotion", "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", Move{From: Location{Row: 6, Col: 4}, To: Location{Row: 7, Col: 4}, Promotion: Knight}, "e8=N"},
+		{"capture promotion with check", "k2r4/4P3/8/8/8/8/8/4K3 w - - 0 1", Move{From: Location{Row: 6, Col: 4}, To: Location{Row: 7, Col: 3}, Promotion: Queen}, "exd8=Q+"},
+		{"checkmate", "6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", Move{From: Location{Row: 0, Col: 0}, To: Location{Row: 7, Col: 0}}, "Ra8#"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, err := ParseFEN(test.fen)
+			assert.Nil(t, err)
+
+			san, err := game.SAN(test.move)
+			assert.Nil(t, err)
+			assert.Equal(t, test.san, san)
+
+			move, err := game.ParseSAN(test.san)
+			assert.Nil(t, err)
+			assert.Equal(t, test.move, move)
+		})
+	}
+}
+
+func TestParseInvalidSAN(t *testing.T) {
+	game := NewEngine()
+	for _, san := range []string{"", "e5", "Ke2", "O-O", "Nd2", "Zf3", "e9", "exd5"} {
+		_, err := game.ParseSAN(san)
+		assert.ErrorIs(t, err, ErrInvalidSAN, san)
+	}
+
+	game, err := ParseFEN("7k/8/8/8/8/8/8/R4R1K w - - 0 1")
+	assert.Nil(t, err)
+	_, err = game.ParseSAN("Rd1")
+	assert.ErrorIs(t, err, ErrInvalidSAN)
+}
+
+func TestSANIllegalMove(t *testing.T) {
+	_, err := NewEngine().SAN(Move{From: Location{Row: 1, Col: 4}, To: Location{Row: 4, Col: 4}})
+	assert.ErrorIs(t, err, ErrInvalidPieceMove)
+}
+
+func TestUCI(t *testing.T) {
+	moves := map[string]Move{
+		"e2e4":  {From: Location{Row: 1, Col: 4}, To: Location{Row: 3, Col: 4}},
+		"e1g1":  {From: Location{Row: 0, Col: 4}, To: Location{Row: 0, Col: 6}},
+		"a7a8q": {From: Location{Row: 6, Col: 0}, To: Location{Row: 7, Col: 0}, Promotion: Queen},
+		"h2h1n": {From: Location{Row: 1, Col: 7}, To: Location{Row: 0, Col: 7}, Promotion: Knight},
+	}
+	for uci, move := range moves {
+		assert.Equal(t, uci, move.UCI())
+
+		parsed, err := ParseUCI(uci)
+		assert.Nil(t, err)
+		assert.Equal(t, move, parsed)
+	}
+
+	for _, uci := range []string{"", "e2", "e2e9", "i2e4", "a7a8k", "a7a8qq"} {
+		_, err := ParseUCI(uci)
+		assert.ErrorIs(t, err, ErrInvalidUCI, uci)
+	}
+}
@@ -0,0 +1,463 @@
+package chess
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+var ErrInvalidLevel = errors.New("invalid computer level")
+
+// Scores at or beyond this bound mean a forced mate. The distance to the
+// mate in plies is subtracted so shorter mates score higher.
+const MateScore = 100000
+
+const (
+	infinity     = MateScore + 1
+	maxPly       = 64
+	ttSize       = 1 << 16
+	mateBoundary = MateScore - maxPly
+)
+
+// Deepest iteration Search goes to
+const MaxSearchDepth = maxPly - 1
+
+// Strength of the computer opponent, from MinLevel to MaxLevel
+type Level int
+
+const (
+	MinLevel Level = 1
+	MaxLevel Level = 5
+)
+
+var levelSettings = map[Level]struct {
+	depth    int
+	moveTime time.Duration
+	noise    int // Random centipawns added to evaluations, makes weak levels blunder
+}{
+	1: {depth: 1, moveTime: 100 * time.Millisecond, noise: 150},
+	2: {depth: 2, moveTime: 250 * time.Millisecond, noise: 75},
+	3: {depth: 3, moveTime: 500 * time.Millisecond, noise: 25},
+	4: {depth: 5, moveTime: time.Second, noise: 0},
+	5: {depth: maxPly, moveTime: 3 * time.Second, noise: 0},
+}
+
+// Random keys hashing a position, xored together for each feature
+var (
+	zobristPieces    [2][6][64]uint64
+	zobristBlack     uint64
+	zobristCastling  [16]uint64
+	zobristEnPassant [8]uint64
+)
+
+func init() {
+	r := rand.New(rand.NewSource(1))
+	for color := range zobristPieces {
+		for piece := range zobristPieces[color] {
+			for sq := range zobristPieces[color][piece] {
+				zobristPieces[color][piece][sq] = r.Uint64()
+			}
+		}
+	}
+	zobristBlack = r.Uint64()
+	for i := range zobristCastling {
+		zobristCastling[i] = r.Uint64()
+	}
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = r.Uint64()
+	}
+}
+
+func (p *position) hash() uint64 {
+	var h uint64
+	for color := range p.pieces {
+		for piece := range p.pieces[color] {
+			for b := p.pieces[color][piece]; b != 0; {
+				h ^= zobristPieces[color][piece][popSquare(&b)]
+			}
+		}
+	}
+	if p.turn == Black {
+		h ^= zobristBlack
+	}
+	h ^= zobristCastling[p.castling]
+	if p.enPassant >= 0 {
+		h ^= zobristEnPassant[p.enPassant%8]
+	}
+	return h
+}
+
+// Return the type of the piece captured by the move, King if it's not a capture
+func (p *position) captured(m bitMove) PieceType {
+	them := p.turn.OppositeColor()
+	if p.occupied[them]&squareBit(int(m.to)) == 0 {
+		if m.piece == Pawn && int(m.to) == p.enPassant {
+			return Pawn
+		}
+		return King
+	}
+	for piece := range p.pieces[them] {
+		if p.pieces[them][piece]&squareBit(int(m.to)) != 0 {
+			return PieceType(piece)
+		}
+	}
+	return King
+}
+
+type ttFlag uint8
+
+const (
+	ttExact ttFlag = iota
+	ttLower        // The score is at least the stored one, the search failed high
+	ttUpper        // The score is at most the stored one, the search failed low
+)
+
+type ttEntry struct {
+	key   uint64
+	move  bitMove
+	score int
+	depth int
+	flag  ttFlag
+}
+
+type SearchResult struct {
+	Move  Move
+	Score int    // Centipawns from the point of view of the side to move
+	Depth int    // Depth of the last completed iteration
+	Nodes int    // Positions visited
+	PV    []Move // Expected line of play starting with Move
+}
+
+// Return the number of moves until mate, negative when the side to move is
+// getting mated, or 0 if the score isn't a mate
+func (r SearchResult) MateIn() int {
+	if r.Score >= mateBoundary {
+		return (MateScore - r.Score + 1) / 2
+	}
+	if r.Score <= -mateBoundary {
+		return -(MateScore + r.Score + 1) / 2
+	}
+	return 0
+}
+
+// Mate scores depend on the distance from the root, so they're stored in
+// the table relative to the node and converted back when read
+func scoreToTT(score, ply int) int {
+	if score >= mateBoundary {
+		return score + ply
+	} else if score <= -mateBoundary {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score, ply int) int {
+	if score >= mateBoundary {
+		return score - ply
+	} else if score <= -mateBoundary {
+		return score + ply
+	}
+	return score
+}
+
+type searcher struct {
+	ctx      context.Context
+	rootMove bitMove
+	tt       []ttEntry
+	killers  [maxPly][2]bitMove
+	moves    [maxPly + 1][]bitMove
+	path     []uint64 // Hashes of the positions played and searched, for repetitions
+	nodes    int
+	noise    int
+	stopped  bool
+}
+
+func newSearcher(ctx context.Context) *searcher {
+	s := &searcher{
+		ctx:  ctx,
+		tt:   make([]ttEntry, ttSize),
+		path: make([]uint64, 0, maxPly),
+	}
+	for i := range s.moves {
+		s.moves[i] = make([]bitMove, 0, 64)
+	}
+	return s
+}
+
+// Check if the search has to stop. Checking the context is slow, so it's
+// done once every few thousand nodes.
+func (s *searcher) shouldStop() bool {
+	if !s.stopped && s.nodes&2047 == 0 && s.ctx.Err() != nil {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *searcher) evaluate(p *position) int {
+	score := p.evaluate()
+	if s.noise > 0 {
+		score += rand.Intn(2*s.noise+1) - s.noise
+	}
+	return score
+}
+
+// Sort the moves so the most promising ones are searched first: the best move
+// found earlier, then captures of valuable pieces by cheap ones, then killers
+func (s *searcher) orderMoves(p *position, moves []bitMove, best bitMove, ply int) {
+	scores := make([]int, len(moves))
+	for i, m := range moves {
+		switch {
+		case m == best:
+			scores[i] = 1 << 20
+		case m.promotion != King:
+			scores[i] = 1<<16 + pieceValues[m.promotion]
+		case p.captured(m) != King:
+			scores[i] = 1<<15 + 10*pieceValues[p.captured(m)] - pieceValues[m.piece]
+		case m == s.killers[ply][0] || m == s.killers[ply][1]:
+			scores[i] = 1 << 14
+		}
+	}
+	for i := 1; i < len(moves); i++ {
+		for j := i; j > 0 && scores[j] > scores[j-1]; j-- {
+			scores[j], scores[j-1] = scores[j-1], scores[j]
+			moves[j], moves[j-1] = moves[j-1], moves[j]
+		}
+	}
+}
+
+// Search only captures and promotions until the position is quiet, so the
+// evaluation isn't taken in the middle of an exchange
+func (s *searcher) quiesce(p *position, ply, alpha, beta int) int {
+	s.nodes++
+	if s.shouldStop() {
+		return 0
+	}
+
+	standPat := s.evaluate(p)
+	if standPat >= beta || ply >= maxPly {
+		return standPat
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+
+	moves := p.legalMoves(s.moves[ply][:0])
+	tactical := moves[:0]
+	for _, m := range moves {
+		if m.promotion != King || p.captured(m) != King {
+			tactical = append(tactical, m)
+		}
+	}
+	s.orderMoves(p, tactical, bitMove{}, ply)
+
+	for _, m := range tactical {
+		next := p.play(m)
+		score := -s.quiesce(&next, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+func (s *searcher) negamax(p *position, depth, ply, alpha, beta int) int {
+	s.nodes++
+	if s.shouldStop() {
+		return 0
+	}
+
+	hash := p.hash()
+	if ply > 0 {
+		for _, h := range s.path {
+			if h == hash {
+				return 0
+			}
+		}
+	}
+
+	inCheck := p.inCheck(p.turn)
+	if inCheck {
+		depth++
+	}
+	if depth <= 0 || ply >= maxPly {
+		return s.quiesce(p, ply, alpha, beta)
+	}
+
+	entry := &s.tt[hash%ttSize]
+	best := bitMove{}
+	if entry.key == hash {
+		best = entry.move
+		if ply > 0 && entry.depth >= depth {
+			score := scoreFromTT(entry.score, ply)
+			switch {
+			case entry.flag == ttExact,
+				entry.flag == ttLower && score >= beta,
+				entry.flag == ttUpper && score <= alpha:
+				return score
+			}
+		}
+	}
+
+	moves := p.legalMoves(s.moves[ply][:0])
+	if len(moves) == 0 {
+		if inCheck {
+			return -MateScore + ply
+		}
+		return 0
+	}
+	s.orderMoves(p, moves, best, ply)
+
+	s.path = append(s.path, hash)
+	defer func() { s.path = s.path[:len(s.path)-1] }()
+
+	bestScore := -infinity
+	flag := ttUpper
+	for _, m := range moves {
+		next := p.play(m)
+		score := -s.negamax(&next, depth-1, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score > bestScore {
+			bestScore, best = score, m
+		}
+		if score > alpha {
+			alpha = score
+			flag = ttExact
+		}
+		if alpha >= beta {
+			flag = ttLower
+			if p.captured(m) == King && m != s.killers[ply][0] {
+				s.killers[ply][1], s.killers[ply][0] = s.killers[ply][0], m
+			}
+			break
+		}
+	}
+
+	*entry = ttEntry{key: hash, move: best, score: scoreToTT(bestScore, ply), depth: depth, flag: flag}
+	if ply == 0 {
+		s.rootMove = best
+	}
+	return bestScore
+}
+
+// Follow the best moves stored in the transposition table from the root
+func (s *searcher) principalVariation(p position, depth int) []Move {
+	pv := []Move{}
+	seen := map[uint64]bool{}
+	for len(pv) < depth {
+		hash := p.hash()
+		entry := s.tt[hash%ttSize]
+		if entry.key != hash || seen[hash] {
+			break
+		}
+		seen[hash] = true
+
+		legal := false
+		for _, m := range p.legalMoves(nil) {
+			if m == entry.move {
+				legal = true
+				break
+			}
+		}
+		if !legal {
+			break
+		}
+		pv = append(pv, entry.move.toMove())
+		p = p.play(entry.move)
+	}
+	return pv
+}
+
+// Return the hashes of the positions played before the current one. Going
+// back to one of them is scored as a draw, so a winning side doesn't walk
+// into a repetition.
+func (g *ChessEngine) playedPositions() []uint64 {
+	current := g.positionKey()
+	hashes := []uint64{}
+	for key, count := range g.repetitions {
+		if count == 0 || key == current {
+			continue
+		}
+		// Keys are FEN without the move counters
+		played, err := ParseFEN(key + " 0 1")
+		if err != nil {
+			continue
+		}
+		p := played.position()
+		hashes = append(hashes, p.hash())
+	}
+	return hashes
+}
+
+// Search the best move of the side to move with iterative deepening up to
+// the given depth or until the context is done. The first iteration always
+// completes so there is a move to play.
+func (g *ChessEngine) Search(ctx context.Context, depth int) (SearchResult, error) {
+	return g.search(ctx, depth, 0, nil)
+}
+
+// Search like Search and call report with the result of every completed iteration
+func (g *ChessEngine) SearchWithProgress(ctx context.Context, depth int, report func(SearchResult)) (SearchResult, error) {
+	return g.search(ctx, depth, 0, report)
+}
+
+func (g *ChessEngine) search(ctx context.Context, depth, noise int, report func(SearchResult)) (SearchResult, error) {
+	if g.finished {
+		return SearchResult{}, ErrGameEnd
+	}
+	if depth > MaxSearchDepth {
+		depth = MaxSearchDepth
+	}
+
+	root := g.position()
+	result := SearchResult{}
+	s := newSearcher(context.Background())
+	s.noise = noise
+	s.path = append(s.path, g.playedPositions()...)
+	for d := 1; d <= depth; d++ {
+		score := s.negamax(&root, d, 0, -infinity, infinity)
+		if s.stopped {
+			break
+		}
+
+		result.Score = score
+		result.Depth = d
+		result.Move = s.rootMove.toMove()
+		result.PV = s.principalVariation(root, d)
+		result.Nodes = s.nodes
+		if report != nil {
+			report(result)
+		}
+		// Stop looking once a mate is found
+		if score >= mateBoundary || score <= -mateBoundary {
+			break
+		}
+		s.ctx = ctx
+	}
+	result.Nodes = s.nodes
+	return result, nil
+}
+
+// Return the move the computer plays at the given strength
+func (g *ChessEngine) BestMove(level Level) (Move, error) {
+	settings, ok := levelSettings[level]
+	if !ok {
+		return Move{}, ErrInvalidLevel
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.moveTime)
+	defer cancel()
+	result, err := g.search(ctx, settings.depth, settings.noise, nil)
+	if err != nil {
+		return Move{}, err
+	}
+	return result.Move, nil
+}
@@ -0,0 +1,94 @@
+package chess
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func searchFEN(t *testing.T, fen string, depth int) SearchResult {
+	t.Helper()
+	game, err := ParseFEN(fen)
+	assert.Nil(t, err)
+	result, err := game.Search(context.Background(), depth)
+	assert.Nil(t, err)
+	return result
+}
+
+func TestSearchMate(t *testing.T) {
+	// Back rank mate
+	result := searchFEN(t, "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 3)
+	assert.Equal(t, "a1a8", result.Move.UCI())
+	assert.Equal(t, 1, result.MateIn())
+
+	// Mate in two with a queen sacrifice
+	result = searchFEN(t, "r1b2k1r/ppp1bppp/8/1B1Q4/5q2/2P5/PPP2PPP/R3R1K1 w - - 1 1", 5)
+	assert.Equal(t, "d5d8", result.Move.UCI())
+	assert.Equal(t, 2, result.MateIn())
+	assert.Equal(t, "d5d8", result.PV[0].UCI())
+
+	// Getting mated whatever black plays
+	result = searchFEN(t, "k7/8/1K6/8/8/8/8/7R b - - 0 1", 4)
+	assert.Equal(t, "a8b8", result.Move.UCI())
+	assert.Equal(t, -1, result.MateIn())
+}
+
+func TestSearchWinsMaterial(t *testing.T) {
+	// The queen on d5 is hanging
+	result := searchFEN(t, "rnb1kbnr/pppp1ppp/8/3q4/4P3/8/PPP2PPP/RNBQKBNR w KQkq - 0 1", 3)
+	assert.Equal(t, "e4d5", result.Move.UCI())
+	assert.Greater(t, result.Score, 500)
+
+	// Taking the defended pawn loses the queen
+	result = searchFEN(t, "4k3/8/2p5/3p4/8/8/3Q4/4K3 w - - 0 1", 4)
+	assert.NotEqual(t, "d2d5", result.Move.UCI())
+}
+
+func TestSearchAvoidsRepetition(t *testing.T) {
+	game, err := ParseFEN("8/8/4k3/8/8/8/3R4/4K3 w - - 0 1")
+	assert.Nil(t, err)
+	result, err := game.Search(context.Background(), 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "e1e2", result.Move.UCI())
+
+	// A rook up, white doesn't go back to a position already played
+	playUCI(t, game, "e1e2", "e6f5", "e2e1", "f5e6")
+	result, err = game.Search(context.Background(), 4)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "e1e2", result.Move.UCI())
+	assert.Greater(t, result.Score, 300)
+}
+
+func TestSearchStalemate(t *testing.T) {
+	game, err := ParseFEN("k7/8/1Q6/8/8/8/8/7K b - - 0 1")
+	assert.Nil(t, err)
+	_, err = game.Search(context.Background(), 3)
+	assert.ErrorIs(t, err, ErrGameEnd)
+}
+
+func TestSearchTimeout(t *testing.T) {
+	game := NewEngine()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := game.Search(ctx, maxPly)
+	assert.Nil(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.GreaterOrEqual(t, result.Depth, 1)
+	assert.True(t, game.isLegalMove(result.Move))
+}
+
+func TestBestMove(t *testing.T) {
+	game := NewEngine()
+	for level := MinLevel; level <= MaxLevel; level++ {
+		move, err := game.BestMove(level)
+		assert.Nil(t, err)
+		assert.True(t, game.isLegalMove(move), level)
+	}
+
+	_, err := game.BestMove(MaxLevel + 1)
+	assert.ErrorIs(t, err, ErrInvalidLevel)
+}
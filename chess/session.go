@@ -4,44 +4,102 @@ import (
 	"time"
 )
 
+// Most network lag given back to a player on each move, so a slow
+// connection can't be used to think for free
+const MaxLagCompensation = time.Second
+
+// Changes of a player's clock after a ply, undone when it's taken back
+type clockRecord struct {
+	added         time.Duration // Bonus and time of a new stage
+	stageAdvanced bool
+}
+
 type chessSession struct {
 	*ChessEngine
+	timeControl    TimeControl
 	lastTimePlayed map[Color]time.Time
 	remainingTimes map[Color]time.Duration
-	tickers        map[Color]*time.Ticker
+	stages         map[Color]int // Index of the stage each player is in
+	stageMoves     map[Color]int // Moves played in the current stage
+	lags           map[Color]time.Duration
+	clockRecords   []clockRecord
 }
 
-func NewSession(duration time.Duration) *chessSession {
+func NewSession(tc TimeControl) *chessSession {
 	engine := NewEngine()
-	whiteTimer := time.NewTicker(10 * time.Minute)
-
 	session := &chessSession{
 		ChessEngine: engine,
+		timeControl: tc,
 		lastTimePlayed: map[Color]time.Time{
 			White: time.Now(),
 			Black: {},
 		},
 		remainingTimes: map[Color]time.Duration{
-			White: duration,
-			Black: duration,
-		},
-		tickers: map[Color]*time.Ticker{
-			White: whiteTimer,
-			Black: nil,
+			White: tc.Stages[0].Time,
+			Black: tc.Stages[0].Time,
 		},
+		stages:     map[Color]int{White: 0, Black: 0},
+		stageMoves: map[Color]int{White: 0, Black: 0},
+		lags:       map[Color]time.Duration{White: 0, Black: 0},
 	}
-
-	go session.timeoutTicker(whiteTimer, White)
 	return session
 }
 
-func (g *chessSession) timeoutTicker(ticker *time.Ticker, playerColor Color) {
-	<-ticker.C
-	g.finish(Timeout, playerColor.OppositeColor())
+// Return the result of the game. The game ends on time once the flag of
+// the side to move falls, which is checked here rather than by a timer so
+// the session is only ever used from its caller's goroutine.
+func (g *chessSession) GetResult() Result {
+	if !g.finished && time.Since(g.lastTimePlayed[g.turn]) >= g.timeLeft(g.turn) {
+		g.finish(Timeout, g.turn.OppositeColor())
+	}
+	return g.ChessEngine.GetResult()
+}
+
+// Return how long the player's clock can run on this move before the flag
+// falls, counting the delay when the clock waits for it and the time the
+// move takes to reach the server
+func (g *chessSession) timeLeft(playerColor Color) time.Duration {
+	left := g.remainingTimes[playerColor] + g.lags[playerColor]
+	if g.timeControl.Mode == SimpleDelay {
+		left += g.timeControl.Bonus
+	}
+	return left
+}
+
+// Return the time taken from the clock for a move that took elapsed
+func (g *chessSession) charge(elapsed time.Duration) time.Duration {
+	if g.timeControl.Mode == SimpleDelay {
+		return max(elapsed-g.timeControl.Bonus, 0)
+	}
+	return elapsed
+}
+
+// Give the player the bonus of the move and the time of the next stage if
+// the move ends the current one
+func (g *chessSession) addBonus(playerColor Color, elapsed time.Duration) clockRecord {
+	record := clockRecord{}
+	switch g.timeControl.Mode {
+	case Increment:
+		record.added = g.timeControl.Bonus
+	case BronsteinDelay:
+		record.added = min(elapsed, g.timeControl.Bonus)
+	}
+
+	g.stageMoves[playerColor]++
+	stage := g.timeControl.Stages[g.stages[playerColor]]
+	if stage.Moves > 0 && g.stageMoves[playerColor] == stage.Moves && g.stages[playerColor]+1 < len(g.timeControl.Stages) {
+		g.stages[playerColor]++
+		g.stageMoves[playerColor] = 0
+		record.added += g.timeControl.Stages[g.stages[playerColor]].Time
+		record.stageAdvanced = true
+	}
+
+	g.remainingTimes[playerColor] += record.added
+	return record
 }
 
 func (g *chessSession) Play(playerColor Color, m Move) error {
-	if g.finished {
+	if g.GetResult() != NoResult {
 		return ErrGameEnd
 	}
 
@@ -50,26 +108,65 @@ func (g *chessSession) Play(playerColor Color, m Move) error {
 		return err
 	}
 
-	elapsed := time.Since(g.lastTimePlayed[playerColor])
-	g.remainingTimes[playerColor] -= elapsed
+	elapsed := max(time.Since(g.lastTimePlayed[playerColor])-g.lags[playerColor], 0)
+	g.remainingTimes[playerColor] -= g.charge(elapsed)
+	g.clockRecords = append(g.clockRecords, g.addBonus(playerColor, elapsed))
 	g.lastTimePlayed[playerColor.OppositeColor()] = time.Now()
+	return nil
+}
 
-	g.tickers[playerColor].Stop()
-	if g.tickers[playerColor.OppositeColor()] != nil {
-		g.tickers[playerColor.OppositeColor()].Reset(g.remainingTimes[playerColor.OppositeColor()])
-	} else {
-		g.tickers[playerColor.OppositeColor()] = time.NewTicker(g.remainingTimes[playerColor.OppositeColor()])
-		go g.timeoutTicker(g.tickers[playerColor.OppositeColor()], playerColor.OppositeColor())
+// Take back the last ply and give the clock back to the side who played it,
+// without the bonus it got for the ply
+func (g *chessSession) Undo() error {
+	if g.GetResult() != NoResult {
+		return ErrGameEnd
+	}
+
+	turn := g.turn
+	if err := g.ChessEngine.Undo(); err != nil {
+		return err
 	}
 
+	g.remainingTimes[turn] -= g.charge(time.Since(g.lastTimePlayed[turn]))
+	g.lastTimePlayed[g.turn] = time.Now()
+
+	record := g.clockRecords[len(g.clockRecords)-1]
+	g.clockRecords = g.clockRecords[:len(g.clockRecords)-1]
+	g.remainingTimes[g.turn] -= record.added
+	if record.stageAdvanced {
+		g.stages[g.turn]--
+		g.stageMoves[g.turn] = g.timeControl.Stages[g.stages[g.turn]].Moves - 1
+	} else {
+		g.stageMoves[g.turn]--
+	}
 	return nil
 }
 
-func (g *chessSession) Exit() {
-	for _, ticker := range g.tickers {
-		if ticker != nil {
-			ticker.Stop()
-		}
+// Return the time the player has left, not counting the current move
+func (g *chessSession) RemainingTime(playerColor Color) time.Duration {
+	return g.remainingTimes[playerColor]
+}
+
+// Return the time on the player's clock right now, counting the move
+// being thought if it's the player's turn
+func (g *chessSession) Clock(playerColor Color) time.Duration {
+	left := g.remainingTimes[playerColor]
+	if playerColor == g.turn && !g.finished {
+		left -= g.charge(time.Since(g.lastTimePlayed[playerColor]))
 	}
+	return max(left, 0)
+}
+
+// Set the network lag of the player, which is given back to the clock
+// on each move up to MaxLagCompensation
+func (g *chessSession) SetLag(playerColor Color, lag time.Duration) {
+	g.lags[playerColor] = min(max(lag, 0), MaxLagCompensation)
+}
+
+func (g *chessSession) TimeControl() TimeControl {
+	return g.timeControl
+}
+
+func (g *chessSession) Exit() {
 	g.finished = true
 }
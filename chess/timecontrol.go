@@ -0,0 +1,118 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTimeControl = errors.New("invalid time control")
+
+// How the bonus of a time control is given on each move
+type ClockMode string
+
+const (
+	// The bonus is added after every move
+	Increment ClockMode = "increment"
+	// The time used on a move is given back after it, up to the bonus
+	BronsteinDelay ClockMode = "bronstein"
+	// The clock starts running only once the bonus has passed on each move
+	SimpleDelay ClockMode = "delay"
+)
+
+// Limits of the time controls players can choose
+const (
+	MinStageTime = 15 * time.Second
+	MaxStageTime = 3 * time.Hour
+	MaxBonus     = time.Minute
+	MaxStages    = 3
+	MaxStageMove = 100
+)
+
+// A period of the game. Moves is the number of moves to play in Time,
+// 0 in the last stage which lasts until the end of the game.
+type TimeStage struct {
+	Moves int
+	Time  time.Duration
+}
+
+type TimeControl struct {
+	Stages []TimeStage
+	Mode   ClockMode
+	Bonus  time.Duration // Increment or delay per move
+}
+
+// Return a time control without bonus, where each player has the given
+// time for the whole game
+func SuddenDeath(base time.Duration) TimeControl {
+	return TimeControl{Stages: []TimeStage{{Time: base}}, Mode: Increment}
+}
+
+// Return a time control with a single stage and a bonus of the given mode
+func NewTimeControl(base time.Duration, mode ClockMode, bonus time.Duration) TimeControl {
+	return TimeControl{Stages: []TimeStage{{Time: base}}, Mode: mode, Bonus: bonus}
+}
+
+func (tc TimeControl) Validate() error {
+	if len(tc.Stages) == 0 || len(tc.Stages) > MaxStages {
+		return fmt.Errorf("%w: between 1 and %d stages are allowed", ErrInvalidTimeControl, MaxStages)
+	}
+	for i, stage := range tc.Stages {
+		if stage.Time < MinStageTime || stage.Time > MaxStageTime {
+			return fmt.Errorf("%w: stage time must be between %s and %s", ErrInvalidTimeControl, MinStageTime, MaxStageTime)
+		}
+		last := i == len(tc.Stages)-1
+		if last && stage.Moves != 0 {
+			return fmt.Errorf("%w: the last stage lasts until the end of the game", ErrInvalidTimeControl)
+		}
+		if !last && (stage.Moves < 1 || stage.Moves > MaxStageMove) {
+			return fmt.Errorf("%w: a stage must have between 1 and %d moves", ErrInvalidTimeControl, MaxStageMove)
+		}
+	}
+	switch tc.Mode {
+	case Increment, BronsteinDelay, SimpleDelay:
+	default:
+		return fmt.Errorf("%w: unknown clock mode %q", ErrInvalidTimeControl, tc.Mode)
+	}
+	if tc.Bonus < 0 || tc.Bonus > MaxBonus {
+		return fmt.Errorf("%w: bonus must be at most %s", ErrInvalidTimeControl, MaxBonus)
+	}
+	return nil
+}
+
+// Return the time a player is expected to use in a game of 40 moves, which
+// decides if the game is bullet, blitz or rapid
+func (tc TimeControl) Estimated() time.Duration {
+	if len(tc.Stages) == 0 {
+		return 0
+	}
+	return tc.Stages[0].Time + 40*tc.Bonus
+}
+
+func formatMinutes(d time.Duration) string {
+	return strconv.FormatFloat(d.Minutes(), 'f', -1, 64)
+}
+
+// Format the time control as base minutes and bonus seconds, like 3+2 for
+// an increment, 3d2 for a simple delay or 3b2 for a Bronstein delay.
+// Stages with a number of moves come first, like 40/90:30+30.
+func (tc TimeControl) String() string {
+	stages := make([]string, len(tc.Stages))
+	for i, stage := range tc.Stages {
+		stages[i] = formatMinutes(stage.Time)
+		if stage.Moves > 0 {
+			stages[i] = fmt.Sprintf("%d/%s", stage.Moves, stages[i])
+		}
+	}
+
+	separator := "+"
+	switch tc.Mode {
+	case SimpleDelay:
+		separator = "d"
+	case BronsteinDelay:
+		separator = "b"
+	}
+	return fmt.Sprintf("%s%s%d", strings.Join(stages, ":"), separator, int(tc.Bonus.Seconds()))
+}
@@ -0,0 +1,150 @@
+package chess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var classical = TimeControl{
+	Stages: []TimeStage{{Moves: 40, Time: 90 * time.Minute}, {Time: 30 * time.Minute}},
+	Mode:   Increment,
+	Bonus:  30 * time.Second,
+}
+
+func TestTimeControlString(t *testing.T) {
+	assert.Equal(t, "5+0", SuddenDeath(5*time.Minute).String())
+	assert.Equal(t, "3+2", NewTimeControl(3*time.Minute, Increment, 2*time.Second).String())
+	assert.Equal(t, "15d10", NewTimeControl(15*time.Minute, SimpleDelay, 10*time.Second).String())
+	assert.Equal(t, "0.5b1", NewTimeControl(30*time.Second, BronsteinDelay, time.Second).String())
+	assert.Equal(t, "40/90:30+30", classical.String())
+}
+
+func TestTimeControlValidate(t *testing.T) {
+	assert.Nil(t, SuddenDeath(time.Minute).Validate())
+	assert.Nil(t, classical.Validate())
+
+	invalid := []TimeControl{
+		{},
+		SuddenDeath(0),
+		SuddenDeath(time.Second),
+		SuddenDeath(4 * time.Hour),
+		NewTimeControl(time.Minute, Increment, 2*time.Minute),
+		NewTimeControl(time.Minute, Increment, -time.Second),
+		NewTimeControl(time.Minute, "hourglass", time.Second),
+		{Stages: []TimeStage{{Moves: 40, Time: time.Hour}}, Mode: Increment},
+		{Stages: []TimeStage{{Time: time.Hour}, {Time: time.Hour}}, Mode: Increment},
+		{Stages: []TimeStage{{Moves: 40, Time: time.Hour}, {Moves: 20, Time: time.Hour}, {Moves: 20, Time: time.Hour}, {Time: time.Hour}}, Mode: Increment},
+	}
+	for _, tc := range invalid {
+		assert.ErrorIs(t, tc.Validate(), ErrInvalidTimeControl, tc.String())
+	}
+}
+
+func TestTimeControlEstimated(t *testing.T) {
+	assert.Equal(t, 3*time.Minute, SuddenDeath(3*time.Minute).Estimated())
+	assert.Equal(t, 3*time.Minute+80*time.Second, NewTimeControl(3*time.Minute, Increment, 2*time.Second).Estimated())
+	assert.Equal(t, 110*time.Minute, classical.Estimated())
+}
+
+// Moves in these tests are played at once, so a clock hardly changes
+// except for the bonus
+const clockTolerance = float64(100 * time.Millisecond)
+
+func TestSessionIncrement(t *testing.T) {
+	game := NewSession(NewTimeControl(time.Minute, Increment, 2*time.Second))
+	defer game.Exit()
+
+	playUCI(t, game, "e2e4", "e7e5")
+	assert.InDelta(t, float64(62*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+	assert.InDelta(t, float64(62*time.Second), float64(game.RemainingTime(Black)), clockTolerance)
+
+	assert.Nil(t, game.Undo())
+	assert.InDelta(t, float64(time.Minute), float64(game.RemainingTime(Black)), clockTolerance)
+	assert.InDelta(t, float64(62*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+}
+
+func TestSessionBronsteinDelay(t *testing.T) {
+	game := NewSession(NewTimeControl(time.Minute, BronsteinDelay, 2*time.Second))
+	defer game.Exit()
+
+	// The time used is given back, so the clock never goes above the base
+	time.Sleep(50 * time.Millisecond)
+	playUCI(t, game, "e2e4")
+	assert.InDelta(t, float64(time.Minute), float64(game.RemainingTime(White)), float64(5*time.Millisecond))
+}
+
+func TestSessionSimpleDelay(t *testing.T) {
+	game := NewSession(NewTimeControl(time.Minute, SimpleDelay, 2*time.Second))
+	defer game.Exit()
+
+	// Moves within the delay don't use the clock
+	time.Sleep(50 * time.Millisecond)
+	playUCI(t, game, "e2e4")
+	assert.Equal(t, time.Minute, game.RemainingTime(White))
+}
+
+func TestSessionStages(t *testing.T) {
+	game := NewSession(TimeControl{
+		Stages: []TimeStage{{Moves: 2, Time: time.Minute}, {Moves: 1, Time: 30 * time.Second}, {Time: 20 * time.Second}},
+		Mode:   Increment,
+	})
+	defer game.Exit()
+
+	playUCI(t, game, "e2e4", "e7e5")
+	assert.InDelta(t, float64(time.Minute), float64(game.RemainingTime(White)), clockTolerance)
+
+	playUCI(t, game, "g1f3", "b8c6")
+	assert.InDelta(t, float64(90*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+	assert.InDelta(t, float64(90*time.Second), float64(game.RemainingTime(Black)), clockTolerance)
+
+	playUCI(t, game, "f1c4")
+	assert.InDelta(t, float64(110*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+
+	// The last stage lasts until the end of the game
+	playUCI(t, game, "g8f6", "d2d3")
+	assert.InDelta(t, float64(110*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+
+	// Taking the moves back goes back to the earlier stages
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, game.Undo())
+	}
+	assert.InDelta(t, float64(90*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+	playUCI(t, game, "f1c4")
+	assert.InDelta(t, float64(110*time.Second), float64(game.RemainingTime(White)), clockTolerance)
+}
+
+func TestSessionClock(t *testing.T) {
+	game := NewSession(SuddenDeath(time.Minute))
+	defer game.Exit()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.InDelta(t, float64(time.Minute-50*time.Millisecond), float64(game.Clock(White)), float64(20*time.Millisecond))
+	assert.Equal(t, time.Minute, game.Clock(Black))
+
+	// Lag is given back up to MaxLagCompensation
+	game.SetLag(White, time.Hour)
+	playUCI(t, game, "e2e4")
+	assert.Equal(t, time.Minute, game.RemainingTime(White))
+
+	game.SetLag(Black, 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	playUCI(t, game, "e7e5")
+	assert.InDelta(t, float64(time.Minute-30*time.Millisecond), float64(game.RemainingTime(Black)), float64(20*time.Millisecond))
+}
+
+func TestSessionTimeout(t *testing.T) {
+	game := NewSession(SuddenDeath(time.Minute))
+	defer game.Exit()
+	playUCI(t, game, "e2e4")
+	assert.Equal(t, NoResult, game.GetResult())
+
+	// The flag of the side to move falls once its clock runs out
+	game.remainingTimes[Black] = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, Result{Reason: Timeout, WinnerColor: White}, game.GetResult())
+	move, err := ParseUCI("e7e5")
+	assert.Nil(t, err)
+	assert.ErrorIs(t, game.Play(Black, move), ErrGameEnd)
+}
@@ -0,0 +1,334 @@
+// Package uci talks to chess engines speaking the Universal Chess Interface
+// protocol over their standard input and output.
+package uci
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+)
+
+var (
+	ErrEngineClosed = errors.New("engine has exited")
+	ErrNoBestMove   = errors.New("engine didn't return a move")
+)
+
+// Time to wait for the engine to answer a command other than go
+const handshakeTimeout = 10 * time.Second
+
+// Limits of a search. Zero values are left out of the go command and
+// Infinite searches until the context is done.
+type GoParams struct {
+	Depth    int
+	Nodes    int
+	MoveTime time.Duration
+	WTime    time.Duration
+	BTime    time.Duration
+	WInc     time.Duration
+	BInc     time.Duration
+	Infinite bool
+}
+
+func (p GoParams) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("go")
+	add := func(name string, value int64) {
+		if value > 0 {
+			sb.WriteString(fmt.Sprintf(" %s %d", name, value))
+		}
+	}
+	add("wtime", p.WTime.Milliseconds())
+	add("btime", p.BTime.Milliseconds())
+	add("winc", p.WInc.Milliseconds())
+	add("binc", p.BInc.Milliseconds())
+	add("depth", int64(p.Depth))
+	add("nodes", int64(p.Nodes))
+	add("movetime", p.MoveTime.Milliseconds())
+	if p.Infinite {
+		sb.WriteString(" infinite")
+	}
+	return sb.String()
+}
+
+// Search information sent by the engine in an info line
+type Info struct {
+	Depth int
+	Nodes int
+	Score int // Centipawns from the point of view of the side to move
+	Mate  int // Moves until mate, negative when getting mated, 0 if no mate was found
+	PV    []chess.Move
+}
+
+type SearchResult struct {
+	BestMove chess.Move
+	Ponder   *chess.Move // Move the engine expects in reply, if it said
+	Info     Info        // The last info line before bestmove
+}
+
+type Engine struct {
+	Name   string
+	Author string
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string
+}
+
+// Start the engine binary and wait until it's ready to play
+func Start(path string, args ...string) (*Engine, error) {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan string),
+	}
+	go e.readLines(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	if err := e.send("uci"); err != nil {
+		e.Close()
+		return nil, err
+	}
+	err = e.readUntil(ctx, "uciok", func(line string) {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			e.Name = name
+		} else if author, ok := strings.CutPrefix(line, "id author "); ok {
+			e.Author = author
+		}
+	})
+	if err == nil {
+		err = e.waitReady(ctx)
+	}
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) readLines(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		e.lines <- strings.TrimSpace(scanner.Text())
+	}
+	close(e.lines)
+}
+
+func (e *Engine) send(command string) error {
+	if _, err := io.WriteString(e.stdin, command+"\n"); err != nil {
+		return fmt.Errorf("%w: %s", ErrEngineClosed, err)
+	}
+	return nil
+}
+
+// Read lines until one starts with the given token. Other lines are passed to
+// handle, which may be nil.
+func (e *Engine) readUntil(ctx context.Context, token string, handle func(line string)) error {
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return ErrEngineClosed
+			}
+			if line == token || strings.HasPrefix(line, token+" ") {
+				if handle != nil && line != token {
+					handle(line)
+				}
+				return nil
+			}
+			if handle != nil {
+				handle(line)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Engine) waitReady(ctx context.Context) error {
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	return e.readUntil(ctx, "readyok", nil)
+}
+
+func (e *Engine) SetOption(name, value string) error {
+	if err := e.send(fmt.Sprintf("setoption name %s value %s", name, value)); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	return e.waitReady(ctx)
+}
+
+// Tell the engine the next position is from another game
+func (e *Engine) NewGame() error {
+	if err := e.send("ucinewgame"); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	return e.waitReady(ctx)
+}
+
+// Set the position to search, given as a FEN and the moves played from it
+func (e *Engine) Position(fen string, moves []chess.Move) error {
+	sb := strings.Builder{}
+	if fen == chess.StartingFEN || fen == "" {
+		sb.WriteString("position startpos")
+	} else {
+		sb.WriteString("position fen " + fen)
+	}
+	if len(moves) > 0 {
+		sb.WriteString(" moves")
+		for _, move := range moves {
+			sb.WriteString(" " + move.UCI())
+		}
+	}
+	return e.send(sb.String())
+}
+
+// Search the current position and wait for the best move. When the context
+// is done the engine is told to stop and the move it found so far is returned.
+func (e *Engine) Go(ctx context.Context, params GoParams) (SearchResult, error) {
+	if err := e.send(params.String()); err != nil {
+		return SearchResult{}, err
+	}
+
+	info := Info{}
+	var bestMove string
+	handle := func(line string) {
+		if strings.HasPrefix(line, "bestmove ") {
+			bestMove = line
+		} else if strings.HasPrefix(line, "info ") {
+			parseInfo(line, &info)
+		}
+	}
+
+	err := e.readUntil(ctx, "bestmove", handle)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		if err := e.send("stop"); err != nil {
+			return SearchResult{}, err
+		}
+		stopCtx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		defer cancel()
+		err = e.readUntil(stopCtx, "bestmove", handle)
+	}
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return parseBestMove(bestMove, info)
+}
+
+func parseBestMove(line string, info Info) (SearchResult, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[1] == "(none)" || fields[1] == "0000" {
+		return SearchResult{}, ErrNoBestMove
+	}
+	move, err := chess.ParseUCI(fields[1])
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("%w: %s", ErrNoBestMove, err)
+	}
+
+	result := SearchResult{BestMove: move, Info: info}
+	if len(fields) >= 4 && fields[2] == "ponder" {
+		if ponder, err := chess.ParseUCI(fields[3]); err == nil {
+			result.Ponder = &ponder
+		}
+	}
+	return result, nil
+}
+
+// Update info with the fields of an info line. Fields that aren't understood
+// are skipped, a new score or pv replaces the previous one.
+func parseInfo(line string, info *Info) {
+	fields := strings.Fields(line)
+	for i := 1; i < len(fields); i++ {
+		next := func() int {
+			if i+1 >= len(fields) {
+				return 0
+			}
+			i++
+			n, _ := strconv.Atoi(fields[i])
+			return n
+		}
+
+		switch fields[i] {
+		case "depth":
+			info.Depth = next()
+		case "nodes":
+			info.Nodes = next()
+		case "score":
+			if i+1 >= len(fields) {
+				return
+			}
+			i++
+			switch fields[i] {
+			case "cp":
+				info.Score, info.Mate = next(), 0
+			case "mate":
+				info.Mate = next()
+				info.Score = chess.MateScore
+				if info.Mate < 0 {
+					info.Score = -chess.MateScore
+				}
+			}
+		case "pv":
+			info.PV = info.PV[:0]
+			for _, field := range fields[i+1:] {
+				move, err := chess.ParseUCI(field)
+				if err != nil {
+					break
+				}
+				info.PV = append(info.PV, move)
+			}
+			return
+		case "string":
+			return
+		}
+	}
+}
+
+// Ask the engine to quit and kill it if it doesn't in time
+func (e *Engine) Close() error {
+	e.send("quit")
+	e.stdin.Close()
+
+	// Wait closes stdout, so the output is read to the end before. Draining
+	// it also keeps the engine from blocking on a write while it quits.
+	drained := make(chan struct{})
+	go func() {
+		for range e.lines {
+		}
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(handshakeTimeout):
+		e.cmd.Process.Kill()
+		<-drained
+	}
+	return e.cmd.Wait()
+}
@@ -0,0 +1,92 @@
+package uci
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeEngine = "testdata/fake-engine.sh"
+
+func startFakeEngine(t *testing.T) *Engine {
+	t.Helper()
+	engine, err := Start(fakeEngine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+func TestHandshake(t *testing.T) {
+	engine := startFakeEngine(t)
+	assert.Equal(t, "Fake Engine", engine.Name)
+	assert.Equal(t, "Tester", engine.Author)
+	assert.Nil(t, engine.SetOption("Hash", "32"))
+	assert.Nil(t, engine.NewGame())
+}
+
+func TestStartMissingEngine(t *testing.T) {
+	_, err := Start("testdata/missing-engine")
+	assert.NotNil(t, err)
+}
+
+func TestGo(t *testing.T) {
+	engine := startFakeEngine(t)
+
+	assert.Nil(t, engine.Position(chess.StartingFEN, nil))
+	result, err := engine.Go(context.Background(), GoParams{Depth: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "e2e4", result.BestMove.UCI())
+	assert.Equal(t, "e7e5", result.Ponder.UCI())
+	assert.Equal(t, 2, result.Info.Depth)
+	assert.Equal(t, 25, result.Info.Score)
+	assert.Equal(t, 400, result.Info.Nodes)
+	assert.Len(t, result.Info.PV, 2)
+
+	e4, _ := chess.ParseUCI("e2e4")
+	assert.Nil(t, engine.Position(chess.StartingFEN, []chess.Move{e4}))
+	result, err = engine.Go(context.Background(), GoParams{MoveTime: time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, "e7e5", result.BestMove.UCI())
+	assert.Nil(t, result.Ponder)
+	assert.Equal(t, -25, result.Info.Score)
+
+	assert.Nil(t, engine.Position("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", nil))
+	result, err = engine.Go(context.Background(), GoParams{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.Info.Mate)
+	assert.Equal(t, chess.MateScore, result.Info.Score)
+}
+
+func TestGoStop(t *testing.T) {
+	engine := startFakeEngine(t)
+	assert.Nil(t, engine.Position(chess.StartingFEN, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := engine.Go(ctx, GoParams{Infinite: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "d2d4", result.BestMove.UCI())
+	assert.Equal(t, 10, result.Info.Score)
+}
+
+func TestNoBestMove(t *testing.T) {
+	engine := startFakeEngine(t)
+	d4, _ := chess.ParseUCI("d2d4")
+	assert.Nil(t, engine.Position(chess.StartingFEN, []chess.Move{d4}))
+	_, err := engine.Go(context.Background(), GoParams{Depth: 1})
+	assert.ErrorIs(t, err, ErrNoBestMove)
+}
+
+func TestGoParams(t *testing.T) {
+	assert.Equal(t, "go", GoParams{}.String())
+	assert.Equal(t, "go wtime 60000 btime 30000 winc 1000 binc 1000", GoParams{
+		WTime: time.Minute, BTime: 30 * time.Second, WInc: time.Second, BInc: time.Second,
+	}.String())
+	assert.Equal(t, "go depth 5 movetime 500", GoParams{Depth: 5, MoveTime: 500 * time.Millisecond}.String())
+	assert.Equal(t, "go infinite", GoParams{Infinite: true}.String())
+}
@@ -0,0 +1,259 @@
+package uci
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+)
+
+var ErrInvalidPosition = errors.New("position must be startpos or fen")
+
+const (
+	EngineName   = "sina-am chess"
+	EngineAuthor = "sina-am"
+)
+
+// Time kept aside for each move so the engine never flags because of
+// the delay between the GUI and the engine
+const moveOverhead = 50 * time.Millisecond
+
+// Runs this project's engine for a UCI GUI. Commands are read line by line
+// and searches run in the background so stop and isready are answered
+// while thinking.
+type Server struct {
+	mu  sync.Mutex // Serializes writes to out
+	out io.Writer
+
+	game *chess.ChessEngine
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewServer(out io.Writer) *Server {
+	return &Server{
+		out:  out,
+		game: chess.NewEngine(),
+	}
+}
+
+func (s *Server) send(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.out, format+"\n", args...)
+}
+
+// Handle the commands until quit or the end of the input
+func (s *Server) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			s.send("id name %s", EngineName)
+			s.send("id author %s", EngineAuthor)
+			s.send("uciok")
+		case "isready":
+			s.send("readyok")
+		case "ucinewgame":
+			s.stop()
+			s.game = chess.NewEngine()
+		case "position":
+			s.stop()
+			if err := s.position(fields[1:]); err != nil {
+				s.send("info string %s", err.Error())
+			}
+		case "go":
+			s.stop()
+			s.goSearch(fields[1:])
+		case "stop":
+			s.stop()
+		case "quit":
+			s.stop()
+			return nil
+		}
+	}
+
+	s.stop()
+	return scanner.Err()
+}
+
+// Set up the position from "startpos" or "fen <fen>", optionally followed by moves
+func (s *Server) position(args []string) error {
+	var game *chess.ChessEngine
+	var err error
+	i := 0
+	switch {
+	case len(args) > 0 && args[0] == "startpos":
+		game = chess.NewEngine()
+		i = 1
+	case len(args) > 0 && args[0] == "fen":
+		i = 1
+		for i < len(args) && args[i] != "moves" {
+			i++
+		}
+		if game, err = chess.ParseFEN(strings.Join(args[1:i], " ")); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidPosition
+	}
+
+	if i < len(args) && args[i] == "moves" {
+		for _, uci := range args[i+1:] {
+			move, err := chess.ParseUCI(uci)
+			if err != nil {
+				return err
+			}
+			if err := game.Play(game.GetTurn(), move); err != nil {
+				return fmt.Errorf("%s: %w", uci, err)
+			}
+		}
+	}
+	s.game = game
+	return nil
+}
+
+// Parse the arguments of go into search limits
+func parseGoParams(args []string) GoParams {
+	params := GoParams{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "infinite" {
+			params.Infinite = true
+			continue
+		}
+		if i+1 >= len(args) {
+			break
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			continue
+		}
+		i++
+		switch args[i-1] {
+		case "depth":
+			params.Depth = n
+		case "nodes":
+			params.Nodes = n
+		case "movetime":
+			params.MoveTime = time.Duration(n) * time.Millisecond
+		case "wtime":
+			params.WTime = time.Duration(n) * time.Millisecond
+		case "btime":
+			params.BTime = time.Duration(n) * time.Millisecond
+		case "winc":
+			params.WInc = time.Duration(n) * time.Millisecond
+		case "binc":
+			params.BInc = time.Duration(n) * time.Millisecond
+		}
+	}
+	return params
+}
+
+// Return how long to think on this move, or 0 to think until stopped or
+// the depth is reached
+func (p GoParams) thinkingTime(turn chess.Color) time.Duration {
+	if p.Infinite {
+		return 0
+	}
+	if p.MoveTime > 0 {
+		return p.MoveTime
+	}
+
+	remaining, increment := p.WTime, p.WInc
+	if turn == chess.Black {
+		remaining, increment = p.BTime, p.BInc
+	}
+	if remaining <= 0 {
+		return 0
+	}
+	// Spread the clock over the rest of the game
+	think := remaining/30 + increment/2
+	if limit := remaining/2 - moveOverhead; think > limit {
+		think = limit
+	}
+	if think < time.Millisecond {
+		think = time.Millisecond
+	}
+	return think
+}
+
+func (s *Server) goSearch(args []string) {
+	params := parseGoParams(args)
+	depth := params.Depth
+	if depth <= 0 {
+		depth = chess.MaxSearchDepth
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if think := params.thinkingTime(s.game.GetTurn()); think > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), think)
+	}
+	done := make(chan struct{})
+	s.cancel, s.done = cancel, done
+
+	game := s.game.Clone()
+	start := time.Now()
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		result, err := game.SearchWithProgress(ctx, depth, func(r chess.SearchResult) {
+			s.send("info %s", formatInfo(r, time.Since(start)))
+		})
+		if err != nil || len(game.LegalMoves()) == 0 {
+			s.send("bestmove 0000")
+			return
+		}
+		if params.Infinite {
+			// The GUI expects no bestmove before it sends stop
+			<-ctx.Done()
+		}
+		if len(result.PV) > 1 {
+			s.send("bestmove %s ponder %s", result.Move.UCI(), result.PV[1].UCI())
+		} else {
+			s.send("bestmove %s", result.Move.UCI())
+		}
+	}()
+}
+
+func formatInfo(r chess.SearchResult, elapsed time.Duration) string {
+	score := fmt.Sprintf("cp %d", r.Score)
+	if mate := r.MateIn(); mate != 0 {
+		score = fmt.Sprintf("mate %d", mate)
+	}
+	ms := elapsed.Milliseconds()
+	nps := int64(r.Nodes)
+	if ms > 0 {
+		nps = int64(r.Nodes) * 1000 / ms
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("depth %d score %s nodes %d nps %d time %d pv", r.Depth, score, r.Nodes, nps, ms))
+	for _, move := range r.PV {
+		sb.WriteString(" " + move.UCI())
+	}
+	return sb.String()
+}
+
+// Stop the running search, if any, and wait for its bestmove
+func (s *Server) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+	s.cancel, s.done = nil, nil
+}
@@ -0,0 +1,103 @@
+package uci
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run the commands through a server and return its output lines
+func runServer(t *testing.T, commands ...string) []string {
+	t.Helper()
+	out := strings.Builder{}
+	err := NewServer(&out).Run(strings.NewReader(strings.Join(commands, "\n") + "\n"))
+	assert.Nil(t, err)
+	return strings.Split(strings.TrimSpace(out.String()), "\n")
+}
+
+func lastLine(lines []string) string {
+	return lines[len(lines)-1]
+}
+
+func TestServerHandshake(t *testing.T) {
+	lines := runServer(t, "uci", "isready", "quit")
+	assert.Equal(t, []string{
+		"id name " + EngineName,
+		"id author " + EngineAuthor,
+		"uciok",
+		"readyok",
+	}, lines)
+}
+
+func TestServerMateInOne(t *testing.T) {
+	lines := runServer(t, "position fen 6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "go depth 3")
+	assert.Equal(t, "bestmove a1a8", lastLine(lines))
+	assert.Contains(t, lines[0], "score mate 1")
+}
+
+func TestServerPositionMoves(t *testing.T) {
+	// Fool's mate is on the board, black mates with d8h4
+	lines := runServer(t, "position startpos moves f2f3 e7e5 g2g4", "go depth 2")
+	assert.True(t, strings.HasPrefix(lastLine(lines), "bestmove d8h4"))
+
+	lines = runServer(t, "position startpos moves f2f3 e7e5 g2g4 d8h4", "go depth 2")
+	assert.Equal(t, "bestmove 0000", lastLine(lines))
+
+	lines = runServer(t, "position startpos moves e2e5", "isready")
+	assert.True(t, strings.HasPrefix(lines[0], "info string e2e5"))
+
+	lines = runServer(t, "position somewhere", "isready")
+	assert.Equal(t, "info string "+ErrInvalidPosition.Error(), lines[0])
+}
+
+func TestServerInfiniteStop(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	server := NewServer(outW)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Run(inR)
+		outW.Close()
+	}()
+
+	io.WriteString(inW, "position startpos\ngo infinite\n")
+	scanner := bufio.NewScanner(outR)
+	// Searching goes on until stop is sent
+	assert.True(t, scanner.Scan())
+	assert.True(t, strings.HasPrefix(scanner.Text(), "info depth 1 "))
+
+	go io.WriteString(inW, "stop\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "bestmove ") {
+			break
+		}
+	}
+	move, err := chess.ParseUCI(strings.Fields(scanner.Text())[1])
+	assert.Nil(t, err)
+	assert.Nil(t, chess.NewEngine().Play(chess.White, move))
+
+	inW.Close()
+	go io.Copy(io.Discard, outR)
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't return at the end of the input")
+	}
+}
+
+func TestThinkingTime(t *testing.T) {
+	params := parseGoParams(strings.Fields("wtime 60000 btime 3000 winc 1000 binc 0"))
+	assert.Equal(t, 60*time.Second, params.WTime)
+	assert.Equal(t, 2500*time.Millisecond, params.thinkingTime(chess.White))
+	assert.Equal(t, 100*time.Millisecond, params.thinkingTime(chess.Black))
+
+	assert.Equal(t, 200*time.Millisecond, parseGoParams([]string{"movetime", "200"}).thinkingTime(chess.White))
+	assert.Equal(t, time.Duration(0), parseGoParams([]string{"infinite"}).thinkingTime(chess.White))
+	assert.Equal(t, 4, parseGoParams([]string{"depth", "4"}).Depth)
+}
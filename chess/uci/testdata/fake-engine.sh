@@ -0,0 +1,52 @@
+#!/bin/sh
+# A stand-in UCI engine for tests. It answers the first moves of an open
+# game and waits for stop on go infinite.
+while read -r line; do
+	case "$line" in
+	uci)
+		echo "id name Fake Engine"
+		echo "id author Tester"
+		echo "option name Hash type spin default 16 min 1 max 1024"
+		echo "uciok"
+		;;
+	isready)
+		echo "readyok"
+		;;
+	position*)
+		position="$line"
+		;;
+	"go infinite")
+		echo "info depth 1 score cp 10 nodes 5 pv d2d4"
+		;;
+	go*)
+		case "$position" in
+		"position startpos")
+			echo "info depth 1 score cp 30 nodes 20 pv e2e4 e7e5"
+			echo "info depth 2 seldepth 3 score cp 25 nodes 400 nps 4000 pv e2e4 e7e5"
+			echo "bestmove e2e4 ponder e7e5"
+			;;
+		"position startpos moves e2e4")
+			echo "info depth 2 score cp -25 nodes 400 pv e7e5 g1f3"
+			echo "bestmove e7e5"
+			;;
+		"position startpos moves e2e4 e7e5")
+			echo "info depth 2 score cp 30 nodes 400 pv g1f3"
+			echo "bestmove g1f3"
+			;;
+		"position fen "*)
+			echo "info depth 5 score mate 1 nodes 100 pv a1a8"
+			echo "bestmove a1a8"
+			;;
+		*)
+			echo "bestmove (none)"
+			;;
+		esac
+		;;
+	stop)
+		echo "bestmove d2d4"
+		;;
+	quit)
+		exit 0
+		;;
+	esac
+done
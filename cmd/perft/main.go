@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+)
+
+// Print the number of leaf nodes below each legal move followed by the total,
+// in the same format as other engines' divide command
+func main() {
+	fen := flag.String("fen", chess.StartingFEN, "position to count moves from")
+	depth := flag.Int("depth", 5, "number of plies to search")
+	flag.Parse()
+
+	if *depth < 1 {
+		log.Fatal("depth must be at least 1")
+	}
+	game, err := chess.ParseFEN(*fen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now()
+	counts := game.Divide(*depth)
+	elapsed := time.Since(start)
+
+	moves := make([]string, 0, len(counts))
+	nodes := 0
+	for move, count := range counts {
+		moves = append(moves, move)
+		nodes += count
+	}
+	sort.Strings(moves)
+
+	for _, move := range moves {
+		fmt.Printf("%s: %d\n", move, counts[move])
+	}
+	fmt.Println()
+	fmt.Printf("moves: %d\n", len(moves))
+	fmt.Printf("nodes: %d\n", nodes)
+	fmt.Printf("time: %s (%.0f nodes/s)\n", elapsed, float64(nodes)/elapsed.Seconds())
+}
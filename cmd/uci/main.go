@@ -0,0 +1,15 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/sina-am/chess/chess/uci"
+)
+
+// Play the built-in engine from a UCI GUI over standard input and output
+func main() {
+	if err := uci.NewServer(os.Stdout).Run(os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
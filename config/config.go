@@ -24,4 +24,14 @@ type Config struct {
 	SecretKey       string
 	Database        Database
 	DatabaseBackend DatabaseBackend
+	// How long a game waits for a disconnected player to come back before
+	// it's lost by abandonment
+	ReconnectGracePeriod time.Duration
+	// Words hidden from the chats
+	ChatBannedWords []string
+	// Binary of the UCI engine players can choose as opponent, there's no
+	// engine opponent if it's empty
+	UCIEnginePath string
+	// How long the engine thinks about each move
+	UCIEngineMoveTime time.Duration
 }
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReconnectGracePeriod = 30 * time.Second
+	DefaultUCIEngineMoveTime    = time.Second
+)
+
+// Override the settings found in the environment, the others keep their
+// current value
+func (c *Config) LoadEnv() error {
+	if v, ok := os.LookupEnv("CHESS_RECONNECT_GRACE_PERIOD"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid CHESS_RECONNECT_GRACE_PERIOD %q", v)
+		}
+		c.ReconnectGracePeriod = d
+	}
+	// A comma separated list, like "foo, bar"
+	if v, ok := os.LookupEnv("CHESS_CHAT_BANNED_WORDS"); ok {
+		c.ChatBannedWords = []string{}
+		for _, word := range strings.Split(v, ",") {
+			if word = strings.TrimSpace(word); word != "" {
+				c.ChatBannedWords = append(c.ChatBannedWords, word)
+			}
+		}
+	}
+	if v, ok := os.LookupEnv("CHESS_UCI_ENGINE_PATH"); ok {
+		c.UCIEnginePath = v
+	}
+	if v, ok := os.LookupEnv("CHESS_UCI_ENGINE_MOVETIME"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid CHESS_UCI_ENGINE_MOVETIME %q", v)
+		}
+		c.UCIEngineMoveTime = d
+	}
+	return nil
+}
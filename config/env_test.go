@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEnv(t *testing.T) {
+	cfg := &Config{ReconnectGracePeriod: DefaultReconnectGracePeriod}
+	assert.Nil(t, cfg.LoadEnv())
+	assert.Equal(t, DefaultReconnectGracePeriod, cfg.ReconnectGracePeriod)
+
+	t.Setenv("CHESS_RECONNECT_GRACE_PERIOD", "1m30s")
+	assert.Nil(t, cfg.LoadEnv())
+	assert.Equal(t, 90*time.Second, cfg.ReconnectGracePeriod)
+
+	t.Setenv("CHESS_CHAT_BANNED_WORDS", " foo,bar ,, baz")
+	assert.Nil(t, cfg.LoadEnv())
+	assert.Equal(t, []string{"foo", "bar", "baz"}, cfg.ChatBannedWords)
+
+	t.Setenv("CHESS_UCI_ENGINE_PATH", "/usr/bin/stockfish")
+	t.Setenv("CHESS_UCI_ENGINE_MOVETIME", "500ms")
+	assert.Nil(t, cfg.LoadEnv())
+	assert.Equal(t, "/usr/bin/stockfish", cfg.UCIEnginePath)
+	assert.Equal(t, 500*time.Millisecond, cfg.UCIEngineMoveTime)
+
+	t.Setenv("CHESS_UCI_ENGINE_MOVETIME", "0s")
+	assert.NotNil(t, cfg.LoadEnv())
+
+	t.Setenv("CHESS_UCI_ENGINE_MOVETIME", "1s")
+	t.Setenv("CHESS_RECONNECT_GRACE_PERIOD", "-1s")
+	assert.NotNil(t, cfg.LoadEnv())
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"syscall/js"
 
 	"github.com/sina-am/chess/chess"
 	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"nhooyr.io/websocket"
 )
 
@@ -17,18 +19,23 @@ type message struct {
 }
 
 type OnlineChessClient struct {
-	ws     *websocket.Conn
-	engine *chess.ChessEngine
-	ui     *ChessUI
+	ws      *websocket.Conn
+	engine  *chess.ChessEngine
+	ui      *ChessUI
+	against types.Opponent // Whether the opponent is a human or the computer
+
+	// The challenge accepted instead of looking for an opponent, if any
+	challenge primitive.ObjectID
 
 	me       types.Player
 	opponent types.Player
 }
 
-func NewOnlineChessClient(ws *websocket.Conn) *OnlineChessClient {
+func NewOnlineChessClient(ws *websocket.Conn, against types.Opponent) *OnlineChessClient {
 	return &OnlineChessClient{
-		ws:     ws,
-		engine: chess.NewEngine(),
+		ws:      ws,
+		engine:  chess.NewEngine(),
+		against: against,
 	}
 }
 
@@ -37,19 +44,71 @@ func (game *OnlineChessClient) sendStartEvent(ctx context.Context) (types.StartG
 		"type": types.StartServerEvent,
 		"payload": types.StartGameMsgIn{
 			Duration: 10,
+			Opponent: game.against,
 		},
 	})
+	if !game.challenge.IsZero() {
+		startMsg, _ = json.Marshal(map[string]any{
+			"type":    types.AcceptChallengeServerEvent,
+			"payload": types.ChallengeIdMsgIn{ChallengeId: game.challenge},
+		})
+	}
 	game.ws.Write(ctx, websocket.MessageText, startMsg)
-	_, msgBytes, err := game.ws.Read(ctx)
-	if err != nil {
-		return types.StartGameMsgOut{}, fmt.Errorf("websocket read error: %s", err)
+	for {
+		_, msgBytes, err := game.ws.Read(ctx)
+		if err != nil {
+			return types.StartGameMsgOut{}, fmt.Errorf("websocket read error: %s", err)
+		}
+		msg := message{}
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			return types.StartGameMsgOut{}, fmt.Errorf("json unmarshal error: %s", err)
+		}
+
+		// The server tells how long the wait may be before finding an opponent
+		if msg.Type == types.WaitingClientEvent {
+			payload := types.WaitingPayloadMsgOut{}
+			json.Unmarshal(msg.Payload, &payload)
+			fmt.Printf("waiting for an opponent, about %d seconds\n", payload.EstimatedWait)
+			continue
+		}
+
+		// A game left by a dropped connection is resumed instead
+		if msg.Type == types.ResumedClientEvent {
+			return game.resume(msgBytes)
+		}
+
+		started := types.StartGameMsgOut{}
+		if err := json.Unmarshal(msgBytes, &started); err != nil {
+			return types.StartGameMsgOut{}, fmt.Errorf("json unmarshal error: %s", err)
+		}
+		return started, nil
 	}
-	msg := types.StartGameMsgOut{}
-	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+}
+
+// Replay the moves of a resumed game and return it as a started game
+func (game *OnlineChessClient) resume(msgBytes []byte) (types.StartGameMsgOut, error) {
+	resumed := types.ResumeGameMsgOut{}
+	if err := json.Unmarshal(msgBytes, &resumed); err != nil {
 		return types.StartGameMsgOut{}, fmt.Errorf("json unmarshal error: %s", err)
 	}
-
-	return msg, nil
+	for _, record := range resumed.Payload.Moves {
+		move, err := chess.ParseUCI(record.UCI)
+		if err != nil {
+			return types.StartGameMsgOut{}, err
+		}
+		if err := game.engine.Play(game.engine.GetTurn(), move); err != nil {
+			return types.StartGameMsgOut{}, err
+		}
+	}
+	return types.StartGameMsgOut{
+		Type: types.StartedClientEvent,
+		Payload: types.StartGamePayloadMsgOut{
+			You:         resumed.Payload.You,
+			Opponent:    resumed.Payload.Opponent,
+			TimeControl: resumed.Payload.TimeControl,
+			Clock:       resumed.Payload.Clock,
+		},
+	}, nil
 }
 
 func (game *OnlineChessClient) eventListener(ctx context.Context, wg *sync.WaitGroup) {
@@ -76,6 +135,26 @@ func (game *OnlineChessClient) eventListener(ctx context.Context, wg *sync.WaitG
 			}
 			game.ui.Render()
 			break
+		case types.TakenBackClientEvent:
+			payload := types.TakenBackPayloadMsgOut{}
+			json.Unmarshal(msg.Payload, &payload)
+			for i := 0; i < payload.Plies; i++ {
+				if err := game.engine.Undo(); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			game.ui.Render()
+		case types.OpponentDisconnectedClientEvent:
+			payload := types.OpponentDisconnectedPayloadMsgOut{}
+			json.Unmarshal(msg.Payload, &payload)
+			fmt.Printf("opponent disconnected, waiting %d seconds for them\n", payload.GracePeriod)
+		case types.OpponentReconnectedClientEvent:
+			fmt.Println("opponent reconnected")
+		case types.ChallengedClientEvent:
+			payload := types.Challenge{}
+			json.Unmarshal(msg.Payload, &payload)
+			fmt.Printf("%s challenged you to a %s game: %s\n", payload.Challenger.Name, payload.TimeControl.Name, payload.URL)
 		case types.EndGameClientEvent:
 			payload := types.EndGamePayloadMsgOut{}
 			json.Unmarshal(msg.Payload, &payload)
@@ -110,14 +189,11 @@ func (game *OnlineChessClient) Start(ctx context.Context) error {
 		return nil
 	})
 
-	game.ui.HookDropHandler(func(piece *chess.Piece, x, y int) error {
+	game.ui.HookDropHandler(func(piece *chess.Piece, move chess.Move) error {
 		msg, _ := json.Marshal(map[string]any{
 			"type": types.PlayServerEvent,
 			"payload": types.PlayGameMsgIn{
-				Move: chess.Move{
-					From: piece.Location,
-					To:   chess.Location{Row: y, Col: x},
-				},
+				Move: move,
 			},
 		})
 		if err := game.ws.Write(ctx, websocket.MessageText, msg); err != nil {
@@ -135,7 +211,7 @@ func (game *OnlineChessClient) Start(ctx context.Context) error {
 	return nil
 }
 
-func startOnlineGame(ctx context.Context) {
+func startOnlineGame(ctx context.Context, against types.Opponent, challenge primitive.ObjectID) {
 	ws, _, err := websocket.Dial(ctx, "ws://localhost:8080/ws", nil)
 	if err != nil {
 		fmt.Println("websocket error", err)
@@ -143,7 +219,8 @@ func startOnlineGame(ctx context.Context) {
 	}
 	defer ws.Close(websocket.StatusGoingAway, "BYE")
 
-	game := NewOnlineChessClient(ws)
+	game := NewOnlineChessClient(ws, against)
+	game.challenge = challenge
 	game.Start(ctx)
 }
 
@@ -156,6 +233,24 @@ func startOfflineGame(ctx context.Context) {
 func main() {
 	fmt.Println("WASM Go Initialized")
 	var done chan struct{}
-	startOnlineGame(context.Background())
+
+	against := types.HumanOpponent
+	dataset := js.Global().Get("document").Call("getElementById", "game").Get("dataset")
+	mode := dataset.Get("mode")
+	if mode.Truthy() {
+		switch mode.String() {
+		case "computer":
+			against = types.ComputerOpponent
+		case "engine":
+			against = types.EngineOpponent
+		}
+	}
+
+	// The page of a challenge link accepts it
+	challenge := primitive.NilObjectID
+	if id := dataset.Get("challenge"); id.Truthy() {
+		challenge, _ = primitive.ObjectIDFromHex(id.String())
+	}
+	startOnlineGame(context.Background(), against, challenge)
 	<-done
 }
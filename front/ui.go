@@ -51,7 +51,7 @@ type ChessUI struct {
 }
 
 type HandlePickupPiece func(piece *chess.Piece) error
-type HandleDropPiece func(piece *chess.Piece, x, y int) error
+type HandleDropPiece func(piece *chess.Piece, move chess.Move) error
 
 func NewChessUI(game *chess.ChessEngine, viewAs chess.Color) *ChessUI {
 	document := js.Global().Get("document")
@@ -144,18 +144,33 @@ func (ui *ChessUI) handlePickupPiece(x, y int) {
 
 }
 
+// Ask the player which piece the pawn should be promoted to
+func (ui *ChessUI) choosePromotion() chess.PieceType {
+	answer := js.Global().Call("prompt", "Promote to (queen, rook, bishop, knight)", "queen")
+	if answer.IsNull() {
+		return chess.Queen
+	}
+	pieceType, err := chess.ParsePieceType(answer.String())
+	if err != nil || !pieceType.IsPromotable() {
+		return chess.Queen
+	}
+	return pieceType
+}
+
 func (ui *ChessUI) handleDropPiece(x, y int) {
+	move := chess.Move{From: ui.pickedPiece.Location, To: chess.Location{Row: y, Col: x}}
+	if ui.pickedPiece.Type == chess.Pawn && y == ui.pickedPiece.Color.LastRow() {
+		move.Promotion = ui.choosePromotion()
+	}
+
 	for _, handler := range ui.dropHandlers {
-		if err := handler(ui.pickedPiece, x, y); err != nil {
+		if err := handler(ui.pickedPiece, move); err != nil {
 			return
 		}
 	}
 
 	ui.changeBackground(ui.pickedPiece.Location.Col, ui.pickedPiece.Location.Row, getSquireColor(ui.pickedPiece.Location.Col, ui.pickedPiece.Location.Row))
-	err := ui.game.Play(
-		ui.pickedPiece.Color,
-		chess.Move{From: ui.pickedPiece.Location, To: chess.Location{Row: y, Col: x}},
-	)
+	err := ui.game.Play(ui.pickedPiece.Color, move)
 
 	if err != nil {
 		fmt.Println(err)
@@ -220,7 +235,7 @@ func (ui *ChessUI) Render() {
 }
 
 func (ui *ChessUI) Finish(result chess.Result) {
-	if result.Reason != chess.Stalemate || result.Reason != chess.Draw {
+	if result.WinnerColor != chess.Empty {
 		ui.document.Call("getElementById", "result").Set("innerText", fmt.Sprintf("%s won by %s", result.WinnerColor, result.Reason))
 	} else {
 		ui.document.Call("getElementById", "result").Set("innerText", fmt.Sprintf("%s", result.Reason))
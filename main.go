@@ -8,6 +8,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/sina-am/chess/chess/uci"
 	"github.com/sina-am/chess/config"
 	"github.com/sina-am/chess/core"
 	"github.com/sina-am/chess/services/auth"
@@ -76,6 +77,11 @@ func main() {
 			Name:     "chess",
 			Timeout:  3 * time.Second,
 		},
+		ReconnectGracePeriod: config.DefaultReconnectGracePeriod,
+		UCIEngineMoveTime:    config.DefaultUCIEngineMoveTime,
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		log.Fatal(err)
 	}
 
 	storage := storage.NewMemoryStorage()
@@ -91,21 +97,40 @@ func main() {
 	e.GET("/auth/login", userSrv.AuthenticationGET)
 	e.POST("/auth/registration", userSrv.RegistrationAPI)
 	e.GET("/users", userSrv.UsersAPI)
+	e.GET("/users/:id/ratings", userSrv.RatingHistoryAPI)
 
 	gameRenderer, err := core.NewTemplateRenderer(cfg.Debug, "./services/game/templates")
 	if err != nil {
 		log.Fatal(err)
 	}
-	gameSrv := game.NewAPIService(cfg, storage, authenticator, gameRenderer)
+
+	var engine *game.SharedEngine
+	if cfg.UCIEnginePath != "" {
+		uciEngine, err := uci.Start(cfg.UCIEnginePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer uciEngine.Close()
+		engine = game.NewSharedEngine(uciEngine, uci.GoParams{MoveTime: cfg.UCIEngineMoveTime})
+	}
+	gameSrv := game.NewAPIService(cfg, storage, authenticator, gameRenderer, engine)
 
 	e.GET("/players", gameSrv.GetPlayers)
+	e.GET("/legal-moves", gameSrv.LegalMoves)
+	e.GET("/time-controls", gameSrv.TimeControls)
+	e.GET("/games/live", gameSrv.LiveGames)
+	e.GET("/games/:id", gameSrv.GetGame)
+	e.GET("/games/:id/analysis", gameSrv.GameAnalysis)
+	e.GET("/users/:id/games", gameSrv.UserGames)
 	e.GET("/ws", gameSrv.WebSocketAPI)
 	e.GET("/game-options", gameSrv.GameOptions)
 	e.POST("/game-options", gameSrv.GameOptions)
 	e.GET("/game", gameSrv.StartGame)
+	e.GET("/challenge", gameSrv.ChallengePage)
 	e.GET("/", gameSrv.Home)
 
 	go gameSrv.GameHandler.Start()
+	go gameSrv.Analyzer.Start()
 
 	e.Use(authenticator.AuthenticationMiddleware)
 	e.Logger.Fatal(e.Start(":8080"))
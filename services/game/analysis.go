@@ -0,0 +1,85 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrAnalysisQueueFull = errors.New("too many games are waiting for analysis")
+
+const (
+	defaultAnalysisDepth = 8
+	analysisQueueSize    = 64
+	analysisTimeout      = 5 * time.Minute
+)
+
+type analysisJob struct {
+	gameId primitive.ObjectID
+	fen    string
+	moves  []chess.Move
+}
+
+// Analyzes finished games one at a time in the background and saves the
+// reports to the storage
+type Analyzer struct {
+	storage storage.Storage
+	depth   int
+	jobs    chan analysisJob
+}
+
+func NewAnalyzer(s storage.Storage, depth int) *Analyzer {
+	return &Analyzer{
+		storage: s,
+		depth:   depth,
+		jobs:    make(chan analysisJob, analysisQueueSize),
+	}
+}
+
+// Queue the game for analysis. It's saved as pending right away so the
+// report can be polled, and never blocks the caller.
+func (a *Analyzer) Enqueue(gameId primitive.ObjectID, fen string, moves []chess.Move) error {
+	ctx := context.Background()
+	pending := &types.GameAnalysis{GameId: gameId, Status: types.AnalysisPending}
+	if err := a.storage.SaveAnalysis(ctx, pending); err != nil {
+		return err
+	}
+
+	select {
+	case a.jobs <- analysisJob{gameId: gameId, fen: fen, moves: moves}:
+		return nil
+	default:
+		failed := &types.GameAnalysis{GameId: gameId, Status: types.AnalysisFailed, Error: ErrAnalysisQueueFull.Error()}
+		a.storage.SaveAnalysis(ctx, failed)
+		return ErrAnalysisQueueFull
+	}
+}
+
+// Run the queued jobs forever
+func (a *Analyzer) Start() {
+	for job := range a.jobs {
+		a.run(job)
+	}
+}
+
+func (a *Analyzer) run(job analysisJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), analysisTimeout)
+	defer cancel()
+
+	report := &types.GameAnalysis{GameId: job.gameId, Status: types.AnalysisDone}
+	analysis, err := chess.Analyze(ctx, job.fen, job.moves, a.depth)
+	if err != nil {
+		report.Status, report.Error = types.AnalysisFailed, err.Error()
+	} else {
+		report.Analysis = analysis
+	}
+	if err := a.storage.SaveAnalysis(context.Background(), report); err != nil {
+		log.Printf("saving analysis of game %s: %s", job.gameId.Hex(), err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getAnalysis(t *testing.T, s *APIService, id string) (*httptest.ResponseRecorder, types.GameAnalysis) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/games/"+id+"/analysis", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+
+	assert.Nil(t, s.GameAnalysis(c))
+	out := types.GameAnalysis{}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec, out
+}
+
+func TestAnalyzer(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	analyzer := NewAnalyzer(db, 2)
+	s := &APIService{Storage: db, Analyzer: analyzer}
+
+	gameId := primitive.NewObjectID()
+	moves := []chess.Move{}
+	for _, uci := range []string{"f2f3", "e7e5", "g2g4", "d8h4"} {
+		move, _ := chess.ParseUCI(uci)
+		moves = append(moves, move)
+	}
+	assert.Nil(t, analyzer.Enqueue(gameId, chess.StartingFEN, moves))
+
+	rec, out := getAnalysis(t, s, gameId.Hex())
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, types.AnalysisPending, out.Status)
+
+	go analyzer.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for out.Status == types.AnalysisPending && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		rec, out = getAnalysis(t, s, gameId.Hex())
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, types.AnalysisDone, out.Status)
+	assert.Len(t, out.Analysis.Plies, 4)
+	assert.Equal(t, chess.Blunder, out.Analysis.Plies[2].Classification)
+	assert.Equal(t, 1, out.Analysis.White.Blunders)
+
+	rec, _ = getAnalysis(t, s, primitive.NewObjectID().Hex())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec, _ = getAnalysis(t, s, "invalid")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAnalyzerFailure(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	analyzer := NewAnalyzer(db, 2)
+	gameId := primitive.NewObjectID()
+	illegal, _ := chess.ParseUCI("e2e5")
+
+	analyzer.Enqueue(gameId, chess.StartingFEN, []chess.Move{illegal})
+	analyzer.run(<-analyzer.jobs)
+
+	analysis, err := db.GetAnalysisByGameId(context.Background(), gameId)
+	assert.Nil(t, err)
+	assert.Equal(t, types.AnalysisFailed, analysis.Status)
+	assert.NotEmpty(t, analysis.Error)
+}
@@ -1,26 +1,34 @@
 package game
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"github.com/sina-am/chess/chess"
 	"github.com/sina-am/chess/config"
 	"github.com/sina-am/chess/core"
 	"github.com/sina-am/chess/services/auth"
 	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type APIService struct {
 	Storage       storage.Storage
 	WsUpgrader    websocket.Upgrader
 	GameHandler   GameHandler
+	Analyzer      *Analyzer
 	Renderer      core.Renderer
 	Authenticator auth.Authenticator
+	Engine        *SharedEngine // Offered as an opponent, nil if there's none
 }
 
-func NewAPIService(cfg *config.Config, s storage.Storage, auth auth.Authenticator, renderer core.Renderer) *APIService {
+// The engine is offered as an opponent if it isn't nil
+func NewAPIService(cfg *config.Config, s storage.Storage, auth auth.Authenticator, renderer core.Renderer, engine *SharedEngine) *APIService {
+	analyzer := NewAnalyzer(s, defaultAnalysisDepth)
 	return &APIService{
 		Storage: s,
 		WsUpgrader: websocket.Upgrader{
@@ -29,9 +37,11 @@ func NewAPIService(cfg *config.Config, s storage.Storage, auth auth.Authenticato
 			ReadBufferSize:   1024,
 			WriteBufferSize:  1024,
 		},
-		GameHandler:   NewGameHandler(NewMemoryWaitList(), s),
+		GameHandler:   NewGameHandler(NewMatchmaker(), NewChat(NewWordFilter(cfg.ChatBannedWords...)), s, analyzer, cfg.ReconnectGracePeriod, engine),
+		Analyzer:      analyzer,
 		Authenticator: auth,
 		Renderer:      renderer,
+		Engine:        engine,
 	}
 }
 
@@ -40,7 +50,7 @@ func (s *APIService) GameOptions(c echo.Context) error {
 }
 
 type gameOptionsIn struct {
-	Mode     string        `query:"game_mode" validate:"required,eq=online|eq=offline"`
+	Mode     string        `query:"game_mode" validate:"required,eq=online|eq=offline|eq=computer|eq=engine"`
 	Duration time.Duration `query:"duration" validate:"required,gte=10"`
 }
 
@@ -52,12 +62,205 @@ func (s *APIService) StartGame(c echo.Context) error {
 	if err := c.Validate(&opts); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
 	}
+	if opts.Mode == "engine" && s.Engine == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": ErrNoEngine.Error()})
+	}
 
 	return s.Renderer.Render(c, "game.html", map[string]any{
 		"gameOpts": opts,
 		"user":     s.Authenticator.GetUser(c),
 	})
 }
+
+// Time controls offered to players, they can also choose their own within
+// the limits
+var timeControlPresets = []chess.TimeControl{
+	chess.SuddenDeath(time.Minute),
+	chess.SuddenDeath(3 * time.Minute),
+	chess.NewTimeControl(3*time.Minute, chess.Increment, 2*time.Second),
+	chess.SuddenDeath(5 * time.Minute),
+	chess.NewTimeControl(5*time.Minute, chess.Increment, 3*time.Second),
+	chess.SuddenDeath(10 * time.Minute),
+	chess.NewTimeControl(10*time.Minute, chess.Increment, 5*time.Second),
+	chess.NewTimeControl(15*time.Minute, chess.Increment, 10*time.Second),
+	chess.SuddenDeath(30 * time.Minute),
+	{
+		Stages: []chess.TimeStage{{Moves: 40, Time: 90 * time.Minute}, {Time: 30 * time.Minute}},
+		Mode:   chess.Increment,
+		Bonus:  30 * time.Second,
+	},
+}
+
+// Return the preset time controls and the limits of custom ones
+func (s *APIService) TimeControls(c echo.Context) error {
+	presets := make([]types.TimeControlMsg, len(timeControlPresets))
+	for i, tc := range timeControlPresets {
+		presets[i] = types.NewTimeControlMsg(tc)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"presets": presets,
+		"modes":   []chess.ClockMode{chess.Increment, chess.BronsteinDelay, chess.SimpleDelay},
+		"limits": map[string]int{
+			"minStageSeconds": int(chess.MinStageTime.Seconds()),
+			"maxStageSeconds": int(chess.MaxStageTime.Seconds()),
+			"maxBonusSeconds": int(chess.MaxBonus.Seconds()),
+			"maxStages":       chess.MaxStages,
+			"maxStageMoves":   chess.MaxStageMove,
+		},
+	})
+}
+
+type legalMovesIn struct {
+	FEN    string `query:"fen"`
+	Square string `query:"square"`
+}
+
+type legalMoveOut struct {
+	Move chess.Move `json:"move"`
+	SAN  string     `json:"san"`
+	UCI  string     `json:"uci"`
+}
+
+// Return the legal moves of the side to move in the given position, or
+// only those of the piece on the given square
+func (s *APIService) LegalMoves(c echo.Context) error {
+	in := legalMovesIn{}
+	if err := c.Bind(&in); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	if in.FEN == "" {
+		in.FEN = chess.StartingFEN
+	}
+
+	game, err := chess.ParseFEN(in.FEN)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+
+	moves := game.LegalMoves()
+	if in.Square != "" {
+		loc, err := chess.ParseSquare(in.Square)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+		}
+		moves = game.LegalMovesFrom(loc)
+	}
+
+	out := make([]legalMoveOut, len(moves))
+	for i, move := range moves {
+		san, _ := game.SAN(move)
+		out[i] = legalMoveOut{Move: move, SAN: san, UCI: move.UCI()}
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"fen":   game.FEN(),
+		"moves": out,
+	})
+}
+
+// Render the game page accepting the challenge, which is how challenges
+// are shared with guests
+func (s *APIService) ChallengePage(c echo.Context) error {
+	challengeId, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid challenge id"})
+	}
+	challenge, err := s.GameHandler.GetChallenge(challengeId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": err.Error()})
+	}
+
+	return s.Renderer.Render(c, "game.html", map[string]any{
+		"gameOpts":  gameOptionsIn{Mode: "online"},
+		"challenge": challenge,
+		"user":      s.Authenticator.GetUser(c),
+	})
+}
+
+// Return the games being played, most watched first
+func (s *APIService) LiveGames(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.GameHandler.LiveGames())
+}
+
+func (s *APIService) GetGame(c echo.Context) error {
+	gameId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid game id"})
+	}
+
+	game, err := s.Storage.GetGameById(c.Request().Context(), gameId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNoRecord) {
+			return c.JSON(http.StatusNotFound, map[string]string{"message": "game not found"})
+		}
+		return err
+	}
+
+	// The players' room is private, so only the players get the chat back
+	userId := s.Authenticator.GetUser(c).GetId()
+	for _, player := range game.Players {
+		if player.UserId == userId {
+			return c.JSON(http.StatusOK, game)
+		}
+	}
+	return c.JSON(http.StatusOK, withoutChat(game))
+}
+
+// Return a copy of the stored game without its chat
+func withoutChat(game *types.Game) types.Game {
+	public := *game
+	public.Chat = nil
+	return public
+}
+
+type userGamesIn struct {
+	Page int `query:"page"`
+	Size int `query:"size"`
+}
+
+// Return a page of the games played by a user, the most recent first
+func (s *APIService) UserGames(c echo.Context) error {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid user id"})
+	}
+	in := userGamesIn{}
+	if err := c.Bind(&in); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+
+	games, err := s.Storage.ListGamesByUser(c.Request().Context(), userId, storage.Page{Number: in.Page, Size: in.Size})
+	if err != nil {
+		return err
+	}
+	public := make([]types.Game, 0, len(games))
+	for _, game := range games {
+		public = append(public, withoutChat(game))
+	}
+	return c.JSON(http.StatusOK, public)
+}
+
+// Return the analysis of a finished game. While the game is still being
+// analyzed the pending report is returned with 202 Accepted.
+func (s *APIService) GameAnalysis(c echo.Context) error {
+	gameId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid game id"})
+	}
+
+	analysis, err := s.Storage.GetAnalysisByGameId(c.Request().Context(), gameId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNoRecord) {
+			return c.JSON(http.StatusNotFound, map[string]string{"message": "game has no analysis"})
+		}
+		return err
+	}
+
+	if analysis.Status == types.AnalysisPending {
+		return c.JSON(http.StatusAccepted, analysis)
+	}
+	return c.JSON(http.StatusOK, analysis)
+}
+
 func (s *APIService) GetPlayers(c echo.Context) error {
 	users, err := s.Storage.GetAllUsers(c.Request().Context())
 	if err != nil {
@@ -72,6 +275,9 @@ func (s *APIService) Home(c echo.Context) error {
 	content := map[string]any{
 		"user": user,
 	}
+	if s.Engine != nil {
+		content["engine"] = s.Engine.Name()
+	}
 
 	return s.Renderer.Render(c, "home.html", content)
 }
@@ -0,0 +1,131 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type legalMovesOut struct {
+	FEN   string         `json:"fen"`
+	Moves []legalMoveOut `json:"moves"`
+}
+
+func getLegalMoves(t *testing.T, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/legal-moves?"+query.Encode(), nil)
+	rec := httptest.NewRecorder()
+
+	s := &APIService{}
+	assert.Nil(t, s.LegalMoves(e.NewContext(req, rec)))
+	return rec
+}
+
+func TestLegalMovesAPI(t *testing.T) {
+	rec := getLegalMoves(t, url.Values{})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	out := legalMovesOut{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Len(t, out.Moves, 20)
+
+	rec = getLegalMoves(t, url.Values{
+		"fen":    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"},
+		"square": {"e1"},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	out = legalMovesOut{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	sans := []string{}
+	for _, move := range out.Moves {
+		sans = append(sans, move.SAN)
+	}
+	assert.ElementsMatch(t, []string{"Kd1", "Kd2", "Ke2", "Kf2", "Kf1", "O-O", "O-O-O"}, sans)
+
+	rec = getLegalMoves(t, url.Values{"fen": {"invalid"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = getLegalMoves(t, url.Values{"square": {"z9"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGamesAPI(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	s := &APIService{Storage: db, Authenticator: auth.NewJWTAuthentication("secret", nil)}
+	user := primitive.NewObjectID()
+	game := &types.Game{
+		Players: []types.Player{{UserId: user, Color: chess.White}, {Color: chess.Black}},
+		Chat:    []types.ChatMessage{{UserId: user, Room: types.PlayersRoom, Text: "good luck"}},
+	}
+	assert.Nil(t, db.InsertGame(context.Background(), game))
+
+	e := echo.New()
+	var viewer auth.User = auth.NewAnonymousUser()
+	get := func(handler echo.HandlerFunc, path, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", viewer)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		assert.Nil(t, handler(c))
+		return rec
+	}
+
+	rec := get(s.GetGame, "/games/"+game.Id.Hex(), game.Id.Hex())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	out := types.Game{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal(t, game.Id, out.Id)
+	assert.Empty(t, out.Chat)
+	assert.Len(t, game.Chat, 1)
+
+	// Only the players read the chat of their room
+	viewer = &types.User{Id: user}
+	rec = get(s.GetGame, "/games/"+game.Id.Hex(), game.Id.Hex())
+	out = types.Game{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Equal(t, game.Chat, out.Chat)
+
+	missing := primitive.NewObjectID().Hex()
+	assert.Equal(t, http.StatusNotFound, get(s.GetGame, "/games/"+missing, missing).Code)
+	assert.Equal(t, http.StatusBadRequest, get(s.GetGame, "/games/invalid", "invalid").Code)
+
+	rec = get(s.UserGames, "/users/"+user.Hex()+"/games?page=1&size=10", user.Hex())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	games := []types.Game{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &games))
+	assert.Len(t, games, 1)
+	assert.Empty(t, games[0].Chat)
+	assert.Equal(t, http.StatusBadRequest, get(s.UserGames, "/users/invalid/games", "invalid").Code)
+}
+
+func TestTimeControlsAPI(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/time-controls", nil)
+	rec := httptest.NewRecorder()
+
+	s := &APIService{}
+	assert.Nil(t, s.TimeControls(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	out := struct {
+		Presets []types.TimeControlMsg `json:"presets"`
+	}{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Len(t, out.Presets, len(timeControlPresets))
+	for _, preset := range out.Presets {
+		assert.Nil(t, preset.TimeControl().Validate(), preset.Name)
+		assert.Equal(t, preset.Name, preset.TimeControl().String())
+	}
+}
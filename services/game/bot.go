@@ -0,0 +1,245 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/chess/uci"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultComputerLevel chess.Level = 3
+
+var ErrNoEngine = errors.New("no engine opponent is available")
+
+// Finds the move the computer plays in a game
+type Mover interface {
+	Move(game *chess.ChessEngine) (chess.Move, error)
+}
+
+// Plays with the built-in search
+type searchMover struct {
+	level chess.Level
+}
+
+func (m searchMover) Move(game *chess.ChessEngine) (chess.Move, error) {
+	return game.BestMove(m.level)
+}
+
+// Plays with an external UCI engine, which is closed with the client
+type uciMover struct {
+	engine *uci.Engine
+	params uci.GoParams
+}
+
+func (m uciMover) Move(game *chess.ChessEngine) (chess.Move, error) {
+	if err := m.engine.Position(chess.StartingFEN, game.Moves()); err != nil {
+		return chess.Move{}, err
+	}
+	result, err := m.engine.Go(context.Background(), m.params)
+	if err != nil {
+		return chess.Move{}, err
+	}
+	return result.BestMove, nil
+}
+
+func (m uciMover) Close() error {
+	return m.engine.Close()
+}
+
+// A UCI engine started once and played by every game against it. Games
+// take turns, the engine searches one position at a time.
+type SharedEngine struct {
+	mu     sync.Mutex
+	engine *uci.Engine
+	params uci.GoParams
+}
+
+// The engine stays running once the games end, it's closed by its owner
+func NewSharedEngine(engine *uci.Engine, params uci.GoParams) *SharedEngine {
+	return &SharedEngine{engine: engine, params: params}
+}
+
+func (e *SharedEngine) Move(game *chess.ChessEngine) (chess.Move, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return uciMover{engine: e.engine, params: e.params}.Move(game)
+}
+
+type botUser struct {
+	id   primitive.ObjectID
+	name string
+}
+
+func (u *botUser) GetId() primitive.ObjectID {
+	return u.id
+}
+
+func (u *botUser) GetName() string {
+	return u.name
+}
+
+func (u *botUser) IsAuthenticated() bool {
+	return false
+}
+
+// A Client played by the computer. It follows the game on its own engine
+// and answers with the move found by its Mover.
+//
+// Messages are sent from the game handler's loop, so Send only queues them
+// and never blocks while the computer is thinking.
+type BotClient struct {
+	gameHandler GameHandler
+	user        *botUser
+	mover       Mover
+
+	game  *chess.ChessEngine
+	color chess.Color
+
+	mu     sync.Mutex
+	queue  []any
+	wake   chan struct{}
+	closed bool
+}
+
+func NewBotClient(gameHandler GameHandler, name string, mover Mover) *BotClient {
+	return &BotClient{
+		gameHandler: gameHandler,
+		user:        &botUser{id: primitive.NewObjectID(), name: name},
+		mover:       mover,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Return a client playing with the built-in search at the given strength
+func NewComputerClient(gameHandler GameHandler, level chess.Level) *BotClient {
+	return NewBotClient(gameHandler, fmt.Sprintf("Computer (level %d)", level), searchMover{level: level})
+}
+
+// Return a client playing with a running UCI engine. The engine searches
+// each move with the given limits and is closed when the client is.
+func NewUCIClient(gameHandler GameHandler, engine *uci.Engine, params uci.GoParams) *BotClient {
+	return NewBotClient(gameHandler, engine.Name, uciMover{engine: engine, params: params})
+}
+
+func (e *SharedEngine) Name() string {
+	return e.engine.Name
+}
+
+// Return a client playing with the shared engine
+func NewEngineClient(gameHandler GameHandler, engine *SharedEngine) *BotClient {
+	return NewBotClient(gameHandler, engine.Name(), engine)
+}
+
+func (b *BotClient) User() auth.User {
+	return b.user
+}
+
+func (b *BotClient) Send(msg any) {
+	b.mu.Lock()
+	b.queue = append(b.queue, msg)
+	b.mu.Unlock()
+	b.signal()
+}
+
+func (b *BotClient) SendErr(err error) {
+	log.Printf("computer player: %s", err.Error())
+}
+
+func (b *BotClient) Close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.signal()
+}
+
+func (b *BotClient) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Handle the queued messages until the client is closed
+func (b *BotClient) Start() {
+	for range b.wake {
+		b.mu.Lock()
+		queue, closed := b.queue, b.closed
+		b.queue = nil
+		b.mu.Unlock()
+
+		for _, msg := range queue {
+			b.handleMessage(msg)
+		}
+		if closed {
+			if closer, ok := b.mover.(io.Closer); ok {
+				closer.Close()
+			}
+			return
+		}
+	}
+}
+
+func (b *BotClient) handleMessage(msg any) {
+	switch msg := msg.(type) {
+	case types.StartGameMsgOut:
+		b.game = chess.NewEngine()
+		b.color = msg.Payload.You.Color
+	case types.PlayGameMsgOut:
+		if b.game == nil {
+			return
+		}
+		if err := b.game.Play(b.color.OppositeColor(), msg.Payload.Move); err != nil {
+			log.Printf("computer player: %s", err.Error())
+			return
+		}
+	case types.TakenBackMsgOut:
+		if b.game == nil {
+			return
+		}
+		for i := 0; i < msg.Payload.Plies; i++ {
+			b.game.Undo()
+		}
+	case types.EndGameMsgOut:
+		b.game = nil
+		b.gameHandler.UnRegister(b)
+		return
+	case map[string]string:
+		switch msg["type"] {
+		case "drawOffered":
+			b.gameHandler.RespondDraw(b, false)
+		case string(types.TakebackOfferedClientEvent):
+			b.gameHandler.RespondTakeback(b, true)
+		}
+		return
+	default:
+		return
+	}
+
+	b.play()
+}
+
+// Play a move if it's the computer's turn
+func (b *BotClient) play() {
+	if b.game == nil || b.game.GetTurn() != b.color || b.game.GetResult() != chess.NoResult {
+		return
+	}
+
+	move, err := b.mover.Move(b.game)
+	if err != nil {
+		log.Printf("computer player: %s", err.Error())
+		return
+	}
+	if err := b.game.Play(b.color, move); err != nil {
+		log.Printf("computer player: %s", err.Error())
+		return
+	}
+	b.gameHandler.Play(b, move)
+}
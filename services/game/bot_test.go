@@ -0,0 +1,139 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/chess/uci"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the calls made by a client, the other methods aren't expected
+type recordingHandler struct {
+	GameHandler
+	moves        chan chess.Move
+	unregistered chan Client
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{
+		moves:        make(chan chess.Move, 1),
+		unregistered: make(chan Client, 1),
+	}
+}
+
+func (h *recordingHandler) Play(client Client, move chess.Move) {
+	h.moves <- move
+}
+
+func (h *recordingHandler) UnRegister(client Client) {
+	h.unregistered <- client
+	client.Close()
+}
+
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	var zero T
+	return zero
+}
+
+func TestBotClient(t *testing.T) {
+	h := newRecordingHandler()
+	bot := NewComputerClient(h, chess.MinLevel)
+	done := make(chan struct{})
+	go func() {
+		bot.Start()
+		close(done)
+	}()
+
+	bot.Send(types.StartGameMsgOut{
+		Type: types.StartedClientEvent,
+		Payload: types.StartGamePayloadMsgOut{
+			You: types.Player{Color: chess.Black},
+		},
+	})
+	e4, _ := chess.ParseUCI("e2e4")
+	bot.Send(types.PlayGameMsgOut{
+		Type:    types.PlayedClientEvent,
+		Payload: types.PlayGamePayloadMsgOut{Move: e4},
+	})
+
+	game := chess.NewEngine()
+	assert.Nil(t, game.Play(chess.White, e4))
+	reply := receive(t, h.moves)
+	assert.Nil(t, game.Play(chess.Black, reply))
+
+	bot.Send(types.EndGameMsgOut{Type: types.EndGameClientEvent})
+	assert.Equal(t, Client(bot), receive(t, h.unregistered))
+	receive(t, done)
+}
+
+func TestUCIClient(t *testing.T) {
+	engine, err := uci.Start("../../chess/uci/testdata/fake-engine.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newRecordingHandler()
+	bot := NewUCIClient(h, engine, uci.GoParams{MoveTime: time.Second})
+	assert.Equal(t, "Fake Engine", bot.User().GetName())
+	done := make(chan struct{})
+	go func() {
+		bot.Start()
+		close(done)
+	}()
+
+	bot.Send(types.StartGameMsgOut{
+		Type: types.StartedClientEvent,
+		Payload: types.StartGamePayloadMsgOut{
+			You: types.Player{Color: chess.White},
+		},
+	})
+	assert.Equal(t, "e2e4", receive(t, h.moves).UCI())
+
+	e5, _ := chess.ParseUCI("e7e5")
+	bot.Send(types.PlayGameMsgOut{
+		Type:    types.PlayedClientEvent,
+		Payload: types.PlayGamePayloadMsgOut{Move: e5},
+	})
+	assert.Equal(t, "g1f3", receive(t, h.moves).UCI())
+
+	bot.Send(types.EndGameMsgOut{Type: types.EndGameClientEvent})
+	receive(t, h.unregistered)
+	receive(t, done)
+}
+
+func TestEngineOpponent(t *testing.T) {
+	h := NewGameHandler(NewMatchmaker(), NewChat(nil), storage.NewMemoryStorage(), nil, 0, nil).(*gameHandler)
+	a := newRecordingClient()
+	h.handleRegister(a, auth.NewAnonymousUser())
+	gs := GameSetting{TimeControl: blitz.TimeControl, Computer: true, Engine: true}
+	h.handleWait(a, gs)
+	assert.Equal(t, StatusConnected, h.players.Get(a).status)
+
+	engine, err := uci.Start("../../chess/uci/testdata/fake-engine.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	h.engine = NewSharedEngine(engine, uci.GoParams{MoveTime: time.Second})
+
+	// The engine plays white so its first move can be checked
+	h.startComputerGame(h.players.Get(a), gs, chess.Black)
+	game := h.players.Get(a).currentGame
+	defer game.Game.Exit()
+	assert.Equal(t, "Fake Engine", game.Players[chess.White].user.GetName())
+
+	event := receive(t, h.eventCh)
+	assert.Equal(t, PlayEvent, event.Type)
+	assert.Equal(t, "e2e4", event.Body.(PlayEventMsg).Move.UCI())
+}
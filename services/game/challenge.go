@@ -0,0 +1,315 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrChallengeNotFound  = errors.New("challenge not found")
+	ErrChallengeYourself  = errors.New("you can't challenge yourself")
+	ErrNotChallenged      = errors.New("the challenge is for another player")
+	ErrChallengerBusy     = errors.New("the challenger isn't available")
+	ErrTooManyChallenges  = errors.New("you have too many pending challenges")
+	ErrInvalidChallenge   = errors.New("invalid challenge")
+	ErrChallengedNotFound = errors.New("the challenged user doesn't exist")
+)
+
+const (
+	challengeTTL = 10 * time.Minute
+	// Pending challenges a player can have at once
+	maxChallenges = 5
+)
+
+// A game offered by a player to another one, or to anybody with its link
+// if challengedId is zero. It's canceled if the challenger leaves and
+// doesn't come back within the reconnect grace period.
+type challenge struct {
+	id           primitive.ObjectID
+	challenger   *onlinePlayer
+	challengedId primitive.ObjectID
+	setting      GameSetting
+	color        types.ChallengeColor
+	expiresAt    time.Time
+	// When the challenger disconnected, zero while the challenger is online
+	leftAt time.Time
+}
+
+// Return the URL of the page a challenge is accepted from. It's next to
+// the game page, which loads its assets from relative paths.
+func challengeURL(id primitive.ObjectID) string {
+	return fmt.Sprintf("/challenge?id=%s", id.Hex())
+}
+
+func (c *challenge) msg() types.Challenge {
+	return types.Challenge{
+		Id:           c.id,
+		Challenger:   recordPlayer(c.challenger, chess.Empty),
+		ChallengedId: c.challengedId,
+		TimeControl:  types.NewTimeControlMsg(c.setting.TimeControl),
+		Color:        c.color,
+		URL:          challengeURL(c.id),
+		ExpiresAt:    c.expiresAt,
+	}
+}
+
+func (c *challenge) send(p *onlinePlayer, event types.ClientEventType) {
+	p.client.Send(types.ChallengeMsgOut{Type: event, Payload: c.msg()})
+}
+
+// Send the challenger what happened to the challenge, unless the
+// challenger has disconnected and the client is gone
+func (c *challenge) notifyChallenger(event types.ClientEventType) {
+	if c.leftAt.IsZero() {
+		c.send(c.challenger, event)
+	}
+}
+
+// Return the color of the challenger
+func (c *challenge) challengerColor() chess.Color {
+	switch c.color {
+	case types.WhiteChallengeColor:
+		return chess.White
+	case types.BlackChallengeColor:
+		return chess.Black
+	}
+	return randomColor()
+}
+
+// Check if the player is free to start a game
+func isFree(p *onlinePlayer) bool {
+	return p.status == StatusConnected || p.status == StatusWatching
+}
+
+// Return the online players of the user
+func (h *gameHandler) playersOf(userId primitive.ObjectID) []*onlinePlayer {
+	players := []*onlinePlayer{}
+	for _, p := range h.players.players {
+		if p.user.GetId() == userId {
+			players = append(players, p)
+		}
+	}
+	return players
+}
+
+// Send the challenge to the challenged user if online, the challenge is
+// sent again when the user connects otherwise
+func (h *gameHandler) notifyChallenged(ch *challenge, event types.ClientEventType) {
+	if ch.challengedId.IsZero() {
+		return
+	}
+	for _, p := range h.playersOf(ch.challengedId) {
+		ch.send(p, event)
+	}
+}
+
+// Send the player the pending challenges for the player's user
+func (h *gameHandler) sendPendingChallenges(p *onlinePlayer) {
+	for _, ch := range h.challenges {
+		if ch.challengedId == p.user.GetId() {
+			ch.send(p, types.ChallengedClientEvent)
+		}
+	}
+}
+
+func (h *gameHandler) handleChallenge(c Client, userId primitive.ObjectID, gs GameSetting, color types.ChallengeColor) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	switch color {
+	case "":
+		color = types.RandomChallengeColor
+	case types.RandomChallengeColor, types.WhiteChallengeColor, types.BlackChallengeColor:
+	default:
+		c.SendErr(ErrInvalidChallenge)
+		return
+	}
+	if userId == player.user.GetId() {
+		c.SendErr(ErrChallengeYourself)
+		return
+	}
+	if !userId.IsZero() {
+		if _, err := h.storage.GetUserById(context.Background(), userId); err != nil {
+			if !errors.Is(err, storage.ErrNoRecord) {
+				log.Printf("fetching challenged user %s: %s", userId.Hex(), err.Error())
+			}
+			c.SendErr(ErrChallengedNotFound)
+			return
+		}
+	}
+
+	pending := 0
+	for _, ch := range h.challenges {
+		if ch.challenger == player {
+			pending++
+		}
+	}
+	if pending >= maxChallenges {
+		c.SendErr(ErrTooManyChallenges)
+		return
+	}
+
+	ch := &challenge{
+		id:           primitive.NewObjectID(),
+		challenger:   player,
+		challengedId: userId,
+		setting:      gs,
+		color:        color,
+		expiresAt:    time.Now().Add(challengeTTL),
+	}
+	h.challenges[ch.id] = ch
+	ch.send(player, types.ChallengeCreatedClientEvent)
+	h.notifyChallenged(ch, types.ChallengedClientEvent)
+}
+
+func (h *gameHandler) handleAcceptChallenge(c Client, challengeId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	ch, ok := h.challenges[challengeId]
+	if !ok {
+		c.SendErr(ErrChallengeNotFound)
+		return
+	}
+	if ch.challenger.user.GetId() == player.user.GetId() {
+		c.SendErr(ErrChallengeYourself)
+		return
+	}
+	if !ch.challengedId.IsZero() && ch.challengedId != player.user.GetId() {
+		c.SendErr(ErrNotChallenged)
+		return
+	}
+	if !isFree(player) {
+		c.SendErr(fmt.Errorf("already in a game"))
+		return
+	}
+	if !ch.leftAt.IsZero() || !isFree(ch.challenger) {
+		c.SendErr(ErrChallengerBusy)
+		return
+	}
+
+	delete(h.challenges, challengeId)
+	for _, p := range []*onlinePlayer{ch.challenger, player} {
+		if p.status == StatusWatching {
+			p.watching.RemoveSpectator(p)
+		}
+		h.cancelRematch(p)
+	}
+	if ch.challengerColor() == chess.White {
+		NewOnlineGame(h.storage, h.analyzer, ch.challenger, player, ch.setting)
+	} else {
+		NewOnlineGame(h.storage, h.analyzer, player, ch.challenger, ch.setting)
+	}
+}
+
+func (h *gameHandler) handleDeclineChallenge(c Client, challengeId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	ch, ok := h.challenges[challengeId]
+	if !ok {
+		c.SendErr(ErrChallengeNotFound)
+		return
+	}
+	if ch.challengedId != player.user.GetId() {
+		c.SendErr(ErrNotChallenged)
+		return
+	}
+
+	delete(h.challenges, challengeId)
+	ch.notifyChallenger(types.ChallengeDeclinedClientEvent)
+}
+
+func (h *gameHandler) handleCancelChallenge(c Client, challengeId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	ch, ok := h.challenges[challengeId]
+	if !ok || ch.challenger != player {
+		c.SendErr(ErrChallengeNotFound)
+		return
+	}
+	delete(h.challenges, challengeId)
+	h.notifyChallenged(ch, types.ChallengeCanceledClientEvent)
+}
+
+// Cancel the challenges of a player who left
+func (h *gameHandler) cancelChallenges(player *onlinePlayer) {
+	for id, ch := range h.challenges {
+		if ch.challenger == player {
+			delete(h.challenges, id)
+			h.notifyChallenged(ch, types.ChallengeCanceledClientEvent)
+		}
+	}
+}
+
+// Keep the challenges of a player who disconnected for the grace period.
+// They can't be accepted until the player comes back.
+func (h *gameHandler) suspendChallenges(player *onlinePlayer) {
+	if h.gracePeriod == 0 {
+		h.cancelChallenges(player)
+		return
+	}
+	for _, ch := range h.challenges {
+		if ch.challenger == player {
+			ch.leftAt = time.Now()
+		}
+	}
+}
+
+// Give the challenges the player's user left behind back to the player
+func (h *gameHandler) resumeChallenges(player *onlinePlayer) {
+	for _, ch := range h.challenges {
+		if !ch.leftAt.IsZero() && ch.challenger.user.GetId() == player.user.GetId() {
+			ch.challenger, ch.leftAt = player, time.Time{}
+			ch.send(player, types.ChallengeCreatedClientEvent)
+		}
+	}
+}
+
+// Remove the challenges nobody accepted in time and the ones of the
+// challengers who didn't come back
+func (h *gameHandler) expireChallenges() {
+	now := time.Now()
+	for id, ch := range h.challenges {
+		if !ch.leftAt.IsZero() && now.Sub(ch.leftAt) >= h.gracePeriod {
+			delete(h.challenges, id)
+			h.notifyChallenged(ch, types.ChallengeCanceledClientEvent)
+			continue
+		}
+		if now.Before(ch.expiresAt) {
+			continue
+		}
+		delete(h.challenges, id)
+		ch.notifyChallenger(types.ChallengeExpiredClientEvent)
+		h.notifyChallenged(ch, types.ChallengeExpiredClientEvent)
+	}
+}
+
+func (h *gameHandler) getChallenge(challengeId primitive.ObjectID) (types.Challenge, error) {
+	ch, ok := h.challenges[challengeId]
+	if !ok {
+		return types.Challenge{}, ErrChallengeNotFound
+	}
+	return ch.msg(), nil
+}
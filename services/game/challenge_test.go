@@ -0,0 +1,213 @@
+package game
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return a handler with a registered user who isn't online yet and a
+// connected guest
+func newChallengeHandler(t *testing.T) (*gameHandler, *types.User, *recordingClient) {
+	h := NewGameHandler(NewMatchmaker(), NewChat(nil), storage.NewMemoryStorage(), nil, 0, nil).(*gameHandler)
+	user := types.NewUser("user@example.com", "user", "password")
+	assert.Nil(t, h.storage.InsertUser(context.Background(), user))
+
+	a := newRecordingClient()
+	h.handleRegister(a, auth.NewAnonymousUser())
+	return h, user, a
+}
+
+// Return the only challenge of the handler
+func onlyChallenge(t *testing.T, h *gameHandler) *challenge {
+	t.Helper()
+	assert.Len(t, h.challenges, 1)
+	for _, ch := range h.challenges {
+		return ch
+	}
+	t.FailNow()
+	return nil
+}
+
+func TestChallenge(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	h.handleChallenge(a, user.Id, blitz, types.BlackChallengeColor)
+	ch := onlyChallenge(t, h)
+	created := lastMessage[types.ChallengeMsgOut](t, a)
+	assert.Equal(t, types.ChallengeCreatedClientEvent, created.Type)
+	assert.Equal(t, ch.id, created.Payload.Id)
+	assert.Equal(t, user.Id, created.Payload.ChallengedId)
+	assert.Equal(t, "5+0", created.Payload.TimeControl.Name)
+	assert.Equal(t, "/challenge?id="+ch.id.Hex(), created.Payload.URL)
+
+	// The challenge is sent once the user connects
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+	challenged := lastMessage[types.ChallengeMsgOut](t, b)
+	assert.Equal(t, types.ChallengedClientEvent, challenged.Type)
+	assert.Equal(t, ch.id, challenged.Payload.Id)
+
+	h.handleAcceptChallenge(b, ch.id)
+	assert.Empty(t, h.challenges)
+	game := h.players.Get(a).currentGame
+	assert.NotNil(t, game)
+	defer game.Game.Exit()
+	assert.Same(t, game, h.players.Get(b).currentGame)
+	assert.Same(t, h.players.Get(a), game.Players[chess.Black])
+	assert.Equal(t, blitz, game.setting)
+}
+
+func TestChallengeOnlineUser(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+
+	h.handleChallenge(a, user.Id, blitz, "")
+	ch := onlyChallenge(t, h)
+	assert.Equal(t, types.RandomChallengeColor, ch.color)
+	assert.Equal(t, types.ChallengedClientEvent, lastMessage[types.ChallengeMsgOut](t, b).Type)
+
+	h.handleDeclineChallenge(b, ch.id)
+	assert.Empty(t, h.challenges)
+	assert.Equal(t, types.ChallengeDeclinedClientEvent, lastMessage[types.ChallengeMsgOut](t, a).Type)
+	assert.Nil(t, h.players.Get(a).currentGame)
+}
+
+func TestChallengeRejected(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	h.handleChallenge(a, h.players.Get(a).user.GetId(), blitz, "")
+	h.handleChallenge(a, primitive.NewObjectID(), blitz, "")
+	h.handleChallenge(a, user.Id, blitz, "purple")
+	assert.Empty(t, h.challenges)
+
+	for i := 0; i < maxChallenges+1; i++ {
+		h.handleChallenge(a, user.Id, blitz, "")
+	}
+	assert.Len(t, h.challenges, maxChallenges)
+}
+
+func TestChallengeOnlyForChallenged(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	h.handleChallenge(a, user.Id, blitz, "")
+	ch := onlyChallenge(t, h)
+
+	other := newRecordingClient()
+	h.handleRegister(other, auth.NewAnonymousUser())
+	h.handleAcceptChallenge(other, ch.id)
+	h.handleDeclineChallenge(other, ch.id)
+	h.handleCancelChallenge(other, ch.id)
+	assert.Len(t, h.challenges, 1)
+	assert.Nil(t, h.players.Get(a).currentGame)
+
+	// The challenger can't accept their own challenge either
+	h.handleAcceptChallenge(a, ch.id)
+	assert.Len(t, h.challenges, 1)
+}
+
+func TestChallengeLink(t *testing.T) {
+	h, _, a := newChallengeHandler(t)
+	h.handleChallenge(a, primitive.NilObjectID, blitz, types.WhiteChallengeColor)
+	ch := onlyChallenge(t, h)
+
+	msg, err := h.getChallenge(ch.id)
+	assert.Nil(t, err)
+	assert.True(t, msg.ChallengedId.IsZero())
+	_, err = h.getChallenge(primitive.NewObjectID())
+	assert.ErrorIs(t, err, ErrChallengeNotFound)
+
+	// Any guest with the link can accept it
+	guest := newRecordingClient()
+	h.handleRegister(guest, auth.NewAnonymousUser())
+	h.handleAcceptChallenge(guest, ch.id)
+	game := h.players.Get(guest).currentGame
+	assert.NotNil(t, game)
+	defer game.Game.Exit()
+	assert.Same(t, h.players.Get(a), game.Players[chess.White])
+}
+
+func TestChallengeCanceled(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+
+	h.handleChallenge(a, user.Id, blitz, "")
+	h.handleCancelChallenge(a, onlyChallenge(t, h).id)
+	assert.Empty(t, h.challenges)
+	assert.Equal(t, types.ChallengeCanceledClientEvent, lastMessage[types.ChallengeMsgOut](t, b).Type)
+
+	// Challenges are canceled when the challenger leaves, at once without
+	// a grace period
+	h.handleChallenge(a, user.Id, blitz, "")
+	h.handleChallenge(a, primitive.NilObjectID, blitz, "")
+	h.handleUnregister(a)
+	assert.Empty(t, h.challenges)
+}
+
+func TestChallengeExpires(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+
+	h.handleChallenge(a, user.Id, blitz, "")
+	h.expireChallenges()
+	ch := onlyChallenge(t, h)
+
+	ch.expiresAt = time.Now().Add(-time.Second)
+	h.expireChallenges()
+	assert.Empty(t, h.challenges)
+	assert.Equal(t, types.ChallengeExpiredClientEvent, lastMessage[types.ChallengeMsgOut](t, a).Type)
+	assert.Equal(t, types.ChallengeExpiredClientEvent, lastMessage[types.ChallengeMsgOut](t, b).Type)
+
+	h.handleAcceptChallenge(b, ch.id)
+	assert.Nil(t, h.players.Get(b).currentGame)
+}
+
+func TestChallengeKeptWhileChallengerAway(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	h.gracePeriod = time.Minute
+	guest := h.players.Get(a).user
+	h.handleChallenge(a, user.Id, blitz, "")
+	h.handleUnregister(a)
+	ch := onlyChallenge(t, h)
+
+	// The challenge waits for the challenged user, but can't be accepted
+	// until the challenger is back
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+	assert.Equal(t, types.ChallengedClientEvent, lastMessage[types.ChallengeMsgOut](t, b).Type)
+	h.handleAcceptChallenge(b, ch.id)
+	assert.Nil(t, h.players.Get(b).currentGame)
+
+	c := newRecordingClient()
+	h.handleRegister(c, guest)
+	assert.Same(t, h.players.Get(c), ch.challenger)
+	assert.Equal(t, types.ChallengeCreatedClientEvent, lastMessage[types.ChallengeMsgOut](t, c).Type)
+	h.handleAcceptChallenge(b, ch.id)
+	game := h.players.Get(b).currentGame
+	assert.NotNil(t, game)
+	defer game.Game.Exit()
+	assert.Same(t, game, h.players.Get(c).currentGame)
+}
+
+func TestChallengeCanceledWhenChallengerDoesNotReturn(t *testing.T) {
+	h, user, a := newChallengeHandler(t)
+	h.gracePeriod = 10 * time.Millisecond
+	b := newRecordingClient()
+	h.handleRegister(b, user)
+	h.handleChallenge(a, user.Id, blitz, "")
+	h.handleUnregister(a)
+
+	h.expireChallenges()
+	assert.Len(t, h.challenges, 1)
+	time.Sleep(20 * time.Millisecond)
+	h.expireChallenges()
+	assert.Empty(t, h.challenges)
+	assert.Equal(t, types.ChallengeCanceledClientEvent, lastMessage[types.ChallengeMsgOut](t, b).Type)
+}
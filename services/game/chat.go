@@ -0,0 +1,150 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrEmptyChatMessage   = errors.New("chat message is empty")
+	ErrChatMessageTooLong = errors.New("chat message is too long")
+	ErrChatRateLimited    = errors.New("you're sending messages too fast")
+	ErrMuteYourself       = errors.New("you can't mute yourself")
+)
+
+const (
+	maxChatMessageLength = 200
+	// Messages a user can send in chatRateWindow
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+)
+
+// Cleans chat messages before they're sent, like hiding offensive words
+type ProfanityFilter interface {
+	Clean(text string) string
+}
+
+// Hides the banned words behind asterisks, whatever their case
+type wordFilter struct {
+	words map[string]bool
+}
+
+func NewWordFilter(words ...string) ProfanityFilter {
+	f := &wordFilter{words: map[string]bool{}}
+	for _, word := range words {
+		f.words[strings.ToLower(word)] = true
+	}
+	return f
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (f *wordFilter) Clean(text string) string {
+	if len(f.words) == 0 {
+		return text
+	}
+
+	var cleaned strings.Builder
+	word := []rune{}
+	flush := func() {
+		if f.words[strings.ToLower(string(word))] {
+			cleaned.WriteString(strings.Repeat("*", len(word)))
+		} else {
+			cleaned.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if isWordRune(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		cleaned.WriteRune(r)
+	}
+	flush()
+	return cleaned.String()
+}
+
+// Moderates the chats of the games: limits how fast users write, filters
+// the messages and keeps who muted whom. It's only used from the game
+// handler's loop.
+type Chat struct {
+	filter ProfanityFilter
+	sent   map[primitive.ObjectID][]time.Time // Recent messages of each user
+	muted  map[primitive.ObjectID]map[primitive.ObjectID]bool
+	now    func() time.Time
+}
+
+// Messages aren't filtered if filter is nil
+func NewChat(filter ProfanityFilter) *Chat {
+	return &Chat{
+		filter: filter,
+		sent:   map[primitive.ObjectID][]time.Time{},
+		muted:  map[primitive.ObjectID]map[primitive.ObjectID]bool{},
+		now:    time.Now,
+	}
+}
+
+// Check if the user can send another message and count it
+func (c *Chat) allow(userId primitive.ObjectID) error {
+	now := c.now()
+	recent := c.sent[userId][:0]
+	for _, sentAt := range c.sent[userId] {
+		if now.Sub(sentAt) < chatRateWindow {
+			recent = append(recent, sentAt)
+		}
+	}
+	if len(recent) >= chatRateLimit {
+		c.sent[userId] = recent
+		return ErrChatRateLimited
+	}
+	c.sent[userId] = append(recent, now)
+	return nil
+}
+
+// Check the message of the user and return it as it's sent to the room
+func (c *Chat) Prepare(userId primitive.ObjectID, text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrEmptyChatMessage
+	}
+	if utf8.RuneCountInString(text) > maxChatMessageLength {
+		return "", ErrChatMessageTooLong
+	}
+	if err := c.allow(userId); err != nil {
+		return "", err
+	}
+	if c.filter != nil {
+		text = c.filter.Clean(text)
+	}
+	return text, nil
+}
+
+// Stop sending the messages of mutedId to userId
+func (c *Chat) Mute(userId, mutedId primitive.ObjectID) error {
+	if userId == mutedId {
+		return ErrMuteYourself
+	}
+	if c.muted[userId] == nil {
+		c.muted[userId] = map[primitive.ObjectID]bool{}
+	}
+	c.muted[userId][mutedId] = true
+	return nil
+}
+
+func (c *Chat) Unmute(userId, mutedId primitive.ObjectID) {
+	delete(c.muted[userId], mutedId)
+}
+
+// Check if userId muted senderId
+func (c *Chat) IsMuted(userId, senderId primitive.ObjectID) bool {
+	return c.muted[userId][senderId]
+}
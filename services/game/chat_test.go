@@ -0,0 +1,133 @@
+package game
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWordFilter(t *testing.T) {
+	f := NewWordFilter("darn", "Heck")
+	assert.Equal(t, "**** it, what the ****!", f.Clean("Darn it, what the heck!"))
+	assert.Equal(t, "darnation", f.Clean("darnation"))
+	assert.Equal(t, "good game", NewWordFilter().Clean("good game"))
+}
+
+func TestChatPrepare(t *testing.T) {
+	c := NewChat(NewWordFilter("darn"))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	userId := primitive.NewObjectID()
+
+	text, err := c.Prepare(userId, "  oh darn  ")
+	assert.Nil(t, err)
+	assert.Equal(t, "oh ****", text)
+
+	_, err = c.Prepare(userId, "   ")
+	assert.ErrorIs(t, err, ErrEmptyChatMessage)
+	_, err = c.Prepare(userId, strings.Repeat("a", maxChatMessageLength+1))
+	assert.ErrorIs(t, err, ErrChatMessageTooLong)
+
+	for i := 1; i < chatRateLimit; i++ {
+		_, err = c.Prepare(userId, "hi")
+		assert.Nil(t, err)
+	}
+	_, err = c.Prepare(userId, "hi")
+	assert.ErrorIs(t, err, ErrChatRateLimited)
+	_, err = c.Prepare(primitive.NewObjectID(), "hi")
+	assert.Nil(t, err)
+
+	now = now.Add(chatRateWindow)
+	_, err = c.Prepare(userId, "hi")
+	assert.Nil(t, err)
+}
+
+func TestChatMute(t *testing.T) {
+	c := NewChat(nil)
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	assert.ErrorIs(t, c.Mute(a, a), ErrMuteYourself)
+
+	assert.Nil(t, c.Mute(a, b))
+	assert.True(t, c.IsMuted(a, b))
+	assert.False(t, c.IsMuted(b, a))
+	c.Unmute(a, b)
+	assert.False(t, c.IsMuted(a, b))
+}
+
+// Keeps the chat reports saved through it
+type reportStorage struct {
+	storage.Storage
+	reports []*types.ChatReport
+}
+
+func (s *reportStorage) InsertChatReport(ctx context.Context, report *types.ChatReport) error {
+	s.reports = append(s.reports, report)
+	return nil
+}
+
+// Return the chat messages sent to a client
+func chatMessages(c *recordingClient) []types.ChatMessage {
+	messages := []types.ChatMessage{}
+	for _, msg := range c.sent() {
+		if chat, ok := msg.(types.ChatMsgOut); ok {
+			messages = append(messages, chat.Payload)
+		}
+	}
+	return messages
+}
+
+func TestChatRooms(t *testing.T) {
+	db := &reportStorage{Storage: storage.NewMemoryStorage()}
+	h := NewGameHandler(NewMatchmaker(), NewChat(NewWordFilter("darn")), db, nil, 0, nil).(*gameHandler)
+	a := newRecordingClient()
+	b := newRecordingClient()
+	s := newRecordingClient()
+	for _, c := range []*recordingClient{a, b, s} {
+		h.handleRegister(c, auth.NewAnonymousUser())
+	}
+	game := NewOnlineGame(h.storage, nil, h.players.Get(a), h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(time.Minute)})
+	h.handleWatch(s, game.Id)
+
+	h.handleChat(a, "darn, good luck")
+	assert.Len(t, chatMessages(a), 1)
+	assert.Len(t, chatMessages(s), 0)
+	received := chatMessages(b)
+	assert.Len(t, received, 1)
+	assert.Equal(t, "****, good luck", received[0].Text)
+	assert.Equal(t, types.PlayersRoom, received[0].Room)
+
+	h.handleChat(s, "nice opening")
+	assert.Len(t, chatMessages(s), 1)
+	assert.Equal(t, types.SpectatorsRoom, chatMessages(s)[0].Room)
+	assert.Len(t, chatMessages(b), 1)
+
+	aId := h.players.Get(a).user.GetId()
+	h.handleMute(b, aId)
+	h.handleChat(a, "are you there?")
+	assert.Len(t, chatMessages(a), 2)
+	assert.Len(t, chatMessages(b), 1)
+
+	h.handleReport(b, aId, "rude")
+	assert.Len(t, db.reports, 1)
+	assert.Equal(t, game.Id, db.reports[0].GameId)
+	assert.Equal(t, h.players.Get(b).user.GetId(), db.reports[0].ReporterId)
+	assert.Len(t, db.reports[0].Messages, 2)
+
+	// The transcript of both rooms is saved with the game
+	assert.Nil(t, game.Exit(h.players.Get(a)))
+	record, err := db.GetGameById(context.Background(), game.Id)
+	assert.Nil(t, err)
+	assert.Len(t, record.Chat, 3)
+
+	// Chatting needs a game
+	h.handleChat(a, "gg")
+	assert.Len(t, chatMessages(a), 2)
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/sina-am/chess/chess"
 	"github.com/sina-am/chess/services/auth"
 	"github.com/sina-am/chess/types"
 )
@@ -17,6 +20,14 @@ var (
 	ErrInvalidPayload = errors.New("invalid payload")
 )
 
+const (
+	// How often the connection is pinged to measure the lag
+	pingInterval = 5 * time.Second
+	writeWait    = time.Second
+	// Weight of the last measure in the estimated lag
+	lagEstimateWeight = 0.3
+)
+
 type message struct {
 	Type    types.ServerEventType `json:"type"`
 	Payload json.RawMessage
@@ -35,9 +46,16 @@ type WSClient struct {
 	send  chan any
 	err   chan error
 	close chan error
+	// Closed once writeConn stops, so nothing waits on a dead connection
+	done chan struct{}
 
 	gameHandler GameHandler
 	msgHandler  map[types.ServerEventType]func(message) error
+
+	// Unix time in nanoseconds of the last ping and the estimated one way
+	// delay, read by the game handler
+	pingSentAt atomic.Int64
+	lag        atomic.Int64
 }
 
 func NewWSClient(conn *websocket.Conn, gamHandler GameHandler, user auth.User) *WSClient {
@@ -48,6 +66,7 @@ func NewWSClient(conn *websocket.Conn, gamHandler GameHandler, user auth.User) *
 		send:        make(chan any),
 		err:         make(chan error),
 		close:       make(chan error),
+		done:        make(chan struct{}),
 	}
 	client.msgHandler = map[types.ServerEventType]func(message) error{
 		types.StartServerEvent:        client.handleStart,
@@ -55,7 +74,28 @@ func NewWSClient(conn *websocket.Conn, gamHandler GameHandler, user auth.User) *
 		types.ExitServerEvent:         client.handleExit,
 		types.OfferDrawServerEvent:    client.handleOfferDraw,
 		types.ResponseDrawServerEvent: client.handleRespondDraw,
+		types.ClaimDrawServerEvent:    client.handleClaimDraw,
+
+		types.OfferTakebackServerEvent:    client.handleOfferTakeback,
+		types.ResponseTakebackServerEvent: client.handleRespondTakeback,
+
+		types.WatchServerEvent:   client.handleWatch,
+		types.UnwatchServerEvent: client.handleUnwatch,
+
+		types.ChatServerEvent:   client.handleChat,
+		types.MuteServerEvent:   client.handleMute,
+		types.UnmuteServerEvent: client.handleUnmute,
+		types.ReportServerEvent: client.handleReport,
+
+		types.OfferRematchServerEvent:    client.handleOfferRematch,
+		types.ResponseRematchServerEvent: client.handleRespondRematch,
+
+		types.ChallengeServerEvent:        client.handleChallenge,
+		types.AcceptChallengeServerEvent:  client.handleAcceptChallenge,
+		types.DeclineChallengeServerEvent: client.handleDeclineChallenge,
+		types.CancelChallengeServerEvent:  client.handleCancelChallenge,
 	}
+	conn.SetPongHandler(client.handlePong)
 	return client
 }
 
@@ -63,12 +103,43 @@ func (p *WSClient) Close() {
 	close(p.send)
 }
 
+// Messages to a connection which can't be written anymore are dropped
 func (p *WSClient) Send(msg any) {
-	p.send <- msg
+	select {
+	case p.send <- msg:
+	case <-p.done:
+	}
 }
 
 func (p *WSClient) SendErr(err error) {
-	p.err <- err
+	select {
+	case p.err <- err:
+	case <-p.done:
+	}
+}
+
+// Return the estimated time a message takes to reach the player
+func (p *WSClient) Lag() time.Duration {
+	return time.Duration(p.lag.Load())
+}
+
+// Update the lag with half the round trip of the last ping
+func (p *WSClient) handlePong(string) error {
+	sentAt := p.pingSentAt.Load()
+	if sentAt == 0 {
+		return nil
+	}
+	lag := time.Since(time.Unix(0, sentAt)) / 2
+	if previous := p.Lag(); previous > 0 {
+		lag = time.Duration(lagEstimateWeight*float64(lag) + (1-lagEstimateWeight)*float64(previous))
+	}
+	p.lag.Store(int64(lag))
+	return nil
+}
+
+func (p *WSClient) ping() error {
+	p.pingSentAt.Store(time.Now().UnixNano())
+	return p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
 }
 
 func (p *WSClient) StartLoop(ctx context.Context) {
@@ -90,24 +161,36 @@ func (p *WSClient) readConn(ctx context.Context) {
 				break
 			}
 			log.Printf("websocket error: %v", err)
-			p.err <- err
+			p.SendErr(err)
 			break
 		}
 
 		if err := p.handleMessage(msg); err != nil {
-			p.err <- err
+			p.SendErr(err)
 			continue
 		}
 	}
 }
 
 func (p *WSClient) writeConn(ctx context.Context) {
+	ticker := time.NewTicker(pingInterval)
 	defer func() {
+		ticker.Stop()
+		close(p.done)
+		// Stop reading too, so the player is unregistered
+		p.conn.Close()
 		log.Printf("Go routine exited")
 	}()
 
+	if err := p.ping(); err != nil {
+		return
+	}
 	for {
 		select {
+		case <-ticker.C:
+			if err := p.ping(); err != nil {
+				return
+			}
 		case msg, ok := <-p.send:
 			if !ok {
 				return
@@ -136,27 +219,49 @@ func (p *WSClient) handleMessage(msg message) error {
 	return handler(msg)
 }
 
+// Return the time control given in full, or as the minutes of a game
+// without bonus
+func parseTimeControl(minutes int, msg *types.TimeControlMsg) (chess.TimeControl, error) {
+	tc := chess.SuddenDeath(time.Duration(minutes) * time.Minute)
+	if msg != nil {
+		tc = msg.TimeControl()
+	}
+	if err := tc.Validate(); err != nil {
+		return chess.TimeControl{}, fmt.Errorf("%w: %s", ErrInvalidPayload, err)
+	}
+	return tc, nil
+}
+
 func (p *WSClient) handleStart(msg message) error {
 	payload := types.StartGameMsgIn{}
 	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
 		return ErrInvalidPayload
 	}
 
-	duration := 0 * time.Minute
-	switch payload.Duration {
-	case 10:
-		duration = 10 * time.Minute
-	case 5:
-		duration = 5 * time.Minute
-	case 3:
-		duration = 3 * time.Minute
-	case 1:
-		duration = 1 * time.Minute
+	tc, err := parseTimeControl(payload.Duration, payload.TimeControl)
+	if err != nil {
+		return err
+	}
+
+	gs := GameSetting{TimeControl: tc}
+	switch payload.Opponent {
+	case "", types.HumanOpponent:
+	case types.ComputerOpponent:
+		gs.Computer = true
+		gs.Level = chess.Level(payload.Level)
+		if payload.Level == 0 {
+			gs.Level = defaultComputerLevel
+		}
+		if gs.Level < chess.MinLevel || gs.Level > chess.MaxLevel {
+			return ErrInvalidPayload
+		}
+	case types.EngineOpponent:
+		gs.Computer, gs.Engine = true, true
 	default:
 		return ErrInvalidPayload
 	}
 
-	p.gameHandler.AddToWaitList(p, GameSetting{Duration: duration})
+	p.gameHandler.AddToWaitList(p, gs)
 	return nil
 }
 
@@ -165,7 +270,20 @@ func (p *WSClient) handlePlay(msg message) error {
 	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
 		return err
 	}
-	p.gameHandler.Play(p, payload.Move)
+
+	switch {
+	case payload.SAN != "":
+		// SAN depends on the position, so it's decoded by the game itself
+		p.gameHandler.PlaySAN(p, payload.SAN)
+	case payload.UCI != "":
+		move, err := chess.ParseUCI(payload.UCI)
+		if err != nil {
+			return err
+		}
+		p.gameHandler.Play(p, move)
+	default:
+		p.gameHandler.Play(p, payload.Move)
+	}
 	return nil
 }
 
@@ -179,6 +297,11 @@ func (p *WSClient) handleOfferDraw(msg message) error {
 	return nil
 }
 
+func (p *WSClient) handleClaimDraw(msg message) error {
+	p.gameHandler.ClaimDraw(p)
+	return nil
+}
+
 type respondDrawMessage struct {
 	Result string
 }
@@ -196,3 +319,123 @@ func (p *WSClient) handleRespondDraw(msg message) error {
 
 	return nil
 }
+
+func (p *WSClient) handleOfferTakeback(msg message) error {
+	p.gameHandler.OfferTakeback(p)
+	return nil
+}
+
+// A takeback is answered with the same payload as a draw offer
+func (p *WSClient) handleRespondTakeback(msg message) error {
+	payload := respondDrawMessage{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return err
+	}
+	p.gameHandler.RespondTakeback(p, payload.Result == "accepted")
+	return nil
+}
+
+func (p *WSClient) handleWatch(msg message) error {
+	payload := types.WatchGameMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.Watch(p, payload.GameId)
+	return nil
+}
+
+func (p *WSClient) handleUnwatch(msg message) error {
+	p.gameHandler.Unwatch(p)
+	return nil
+}
+
+func (p *WSClient) handleChat(msg message) error {
+	payload := types.ChatMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.Chat(p, payload.Text)
+	return nil
+}
+
+func (p *WSClient) handleMute(msg message) error {
+	payload := types.ChatUserMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.Mute(p, payload.UserId)
+	return nil
+}
+
+func (p *WSClient) handleUnmute(msg message) error {
+	payload := types.ChatUserMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.Unmute(p, payload.UserId)
+	return nil
+}
+
+func (p *WSClient) handleReport(msg message) error {
+	payload := types.ChatUserMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.Report(p, payload.UserId, payload.Reason)
+	return nil
+}
+
+func (p *WSClient) handleOfferRematch(msg message) error {
+	p.gameHandler.OfferRematch(p)
+	return nil
+}
+
+// A rematch is answered with the same payload as a draw offer
+func (p *WSClient) handleRespondRematch(msg message) error {
+	payload := respondDrawMessage{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return err
+	}
+	p.gameHandler.RespondRematch(p, payload.Result == "accepted")
+	return nil
+}
+
+func (p *WSClient) handleChallenge(msg message) error {
+	payload := types.ChallengeMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	tc, err := parseTimeControl(payload.Duration, payload.TimeControl)
+	if err != nil {
+		return err
+	}
+	p.gameHandler.Challenge(p, payload.UserId, GameSetting{TimeControl: tc}, payload.Color)
+	return nil
+}
+
+func (p *WSClient) handleAcceptChallenge(msg message) error {
+	payload := types.ChallengeIdMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.AcceptChallenge(p, payload.ChallengeId)
+	return nil
+}
+
+func (p *WSClient) handleDeclineChallenge(msg message) error {
+	payload := types.ChallengeIdMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.DeclineChallenge(p, payload.ChallengeId)
+	return nil
+}
+
+func (p *WSClient) handleCancelChallenge(msg message) error {
+	payload := types.ChallengeIdMsgIn{}
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		return ErrInvalidPayload
+	}
+	p.gameHandler.CancelChallenge(p, payload.ChallengeId)
+	return nil
+}
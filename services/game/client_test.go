@@ -112,3 +112,21 @@ func TestStartGame(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestClientSendAfterWriterStopped(t *testing.T) {
+	p := &WSClient{send: make(chan any), err: make(chan error), done: make(chan struct{})}
+	close(p.done)
+
+	// Nothing reads the channels anymore, the messages are dropped
+	sent := make(chan struct{})
+	go func() {
+		p.Send(map[string]string{"type": "clock"})
+		p.SendErr(fmt.Errorf("error"))
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("sending to a stopped writer blocked")
+	}
+}
@@ -2,31 +2,87 @@ package game
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"time"
 
 	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/storage"
 	"github.com/sina-am/chess/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrNothingToTakeBack = errors.New("you have no move to take back")
+	ErrGameNotFound      = errors.New("no game with this id is being played")
+	ErrNoRematch         = errors.New("you have no game to rematch")
+	ErrOpponentLeft      = errors.New("your opponent has left")
+)
+
+// How often the players get the clocks during a game
+const clockInterval = time.Second
+
+// A game with clocks, which are recorded with each move and sent to the
+// players
+type clock interface {
+	RemainingTime(playerColor chess.Color) time.Duration
+	Clock(playerColor chess.Color) time.Duration
+	SetLag(playerColor chess.Color, lag time.Duration)
+}
+
+// A client that measures the network delay to the player
+type lagger interface {
+	Lag() time.Duration
+}
+
+// Return the network delay to the player, 0 if it isn't measured
+func clientLag(c Client) time.Duration {
+	if l, ok := c.(lagger); ok {
+		return l.Lag()
+	}
+	return 0
+}
+
 type OnlineGame struct {
-	Storage storage.Storage
-	Players map[chess.Color]*onlinePlayer
-	Game    chess.Chess
+	Id       primitive.ObjectID
+	Storage  storage.Storage
+	Analyzer *Analyzer // Analyzes the game once it ends, if set
+	Players  map[chess.Color]*onlinePlayer
+	Game     chess.Chess
 
-	drawOffered *onlinePlayer
+	// Clients following the game without playing it
+	spectators map[*onlinePlayer]bool
+
+	drawOffered     *onlinePlayer
+	takebackOffered *onlinePlayer
+	rematchOffered  *onlinePlayer // Once the game has ended
+
+	setting   GameSetting
+	startedAt time.Time
+	moves     []types.GameMove
+	chat      []types.ChatMessage // Transcript of both rooms
 }
 
-func NewOnlineGame(s storage.Storage, p1, p2 *onlinePlayer, duration time.Duration) *OnlineGame {
+func NewOnlineGame(s storage.Storage, analyzer *Analyzer, p1, p2 *onlinePlayer, gs GameSetting) *OnlineGame {
+	tc := gs.TimeControl
 	game := &OnlineGame{
-		Storage: s,
+		Id:       primitive.NewObjectID(),
+		Storage:  s,
+		Analyzer: analyzer,
 		Players: map[chess.Color]*onlinePlayer{
 			chess.White: p1,
 			chess.Black: p2,
 		},
-		Game: chess.NewSession(duration),
+		Game:       chess.NewSession(tc),
+		spectators: map[*onlinePlayer]bool{},
+
+		setting:   gs,
+		startedAt: time.Now(),
+		moves:     []types.GameMove{},
+		chat:      []types.ChatMessage{},
 	}
 
 	p1.currentGame = game
@@ -38,15 +94,19 @@ func NewOnlineGame(s storage.Storage, p1, p2 *onlinePlayer, duration time.Durati
 	p1.client.Send(types.StartGameMsgOut{
 		Type: types.StartedClientEvent,
 		Payload: types.StartGamePayloadMsgOut{
-			You:      types.Player{UserId: primitive.NilObjectID, Name: p1.user.GetName(), Color: chess.White},
-			Opponent: types.Player{UserId: primitive.NilObjectID, Name: p2.user.GetName(), Color: chess.Black},
+			You:         types.Player{UserId: primitive.NilObjectID, Name: p1.user.GetName(), Color: chess.White},
+			Opponent:    types.Player{UserId: primitive.NilObjectID, Name: p2.user.GetName(), Color: chess.Black},
+			TimeControl: types.NewTimeControlMsg(tc),
+			Clock:       game.clockMsg(p1),
 		},
 	})
 	p2.client.Send(types.StartGameMsgOut{
 		Type: types.StartedClientEvent,
 		Payload: types.StartGamePayloadMsgOut{
-			You:      types.Player{UserId: primitive.NilObjectID, Name: p2.user.GetName(), Color: chess.Black},
-			Opponent: types.Player{UserId: primitive.NilObjectID, Name: p1.user.GetName(), Color: chess.White},
+			You:         types.Player{UserId: primitive.NilObjectID, Name: p2.user.GetName(), Color: chess.Black},
+			Opponent:    types.Player{UserId: primitive.NilObjectID, Name: p1.user.GetName(), Color: chess.White},
+			TimeControl: types.NewTimeControlMsg(tc),
+			Clock:       game.clockMsg(p2),
 		},
 	})
 
@@ -62,28 +122,207 @@ func (g *OnlineGame) getPlayerColor(p *onlinePlayer) (chess.Color, error) {
 	return chess.Empty, fmt.Errorf("user is not in the game")
 }
 
+// Return the clocks as the player will see them when the message arrives,
+// nil if the game has no clock
+func (g *OnlineGame) clockMsg(p *onlinePlayer) *types.ClockMsg {
+	c, ok := g.Game.(clock)
+	if !ok {
+		return nil
+	}
+
+	lag := clientLag(p.client)
+	turn := g.Game.GetTurn()
+	clocks := map[chess.Color]time.Duration{
+		chess.White: c.Clock(chess.White),
+		chess.Black: c.Clock(chess.Black),
+	}
+	clocks[turn] = max(clocks[turn]-lag, 0)
+	return &types.ClockMsg{
+		White:      clocks[chess.White].Milliseconds(),
+		Black:      clocks[chess.Black].Milliseconds(),
+		Turn:       turn,
+		Lag:        lag.Milliseconds(),
+		ServerTime: time.Now().UnixMilli(),
+	}
+}
+
+// Send the clocks to the player
+func (g *OnlineGame) SendClock(p *onlinePlayer) {
+	if msg := g.clockMsg(p); msg != nil {
+		p.client.Send(types.ClockMsgOut{Type: types.ClockClientEvent, Payload: *msg})
+	}
+}
+
+// Send the player the state of the game after reconnecting, and tell the
+// opponent the player is back
+func (g *OnlineGame) Resume(p *onlinePlayer) error {
+	color, err := g.getPlayerColor(p)
+	if err != nil {
+		return err
+	}
+	opponent := g.Players[color.OppositeColor()]
+
+	p.client.Send(types.ResumeGameMsgOut{
+		Type: types.ResumedClientEvent,
+		Payload: types.ResumeGamePayloadMsgOut{
+			You:         types.Player{UserId: primitive.NilObjectID, Name: p.user.GetName(), Color: color},
+			Opponent:    types.Player{UserId: primitive.NilObjectID, Name: opponent.user.GetName(), Color: color.OppositeColor()},
+			TimeControl: types.NewTimeControlMsg(g.setting.TimeControl),
+			FEN:         g.Game.FEN(),
+			Moves:       g.moves,
+			Clock:       g.clockMsg(p),
+			LegalMoves:  g.Game.LegalMoves(),
+		},
+	})
+	opponent.client.Send(map[string]string{
+		"type": string(types.OpponentReconnectedClientEvent),
+	})
+	return nil
+}
+
+// Return the game as listed to the players looking for one to watch
+func (g *OnlineGame) Live() types.LiveGame {
+	return types.LiveGame{
+		Id:          g.Id,
+		White:       recordPlayer(g.Players[chess.White], chess.White),
+		Black:       recordPlayer(g.Players[chess.Black], chess.Black),
+		TimeControl: g.setting.TimeControl.String(),
+		Moves:       len(g.moves),
+		Spectators:  len(g.spectators),
+		StartedAt:   g.startedAt,
+	}
+}
+
+// Start sending the game to the spectator, beginning with its state
+func (g *OnlineGame) AddSpectator(s *onlinePlayer) {
+	g.spectators[s] = true
+	s.watching = g
+	s.status = StatusWatching
+
+	s.client.Send(types.WatchGameMsgOut{
+		Type: types.WatchingClientEvent,
+		Payload: types.WatchGamePayloadMsgOut{
+			GameId:      g.Id,
+			White:       recordPlayer(g.Players[chess.White], chess.White),
+			Black:       recordPlayer(g.Players[chess.Black], chess.Black),
+			TimeControl: types.NewTimeControlMsg(g.setting.TimeControl),
+			FEN:         g.Game.FEN(),
+			Moves:       g.moves,
+			Clock:       g.clockMsg(s),
+			Spectators:  len(g.spectators),
+		},
+	})
+	g.sendSpectatorCount()
+}
+
+func (g *OnlineGame) RemoveSpectator(s *onlinePlayer) {
+	if !g.spectators[s] {
+		return
+	}
+	delete(g.spectators, s)
+	s.watching = nil
+	s.status = StatusConnected
+	g.sendSpectatorCount()
+}
+
+// Tell the players and spectators how many are watching
+func (g *OnlineGame) sendSpectatorCount() {
+	msg := types.SpectatorsMsgOut{
+		Type:    types.SpectatorsClientEvent,
+		Payload: types.SpectatorsPayloadMsgOut{Count: len(g.spectators)},
+	}
+	for _, p := range g.audience() {
+		p.client.Send(msg)
+	}
+}
+
+// Return the players and the spectators of the game
+func (g *OnlineGame) audience() []*onlinePlayer {
+	audience := []*onlinePlayer{g.Players[chess.White], g.Players[chess.Black]}
+	for s := range g.spectators {
+		audience = append(audience, s)
+	}
+	return audience
+}
+
+// Return the room the player or spectator chats in
+func (g *OnlineGame) chatRoomOf(p *onlinePlayer) types.ChatRoom {
+	if _, err := g.getPlayerColor(p); err == nil {
+		return types.PlayersRoom
+	}
+	return types.SpectatorsRoom
+}
+
+// Return the clients in the chat room
+func (g *OnlineGame) chatMembers(room types.ChatRoom) []*onlinePlayer {
+	if room == types.PlayersRoom {
+		return []*onlinePlayer{g.Players[chess.White], g.Players[chess.Black]}
+	}
+	members := []*onlinePlayer{}
+	for s := range g.spectators {
+		members = append(members, s)
+	}
+	return members
+}
+
+// Return the messages the user sent in the game
+func (g *OnlineGame) chatMessagesOf(userId primitive.ObjectID) []types.ChatMessage {
+	messages := []types.ChatMessage{}
+	for _, msg := range g.chat {
+		if msg.UserId == userId {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
 func (g *OnlineGame) Play(p *onlinePlayer, move chess.Move) error {
 	color, err := g.getPlayerColor(p)
 	if err != nil {
 		return err
 	}
+	// The move was made before it reached the server
+	if c, ok := g.Game.(clock); ok {
+		c.SetLag(color, clientLag(p.client))
+	}
 
+	// SAN depends on the position before the move. If the move turns out
+	// to be illegal Play reports why, so the error here can be ignored.
+	san, _ := g.Game.SAN(move)
 	if err := g.Game.Play(color, move); err != nil {
+		// The flag fell before the move, the game is over on time
+		if result := g.Game.GetResult(); result != chess.NoResult {
+			return g.endGame(result)
+		}
 		p.client.SendErr(err)
 		return err
 	}
+	g.takebackOffered = nil
 
-	msg := types.PlayGameMsgOut{
-		Type: types.PlayedClientEvent,
-		Payload: types.PlayGamePayloadMsgOut{
-			Player: p.user.GetId(),
-			Move:   move,
-		},
+	record := types.GameMove{UCI: move.UCI(), SAN: san}
+	if c, ok := g.Game.(clock); ok {
+		record.Clock = c.RemainingTime(color).Milliseconds()
 	}
-	for _, pl := range g.Players {
-		if p != pl {
-			pl.client.Send(msg)
+	g.moves = append(g.moves, record)
+
+	legalMoves := g.Game.LegalMoves()
+	for _, pl := range g.audience() {
+		if p == pl {
+			g.SendClock(pl)
+			continue
 		}
+		pl.client.Send(types.PlayGameMsgOut{
+			Type: types.PlayedClientEvent,
+			Payload: types.PlayGamePayloadMsgOut{
+				Player: p.user.GetId(),
+				Move:   move,
+				SAN:    san,
+				UCI:    move.UCI(),
+
+				LegalMoves: legalMoves,
+				Clock:      g.clockMsg(pl),
+			},
+		})
 	}
 
 	if result := g.Game.GetResult(); result != chess.NoResult {
@@ -120,6 +359,91 @@ func (g *OnlineGame) RespondDraw(p *onlinePlayer, accepted bool) {
 	g.endGame(chess.Result{Reason: chess.Draw, WinnerColor: chess.Empty})
 }
 
+// Return how many plies a takeback asked by the given color undoes. The player's
+// last move is taken back along with the opponent's reply if there is one.
+func (g *OnlineGame) takebackPlies(color chess.Color) int {
+	if g.Game.GetTurn() == color {
+		return 2
+	}
+	return 1
+}
+
+func (g *OnlineGame) OfferTakeback(p *onlinePlayer) error {
+	color, err := g.getPlayerColor(p)
+	if err != nil {
+		return err
+	}
+	if len(g.Game.History()) < g.takebackPlies(color) {
+		p.client.SendErr(ErrNothingToTakeBack)
+		return ErrNothingToTakeBack
+	}
+
+	g.takebackOffered = p
+	opponent, _ := g.GetOpponentPlayer(p)
+	opponent.client.Send(map[string]string{
+		"type": string(types.TakebackOfferedClientEvent),
+	})
+	return nil
+}
+
+func (g *OnlineGame) RespondTakeback(p *onlinePlayer, accepted bool) error {
+	opponent, err := g.GetOpponentPlayer(p)
+	if err != nil {
+		return err
+	}
+	if g.takebackOffered != opponent {
+		return nil
+	}
+
+	g.takebackOffered = nil
+	if !accepted {
+		opponent.client.Send(map[string]any{
+			"type": "respondTakeback",
+			"payload": map[string]string{
+				"result": "rejected",
+			},
+		})
+		return nil
+	}
+
+	color, _ := g.getPlayerColor(opponent)
+	plies := g.takebackPlies(color)
+	for i := 0; i < plies; i++ {
+		if err := g.Game.Undo(); err != nil {
+			return err
+		}
+		g.moves = g.moves[:len(g.moves)-1]
+	}
+
+	legalMoves := g.Game.LegalMoves()
+	for _, pl := range g.audience() {
+		pl.client.Send(types.TakenBackMsgOut{
+			Type: types.TakenBackClientEvent,
+			Payload: types.TakenBackPayloadMsgOut{
+				Plies:      plies,
+				LegalMoves: legalMoves,
+				Clock:      g.clockMsg(pl),
+			},
+		})
+	}
+	return nil
+}
+
+func (g *OnlineGame) ClaimDraw(p *onlinePlayer) error {
+	color, err := g.getPlayerColor(p)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Game.ClaimDraw(color); err != nil {
+		p.client.SendErr(err)
+		return err
+	}
+	result := g.Game.GetResult()
+	g.Game.Exit()
+	return g.endGame(result)
+}
+
 func (g *OnlineGame) Exit(p *onlinePlayer) error {
 	color, err := g.getPlayerColor(p)
 	if err != nil {
@@ -133,37 +457,125 @@ func (g *OnlineGame) Exit(p *onlinePlayer) error {
 	})
 }
 
+// Return the first player's score in a game with the given winner
+func gameScore(winner chess.Color, first chess.Color) float64 {
+	switch winner {
+	case first:
+		return 1
+	case first.OppositeColor():
+		return 0
+	}
+	return 0.5
+}
+
+// Update the ratings of both players if they're registered and return the
+// changes by color, nil if the game is unrated
+func (g *OnlineGame) rate(gameId primitive.ObjectID, result chess.Result) (map[chess.Color]*types.RatingChange, error) {
+	white, black := g.Players[chess.White].user, g.Players[chess.Black].user
+	if !white.IsAuthenticated() || !black.IsAuthenticated() {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	whiteUser, err := g.Storage.GetUserById(ctx, white.GetId())
+	if err != nil {
+		return nil, err
+	}
+	blackUser, err := g.Storage.GetUserById(ctx, black.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	category := rating.CategoryOf(g.setting.TimeControl.Estimated())
+	whiteBefore, blackBefore := whiteUser.Rating(category), blackUser.Rating(category)
+	whiteAfter, blackAfter := rating.Game(whiteBefore, blackBefore, gameScore(result.WinnerColor, chess.White))
+
+	now := time.Now()
+	changes := map[chess.Color]*types.RatingChange{
+		chess.White: {UserId: whiteUser.Id, GameId: gameId, Category: category, Before: whiteBefore, After: whiteAfter, Time: now},
+		chess.Black: {UserId: blackUser.Id, GameId: gameId, Category: category, Before: blackBefore, After: blackAfter, Time: now},
+	}
+	if err := g.Storage.ApplyRatingChanges(ctx, []*types.RatingChange{changes[chess.White], changes[chess.Black]}); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 func (g *OnlineGame) endGame(result chess.Result) error {
-	for _, p := range g.Players {
+	gameId := g.Id
+	changes, err := g.rate(gameId, result)
+	if err != nil {
+		log.Printf("rating game %s: %s", gameId.Hex(), err.Error())
+	}
+
+	for color, p := range g.Players {
+		payload := types.EndGamePayloadMsgOut{
+			GameId: gameId,
+			Winner: result.WinnerColor,
+			Reason: result.Reason,
+		}
+		if change, ok := changes[color]; ok {
+			payload.Score = change.Delta()
+			payload.Rating = int(math.Round(change.After.Rating))
+		}
 		p.client.Send(types.EndGameMsgOut{
-			Type: types.EndGameClientEvent,
-			Payload: types.EndGamePayloadMsgOut{
-				Winner: result.WinnerColor,
-				Score:  10,
-				Reason: result.Reason,
-			},
+			Type:    types.EndGameClientEvent,
+			Payload: payload,
 		})
 		p.currentGame = nil
+		p.lastGame = g
 		p.status = StatusConnected
 	}
+	for s := range g.spectators {
+		s.client.Send(types.EndGameMsgOut{
+			Type:    types.EndGameClientEvent,
+			Payload: types.EndGamePayloadMsgOut{GameId: gameId, Winner: result.WinnerColor, Reason: result.Reason},
+		})
+		s.watching = nil
+		s.status = StatusConnected
+	}
+	clear(g.spectators)
+
+	if history := g.Game.History(); g.Analyzer != nil && len(history) > 0 {
+		moves := make([]chess.Move, len(history))
+		for i, entry := range history {
+			moves[i] = entry.Move
+		}
+		if err := g.Analyzer.Enqueue(gameId, chess.StartingFEN, moves); err != nil {
+			log.Printf("analysis of game %s: %s", gameId.Hex(), err.Error())
+		}
+	}
 
 	player1 := g.Players[chess.White]
 	player2 := g.Players[chess.Black]
 
-	if player1.user.IsAuthenticated() && player2.user.IsAuthenticated() {
-		game := types.Game{
-			Id: primitive.NewObjectID(),
-			Players: []types.Player{
-				{UserId: player1.user.GetId(), Color: chess.White},
-				{UserId: player2.user.GetId(), Color: chess.Black},
-			},
-			Winner: result.WinnerColor.String(),
-			Reason: string(result.Reason),
-		}
-		ctx := context.Background()
-		return g.Storage.InsertGame(ctx, &game)
+	game := types.Game{
+		Id: gameId,
+		Players: []types.Player{
+			recordPlayer(player1, chess.White),
+			recordPlayer(player2, chess.Black),
+		},
+		Winner:      result.WinnerColor.String(),
+		Reason:      string(result.Reason),
+		InitialFEN:  chess.StartingFEN,
+		TimeControl: g.setting.TimeControl.String(),
+		Rated:       changes != nil,
+		Moves:       g.moves,
+		StartedAt:   g.startedAt,
+		EndedAt:     time.Now(),
+		Chat:        g.chat,
+	}
+	ctx := context.Background()
+	return g.Storage.InsertGame(ctx, &game)
+}
+
+func recordPlayer(p *onlinePlayer, color chess.Color) types.Player {
+	return types.Player{
+		UserId:    p.user.GetId(),
+		Name:      p.user.GetName(),
+		Color:     color,
+		Anonymous: !p.user.IsAuthenticated(),
 	}
-	return nil
 }
 
 func (g *OnlineGame) GetOpponentPlayer(p *onlinePlayer) (*onlinePlayer, error) {
@@ -0,0 +1,449 @@
+package game
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEndGameSavesGuestGames(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	white := &onlinePlayer{client: newRecordingClient(), user: auth.NewAnonymousUser()}
+	black := &onlinePlayer{client: newRecordingClient(), user: auth.NewAnonymousUser()}
+	game := NewOnlineGame(db, nil, white, black, GameSetting{TimeControl: chess.SuddenDeath(time.Minute)})
+
+	move, _ := chess.ParseUCI("e2e4")
+	assert.Nil(t, game.Play(white, move))
+	assert.Nil(t, game.Exit(black))
+
+	games, err := db.ListGamesByUser(context.Background(), white.user.GetId(), storage.Page{})
+	assert.Nil(t, err)
+	assert.Len(t, games, 1)
+	record := games[0]
+	assert.Equal(t, string(chess.Abandoned), record.Reason)
+	assert.Equal(t, "1+0", record.TimeControl)
+	assert.Equal(t, []types.Player{
+		{UserId: white.user.GetId(), Name: "anonymous", Color: chess.White, Anonymous: true},
+		{UserId: black.user.GetId(), Name: "anonymous", Color: chess.Black, Anonymous: true},
+	}, record.Players)
+	assert.Len(t, record.Moves, 1)
+	assert.Equal(t, "e4", record.Moves[0].SAN)
+	assert.Greater(t, record.Moves[0].Clock, int64(0))
+	assert.False(t, record.Rated)
+	assert.LessOrEqual(t, record.Moves[0].Clock, time.Minute.Milliseconds())
+}
+
+// A client which keeps the messages sent to it. Messages are sent from the
+// game handler's loop, so they're read behind mu.
+type recordingClient struct {
+	mu       sync.Mutex
+	messages []any
+	lag      time.Duration
+}
+
+func newRecordingClient() *recordingClient {
+	return &recordingClient{}
+}
+
+func (c *recordingClient) Send(msg any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+}
+
+func (c *recordingClient) SendErr(err error) {}
+
+func (c *recordingClient) Close() {}
+
+func (c *recordingClient) Lag() time.Duration {
+	return c.lag
+}
+
+// Return the messages sent to the client so far
+func (c *recordingClient) sent() []any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.messages)
+}
+
+// Return the ended message sent to a client
+func endedMessage(t *testing.T, c *recordingClient) types.EndGamePayloadMsgOut {
+	t.Helper()
+	for _, msg := range c.sent() {
+		if ended, ok := msg.(types.EndGameMsgOut); ok {
+			return ended.Payload
+		}
+	}
+	t.Fatal("no ended message")
+	return types.EndGamePayloadMsgOut{}
+}
+
+func TestEndGameRatesPlayers(t *testing.T) {
+	db := storage.NewMemoryStorage()
+	ctx := context.Background()
+	whiteUser := types.NewUser("white@example.com", "white", "password")
+	blackUser := types.NewUser("black@example.com", "black", "password")
+	assert.Nil(t, db.InsertUser(ctx, whiteUser))
+	assert.Nil(t, db.InsertUser(ctx, blackUser))
+	whiteClient, blackClient := newRecordingClient(), newRecordingClient()
+	white := &onlinePlayer{client: whiteClient, user: whiteUser}
+	black := &onlinePlayer{client: blackClient, user: blackUser}
+
+	game := NewOnlineGame(db, nil, white, black, GameSetting{TimeControl: chess.SuddenDeath(5 * time.Minute)})
+	assert.Nil(t, game.Exit(white))
+
+	winner, loser := endedMessage(t, blackClient), endedMessage(t, whiteClient)
+	assert.Greater(t, winner.Score, 0)
+	assert.Equal(t, -winner.Score, loser.Score)
+	assert.Equal(t, rating.DefaultRating+winner.Score, winner.Rating)
+
+	storedWhite, err := db.GetUserById(ctx, whiteUser.Id)
+	assert.Nil(t, err)
+	storedBlack, err := db.GetUserById(ctx, blackUser.Id)
+	assert.Nil(t, err)
+	assert.Greater(t, storedBlack.Rating(rating.Blitz).Rating, float64(rating.DefaultRating))
+	assert.Less(t, storedWhite.Rating(rating.Blitz).Rating, float64(rating.DefaultRating))
+	assert.Equal(t, rating.New(), storedWhite.Rating(rating.Bullet))
+
+	history, err := db.GetRatingHistory(ctx, blackUser.Id, rating.Blitz)
+	assert.Nil(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, winner.Score, history[0].Delta())
+	assert.Equal(t, winner.GameId, history[0].GameId)
+
+	record, err := db.GetGameById(ctx, winner.GameId)
+	assert.Nil(t, err)
+	assert.True(t, record.Rated)
+}
+
+// Return the last message of the given type sent to a client
+func lastMessage[T any](t *testing.T, c *recordingClient) T {
+	t.Helper()
+	messages := c.sent()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if msg, ok := messages[i].(T); ok {
+			return msg
+		}
+	}
+	var msg T
+	t.Fatalf("no %T message", msg)
+	return msg
+}
+
+func TestGameSendsClocks(t *testing.T) {
+	whiteClient, blackClient := &recordingClient{lag: 200 * time.Millisecond}, newRecordingClient()
+	white := &onlinePlayer{client: whiteClient, user: auth.NewAnonymousUser()}
+	black := &onlinePlayer{client: blackClient, user: auth.NewAnonymousUser()}
+	game := NewOnlineGame(storage.NewMemoryStorage(), nil, white, black, GameSetting{TimeControl: chess.SuddenDeath(time.Minute)})
+	defer game.Game.Exit()
+
+	// The clock of the side to move is shown as it will be on arrival
+	started := lastMessage[types.StartGameMsgOut](t, whiteClient).Payload.Clock
+	assert.NotNil(t, started)
+	assert.InDelta(t, 59800, started.White, 50)
+	assert.Equal(t, int64(60000), started.Black)
+	assert.Equal(t, int64(200), started.Lag)
+	assert.Equal(t, chess.White, started.Turn)
+	assert.InDelta(t, time.Now().UnixMilli(), started.ServerTime, 1000)
+
+	// The lag of the mover is given back to its clock
+	time.Sleep(100 * time.Millisecond)
+	move, _ := chess.ParseUCI("e2e4")
+	assert.Nil(t, game.Play(white, move))
+
+	played := lastMessage[types.PlayGameMsgOut](t, blackClient).Payload.Clock
+	assert.NotNil(t, played)
+	assert.Equal(t, int64(60000), played.White)
+	assert.Equal(t, chess.Black, played.Turn)
+	assert.Equal(t, int64(0), played.Lag)
+
+	clock := lastMessage[types.ClockMsgOut](t, whiteClient)
+	assert.Equal(t, types.ClockClientEvent, clock.Type)
+	assert.Equal(t, int64(60000), clock.Payload.White)
+	assert.InDelta(t, 59800, clock.Payload.Black, 50)
+}
+
+func TestTakebackSendsPosition(t *testing.T) {
+	h, game, a, b := newReconnectGame(0)
+	defer game.Game.Exit()
+	white, black := h.players.Get(a), h.players.Get(b)
+	for _, uci := range []string{"e2e4", "e7e5"} {
+		move, _ := chess.ParseUCI(uci)
+		assert.Nil(t, game.Play(game.Players[game.Game.GetTurn()], move))
+	}
+
+	assert.Nil(t, game.OfferTakeback(black))
+	assert.Nil(t, game.RespondTakeback(white, true))
+	taken := lastMessage[types.TakenBackMsgOut](t, a).Payload
+	assert.Equal(t, 1, taken.Plies)
+	assert.Len(t, taken.LegalMoves, 20)
+	assert.NotNil(t, taken.Clock)
+	assert.Equal(t, chess.Black, taken.Clock.Turn)
+	assert.Equal(t, taken.LegalMoves, lastMessage[types.TakenBackMsgOut](t, b).Payload.LegalMoves)
+}
+
+func TestSyncClocksEndsTimedOutGames(t *testing.T) {
+	h := NewGameHandler(NewMatchmaker(), NewChat(nil), storage.NewMemoryStorage(), nil, 0, nil).(*gameHandler)
+	a := newRecordingClient()
+	b := newRecordingClient()
+	h.handleRegister(a, auth.NewAnonymousUser())
+	h.handleRegister(b, auth.NewAnonymousUser())
+
+	game := NewOnlineGame(h.storage, nil, h.players.Get(a), h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(time.Minute)})
+	h.syncClocks()
+	assert.Equal(t, types.ClockClientEvent, lastMessage[types.ClockMsgOut](t, a).Type)
+	assert.Equal(t, types.ClockClientEvent, lastMessage[types.ClockMsgOut](t, b).Type)
+	game.Game.Exit()
+
+	NewOnlineGame(h.storage, nil, h.players.Get(a), h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(10 * time.Millisecond)})
+	time.Sleep(50 * time.Millisecond)
+	h.syncClocks()
+	ended := endedMessage(t, a)
+	assert.Equal(t, chess.Timeout, ended.Reason)
+	assert.Equal(t, chess.Black, ended.Winner)
+	assert.Nil(t, h.players.Get(a).currentGame)
+}
+
+func TestPlayAfterFlagFallEndsGame(t *testing.T) {
+	h, game, a, b := newReconnectGame(0)
+	game.Game.Exit()
+	player := h.players.Get(a)
+	NewOnlineGame(h.storage, nil, player, h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(10 * time.Millisecond)})
+
+	time.Sleep(20 * time.Millisecond)
+	move, _ := chess.ParseUCI("e2e4")
+	h.handlePlayerMove(a, move, "")
+	ended := endedMessage(t, a)
+	assert.Equal(t, chess.Timeout, ended.Reason)
+	assert.Equal(t, chess.Black, ended.Winner)
+	assert.Nil(t, player.currentGame)
+}
+
+// Return a handler with a game between two registered recording clients
+func newReconnectGame(gracePeriod time.Duration) (*gameHandler, *OnlineGame, *recordingClient, *recordingClient) {
+	h := NewGameHandler(NewMatchmaker(), NewChat(nil), storage.NewMemoryStorage(), nil, gracePeriod, nil).(*gameHandler)
+	a := newRecordingClient()
+	b := newRecordingClient()
+	h.handleRegister(a, auth.NewAnonymousUser())
+	h.handleRegister(b, auth.NewAnonymousUser())
+	game := NewOnlineGame(h.storage, nil, h.players.Get(a), h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(time.Minute)})
+	return h, game, a, b
+}
+
+func TestReconnectResumesGame(t *testing.T) {
+	h, game, a, b := newReconnectGame(time.Minute)
+	defer game.Game.Exit()
+	player := h.players.Get(a)
+
+	move, _ := chess.ParseUCI("e2e4")
+	assert.Nil(t, game.Play(player, move))
+
+	h.handleUnregister(a)
+	assert.Nil(t, h.players.Get(a))
+	assert.Equal(t, StatusPlaying, player.status)
+	disconnected := lastMessage[types.OpponentDisconnectedMsgOut](t, b)
+	assert.Equal(t, 60, disconnected.Payload.GracePeriod)
+
+	// The opponent keeps playing while the player is away
+	reply, _ := chess.ParseUCI("e7e5")
+	assert.Nil(t, game.Play(h.players.Get(b), reply))
+
+	c := newRecordingClient()
+	h.handleRegister(c, player.user)
+	assert.Same(t, player, h.players.Get(c))
+	assert.Same(t, game, h.players.Get(c).currentGame)
+	assert.Empty(t, h.disconnected)
+
+	resumed := lastMessage[types.ResumeGameMsgOut](t, c).Payload
+	assert.Equal(t, chess.White, resumed.You.Color)
+	assert.Equal(t, "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2", resumed.FEN)
+	assert.Len(t, resumed.Moves, 2)
+	assert.Equal(t, "e5", resumed.Moves[1].SAN)
+	assert.NotNil(t, resumed.Clock)
+	assert.Len(t, resumed.LegalMoves, 29)
+	assert.Equal(t, string(types.OpponentReconnectedClientEvent), lastMessage[map[string]string](t, b)["type"])
+
+	// Moves of the resumed player are accepted from the new client
+	h.handlePlayerMove(c, chess.Move{}, "Nf3")
+	assert.Len(t, game.moves, 3)
+}
+
+func TestDisconnectedPlayerLosesAfterGracePeriod(t *testing.T) {
+	h, _, a, b := newReconnectGame(10 * time.Millisecond)
+	h.handleUnregister(a)
+
+	h.expireDisconnections()
+	assert.NotNil(t, h.players.Get(b).currentGame)
+
+	time.Sleep(20 * time.Millisecond)
+	h.expireDisconnections()
+	ended := endedMessage(t, b)
+	assert.Equal(t, chess.Abandoned, ended.Reason)
+	assert.Equal(t, chess.Black, ended.Winner)
+	assert.Nil(t, h.players.Get(b).currentGame)
+	assert.Empty(t, h.disconnected)
+}
+
+func TestDisconnectWithoutGracePeriodAbandonsGame(t *testing.T) {
+	h, _, a, b := newReconnectGame(0)
+	h.handleUnregister(a)
+	assert.Equal(t, chess.Abandoned, endedMessage(t, b).Reason)
+}
+
+func TestDisconnectSuspendsChallenges(t *testing.T) {
+	h, game, a, _ := newReconnectGame(time.Minute)
+	defer game.Game.Exit()
+	h.handleChallenge(a, primitive.NilObjectID, blitz, "")
+	assert.Len(t, h.challenges, 1)
+
+	h.handleUnregister(a)
+	assert.False(t, onlyChallenge(t, h).leftAt.IsZero())
+}
+
+func TestDisconnectedGamesKeepTheirClocks(t *testing.T) {
+	h, game, a, b := newReconnectGame(time.Minute)
+	game.Game.Exit()
+	player := h.players.Get(a)
+	game = NewOnlineGame(h.storage, nil, player, h.players.Get(b), GameSetting{TimeControl: chess.SuddenDeath(10 * time.Millisecond)})
+
+	// The flag still falls when nobody is left to see it
+	h.handleUnregister(a)
+	h.handleUnregister(b)
+	assert.Equal(t, []*OnlineGame{game}, h.games())
+	time.Sleep(20 * time.Millisecond)
+	h.syncClocks()
+	assert.Equal(t, chess.Timeout, game.Game.GetResult().Reason)
+	assert.Nil(t, player.currentGame)
+	assert.Empty(t, h.games())
+}
+
+func TestWatchGame(t *testing.T) {
+	h, game, a, b := newReconnectGame(0)
+	defer game.Game.Exit()
+	s := newRecordingClient()
+	h.handleRegister(s, auth.NewAnonymousUser())
+	spectator := h.players.Get(s)
+
+	move, _ := chess.ParseUCI("e2e4")
+	assert.Nil(t, game.Play(h.players.Get(a), move))
+
+	h.handleWatch(s, primitive.NewObjectID())
+	assert.Equal(t, StatusConnected, spectator.status)
+
+	h.handleWatch(s, game.Id)
+	assert.Equal(t, StatusWatching, spectator.status)
+	watching := lastMessage[types.WatchGameMsgOut](t, s).Payload
+	assert.Equal(t, game.Id, watching.GameId)
+	assert.Equal(t, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", watching.FEN)
+	assert.Len(t, watching.Moves, 1)
+	assert.Equal(t, 1, watching.Spectators)
+	assert.Equal(t, 1, lastMessage[types.SpectatorsMsgOut](t, a).Payload.Count)
+	assert.Equal(t, 1, lastMessage[types.SpectatorsMsgOut](t, b).Payload.Count)
+
+	live := h.liveGames()
+	assert.Len(t, live, 1)
+	assert.Equal(t, game.Id, live[0].Id)
+	assert.Equal(t, 1, live[0].Spectators)
+	assert.Equal(t, 1, live[0].Moves)
+
+	// Moves are streamed to the spectator, who can't play any
+	reply, _ := chess.ParseUCI("e7e5")
+	assert.Nil(t, game.Play(h.players.Get(b), reply))
+	played := lastMessage[types.PlayGameMsgOut](t, s).Payload
+	assert.Equal(t, "e5", played.SAN)
+	assert.NotNil(t, played.Clock)
+	h.handlePlayerMove(s, chess.Move{}, "Nf3")
+	h.handleOfferDraw(s)
+	assert.Len(t, game.moves, 2)
+	assert.Nil(t, game.drawOffered)
+
+	h.handleUnwatch(s)
+	assert.Equal(t, StatusConnected, spectator.status)
+	assert.Equal(t, 0, lastMessage[types.SpectatorsMsgOut](t, a).Payload.Count)
+
+	// Spectators get the result and are free once the game ends
+	h.handleWatch(s, game.Id)
+	assert.Nil(t, game.Exit(h.players.Get(a)))
+	assert.Equal(t, chess.Abandoned, endedMessage(t, s).Reason)
+	assert.Equal(t, StatusConnected, spectator.status)
+	assert.Nil(t, spectator.watching)
+	assert.Empty(t, h.liveGames())
+}
+
+// Return a handler with a game between two registered recording clients which
+// has ended
+func newEndedGame(t *testing.T) (*gameHandler, *OnlineGame, *recordingClient, *recordingClient) {
+	h, game, a, b := newReconnectGame(0)
+	assert.Nil(t, game.Exit(h.players.Get(b)))
+	return h, game, a, b
+}
+
+func TestRematch(t *testing.T) {
+	h, game, a, b := newEndedGame(t)
+	white, black := h.players.Get(a), h.players.Get(b)
+
+	h.handleOfferRematch(a)
+	assert.Equal(t, string(types.RematchOfferedClientEvent), lastMessage[map[string]string](t, b)["type"])
+	assert.Nil(t, white.currentGame)
+
+	h.handleRespondRematch(b, true)
+	rematch := white.currentGame
+	assert.NotNil(t, rematch)
+	defer rematch.Game.Exit()
+	assert.NotSame(t, game, rematch)
+	assert.Same(t, rematch, black.currentGame)
+	assert.Same(t, black, rematch.Players[chess.White])
+	assert.Same(t, white, rematch.Players[chess.Black])
+	assert.Equal(t, game.setting, rematch.setting)
+	assert.Equal(t, chess.Black, lastMessage[types.StartGameMsgOut](t, a).Payload.You.Color)
+	assert.Nil(t, white.lastGame)
+}
+
+func TestRematchOfferedByBoth(t *testing.T) {
+	h, _, a, b := newEndedGame(t)
+	h.handleOfferRematch(a)
+	h.handleOfferRematch(b)
+	rematch := h.players.Get(a).currentGame
+	assert.NotNil(t, rematch)
+	rematch.Game.Exit()
+}
+
+func TestRematchRejected(t *testing.T) {
+	h, game, a, b := newEndedGame(t)
+	h.handleOfferRematch(a)
+	h.handleRespondRematch(b, false)
+	assert.Nil(t, game.rematchOffered)
+	assert.Equal(t, "respondRematch", lastMessage[map[string]any](t, a)["type"])
+	assert.Nil(t, h.players.Get(a).currentGame)
+}
+
+func TestRematchExpiresWhenPlayerLeaves(t *testing.T) {
+	h, game, a, b := newEndedGame(t)
+	h.handleOfferRematch(a)
+	h.handleWait(b, blitz)
+	assert.Nil(t, game.rematchOffered)
+	assert.Equal(t, string(types.RematchCanceledClientEvent), lastMessage[map[string]string](t, a)["type"])
+	h.handleRespondRematch(b, true)
+	assert.Nil(t, h.players.Get(a).currentGame)
+
+	h, game, a, b = newEndedGame(t)
+	h.handleOfferRematch(a)
+	h.handleUnregister(a)
+	assert.Nil(t, game.rematchOffered)
+	assert.Equal(t, string(types.RematchCanceledClientEvent), lastMessage[map[string]string](t, b)["type"])
+
+	sent := len(b.sent())
+	h.handleOfferRematch(b)
+	assert.Len(t, b.sent(), sent)
+	assert.Nil(t, game.rematchOffered)
+}
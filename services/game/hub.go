@@ -1,13 +1,22 @@
 package game
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/sina-am/chess/chess"
 	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type PlayerStatus int
@@ -16,6 +25,7 @@ const (
 	StatusWaiting   PlayerStatus = 0
 	StatusPlaying   PlayerStatus = 1
 	StatusConnected PlayerStatus = 2
+	StatusWatching  PlayerStatus = 3
 )
 
 type onlinePlayer struct {
@@ -23,6 +33,33 @@ type onlinePlayer struct {
 	user        auth.User
 	status      PlayerStatus
 	currentGame *OnlineGame
+	watching    *OnlineGame // Game followed as a spectator
+	lastGame    *OnlineGame // Game ended last, which can be rematched
+}
+
+// Return the game the player plays or watches, nil if there's none
+func (p *onlinePlayer) chatGame() *OnlineGame {
+	switch p.status {
+	case StatusPlaying:
+		return p.currentGame
+	case StatusWatching:
+		return p.watching
+	}
+	return nil
+}
+
+// Stands in for the client of a disconnected player, messages sent to it
+// are dropped
+type disconnectedClient struct{}
+
+func (disconnectedClient) Send(msg any)      {}
+func (disconnectedClient) SendErr(err error) {}
+func (disconnectedClient) Close()            {}
+
+// A player who left a game and may still come back to it
+type disconnection struct {
+	player   *onlinePlayer
+	deadline time.Time
 }
 
 type onlinePlayerStorage struct {
@@ -46,6 +83,19 @@ func (s *onlinePlayerStorage) Get(c Client) *onlinePlayer {
 	return s.players[c]
 }
 
+// Return the games being played, each one once
+func (s *onlinePlayerStorage) Games() []*OnlineGame {
+	seen := map[*OnlineGame]bool{}
+	games := []*OnlineGame{}
+	for _, p := range s.players {
+		if p.currentGame != nil && !seen[p.currentGame] {
+			seen[p.currentGame] = true
+			games = append(games, p.currentGame)
+		}
+	}
+	return games
+}
+
 func (s *onlinePlayerStorage) Remove(c Client) {
 	p, ok := s.players[c]
 	if !ok {
@@ -67,6 +117,23 @@ const (
 	ExitEvent
 	OfferDrawEvent
 	RespondDrawEvent
+	ClaimDrawEvent
+	OfferTakebackEvent
+	RespondTakebackEvent
+	WatchEvent
+	UnwatchEvent
+	LiveGamesEvent
+	ChatEvent
+	MuteEvent
+	UnmuteEvent
+	ReportEvent
+	OfferRematchEvent
+	RespondRematchEvent
+	ChallengeEvent
+	AcceptChallengeEvent
+	DeclineChallengeEvent
+	CancelChallengeEvent
+	GetChallengeEvent
 )
 
 type EventMsg struct {
@@ -101,13 +168,87 @@ type OfferDrawEventMsg struct {
 type PlayEventMsg struct {
 	Player Client
 	Move   chess.Move
+	SAN    string // Used instead of Move when not empty
+}
+type ClaimDrawEventMsg struct {
+	Player Client
 }
 type RespondDrawEventMsg struct {
 	Player   Client
 	Accepted bool
 }
+type OfferTakebackEventMsg struct {
+	Player Client
+}
+type RespondTakebackEventMsg struct {
+	Player   Client
+	Accepted bool
+}
+type WatchEventMsg struct {
+	Player Client
+	GameId primitive.ObjectID
+}
+type UnwatchEventMsg struct {
+	Player Client
+}
+type LiveGamesEventMsg struct {
+	Reply chan []types.LiveGame
+}
+type ChatEventMsg struct {
+	Player Client
+	Text   string
+}
+type MuteEventMsg struct {
+	Player Client
+	UserId primitive.ObjectID
+}
+type UnmuteEventMsg struct {
+	Player Client
+	UserId primitive.ObjectID
+}
+type ReportEventMsg struct {
+	Player Client
+	UserId primitive.ObjectID
+	Reason string
+}
+type OfferRematchEventMsg struct {
+	Player Client
+}
+type RespondRematchEventMsg struct {
+	Player   Client
+	Accepted bool
+}
+type ChallengeEventMsg struct {
+	Player      Client
+	UserId      primitive.ObjectID
+	GameSetting GameSetting
+	Color       types.ChallengeColor
+}
+type AcceptChallengeEventMsg struct {
+	Player      Client
+	ChallengeId primitive.ObjectID
+}
+type DeclineChallengeEventMsg struct {
+	Player      Client
+	ChallengeId primitive.ObjectID
+}
+type CancelChallengeEventMsg struct {
+	Player      Client
+	ChallengeId primitive.ObjectID
+}
+type challengeReply struct {
+	challenge types.Challenge
+	err       error
+}
+type GetChallengeEventMsg struct {
+	ChallengeId primitive.ObjectID
+	Reply       chan challengeReply
+}
 type GameSetting struct {
-	Duration time.Duration
+	TimeControl chess.TimeControl
+	Computer    bool        // Play against the computer instead of waiting for a player
+	Level       chess.Level // Strength of the computer
+	Engine      bool        // The computer is the external engine, Level isn't used
 }
 type GameHandler interface {
 	Start()
@@ -116,27 +257,71 @@ type GameHandler interface {
 	UnRegister(Client)
 
 	Play(client Client, move chess.Move)
+	PlaySAN(client Client, san string)
 	Exit(client Client)
 	OfferDraw(client Client)
 	RespondDraw(client Client, accepted bool)
+	ClaimDraw(client Client)
+	OfferTakeback(client Client)
+	RespondTakeback(client Client, accepted bool)
 
 	AddToWaitList(p Client, gs GameSetting)
 	RemoveFromWaitList(p Client)
+
+	Watch(client Client, gameId primitive.ObjectID)
+	Unwatch(client Client)
+	LiveGames() []types.LiveGame
+
+	Chat(client Client, text string)
+	Mute(client Client, userId primitive.ObjectID)
+	Unmute(client Client, userId primitive.ObjectID)
+	Report(client Client, userId primitive.ObjectID, reason string)
+
+	OfferRematch(client Client)
+	RespondRematch(client Client, accepted bool)
+
+	Challenge(client Client, userId primitive.ObjectID, gs GameSetting, color types.ChallengeColor)
+	AcceptChallenge(client Client, challengeId primitive.ObjectID)
+	DeclineChallenge(client Client, challengeId primitive.ObjectID)
+	CancelChallenge(client Client, challengeId primitive.ObjectID)
+	GetChallenge(challengeId primitive.ObjectID) (types.Challenge, error)
 }
 
 type gameHandler struct {
-	storage  storage.Storage
-	players  *onlinePlayerStorage
-	waitList WaitList
-	eventCh  chan EventMsg
+	storage    storage.Storage
+	analyzer   *Analyzer
+	players    *onlinePlayerStorage
+	matchmaker *Matchmaker
+	chat       *Chat
+	eventCh    chan EventMsg
+
+	// Players who left a game are given this long to come back, by user id
+	gracePeriod  time.Duration
+	disconnected map[primitive.ObjectID]*disconnection
+
+	challenges map[primitive.ObjectID]*challenge
+
+	// Played by the games against the engine, nil if there's none
+	engine *SharedEngine
 }
 
-func NewGameHandler(wl WaitList, s storage.Storage) GameHandler {
+// A game is lost as soon as a player disconnects if gracePeriod is 0.
+// Players can only choose the engine as opponent if engine isn't nil.
+func NewGameHandler(mm *Matchmaker, chat *Chat, s storage.Storage, analyzer *Analyzer, gracePeriod time.Duration, engine *SharedEngine) GameHandler {
 	h := &gameHandler{
-		storage:  s,
-		players:  NewOnlinePlayerStorage(),
-		waitList: wl,
-		eventCh:  make(chan EventMsg),
+		storage:    s,
+		analyzer:   analyzer,
+		players:    NewOnlinePlayerStorage(),
+		matchmaker: mm,
+		chat:       chat,
+		eventCh:    make(chan EventMsg),
+
+		gracePeriod:  gracePeriod,
+		disconnected: map[primitive.ObjectID]*disconnection{},
+
+		challenges: map[primitive.ObjectID]*challenge{},
+
+		engine: engine,
 	}
 
 	return h
@@ -168,6 +353,17 @@ func (h *gameHandler) Play(p Client, move chess.Move) {
 	h.eventCh <- msg
 }
 
+func (h *gameHandler) PlaySAN(p Client, san string) {
+	msg := EventMsg{
+		Type: PlayEvent,
+		Body: PlayEventMsg{
+			Player: p,
+			SAN:    san,
+		},
+	}
+	h.eventCh <- msg
+}
+
 func (h *gameHandler) Exit(p Client) {
 	msg := EventMsg{
 		Type: ExitEvent,
@@ -199,6 +395,37 @@ func (h *gameHandler) RespondDraw(client Client, accepted bool) {
 	h.eventCh <- msg
 }
 
+func (h *gameHandler) ClaimDraw(client Client) {
+	msg := EventMsg{
+		Type: ClaimDrawEvent,
+		Body: ClaimDrawEventMsg{
+			Player: client,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) OfferTakeback(client Client) {
+	msg := EventMsg{
+		Type: OfferTakebackEvent,
+		Body: OfferTakebackEventMsg{
+			Player: client,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) RespondTakeback(client Client, accepted bool) {
+	msg := EventMsg{
+		Type: RespondTakebackEvent,
+		Body: RespondTakebackEventMsg{
+			Player:   client,
+			Accepted: accepted,
+		},
+	}
+	h.eventCh <- msg
+}
+
 func (h *gameHandler) AddToWaitList(p Client, gs GameSetting) {
 	msg := EventMsg{
 		Type: JoinWaitListEvent,
@@ -220,9 +447,181 @@ func (h *gameHandler) RemoveFromWaitList(p Client) {
 	h.eventCh <- msg
 }
 
+func (h *gameHandler) Watch(client Client, gameId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: WatchEvent,
+		Body: WatchEventMsg{
+			Player: client,
+			GameId: gameId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) Unwatch(client Client) {
+	msg := EventMsg{
+		Type: UnwatchEvent,
+		Body: UnwatchEventMsg{
+			Player: client,
+		},
+	}
+	h.eventCh <- msg
+}
+
+// Return the games being played, most watched first
+func (h *gameHandler) LiveGames() []types.LiveGame {
+	reply := make(chan []types.LiveGame, 1)
+	h.eventCh <- EventMsg{
+		Type: LiveGamesEvent,
+		Body: LiveGamesEventMsg{Reply: reply},
+	}
+	return <-reply
+}
+
+func (h *gameHandler) Chat(client Client, text string) {
+	msg := EventMsg{
+		Type: ChatEvent,
+		Body: ChatEventMsg{
+			Player: client,
+			Text:   text,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) Mute(client Client, userId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: MuteEvent,
+		Body: MuteEventMsg{
+			Player: client,
+			UserId: userId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) Unmute(client Client, userId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: UnmuteEvent,
+		Body: UnmuteEventMsg{
+			Player: client,
+			UserId: userId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) Report(client Client, userId primitive.ObjectID, reason string) {
+	msg := EventMsg{
+		Type: ReportEvent,
+		Body: ReportEventMsg{
+			Player: client,
+			UserId: userId,
+			Reason: reason,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) OfferRematch(client Client) {
+	msg := EventMsg{
+		Type: OfferRematchEvent,
+		Body: OfferRematchEventMsg{
+			Player: client,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) RespondRematch(client Client, accepted bool) {
+	msg := EventMsg{
+		Type: RespondRematchEvent,
+		Body: RespondRematchEventMsg{
+			Player:   client,
+			Accepted: accepted,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) Challenge(client Client, userId primitive.ObjectID, gs GameSetting, color types.ChallengeColor) {
+	msg := EventMsg{
+		Type: ChallengeEvent,
+		Body: ChallengeEventMsg{
+			Player:      client,
+			UserId:      userId,
+			GameSetting: gs,
+			Color:       color,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) AcceptChallenge(client Client, challengeId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: AcceptChallengeEvent,
+		Body: AcceptChallengeEventMsg{
+			Player:      client,
+			ChallengeId: challengeId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) DeclineChallenge(client Client, challengeId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: DeclineChallengeEvent,
+		Body: DeclineChallengeEventMsg{
+			Player:      client,
+			ChallengeId: challengeId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+func (h *gameHandler) CancelChallenge(client Client, challengeId primitive.ObjectID) {
+	msg := EventMsg{
+		Type: CancelChallengeEvent,
+		Body: CancelChallengeEventMsg{
+			Player:      client,
+			ChallengeId: challengeId,
+		},
+	}
+	h.eventCh <- msg
+}
+
+// Return the pending challenge with the given id
+func (h *gameHandler) GetChallenge(challengeId primitive.ObjectID) (types.Challenge, error) {
+	reply := make(chan challengeReply, 1)
+	h.eventCh <- EventMsg{
+		Type: GetChallengeEvent,
+		Body: GetChallengeEventMsg{ChallengeId: challengeId, Reply: reply},
+	}
+	r := <-reply
+	return r.challenge, r.err
+}
+
 func (h *gameHandler) Start() {
+	// Waiting players accept wider rating gaps over time, so they're
+	// matched again periodically
+	ticker := time.NewTicker(matchInterval)
+	defer ticker.Stop()
+	clockTicker := time.NewTicker(clockInterval)
+	defer clockTicker.Stop()
+
 	for {
-		event := <-h.eventCh
+		var event EventMsg
+		select {
+		case event = <-h.eventCh:
+		case <-ticker.C:
+			h.matchPlayers()
+			continue
+		case <-clockTicker.C:
+			h.syncClocks()
+			h.expireDisconnections()
+			h.expireChallenges()
+			continue
+		}
 		switch event.Type {
 		case RegisterEventType:
 			body := event.Body.(RegisterEventMsg)
@@ -232,7 +631,7 @@ func (h *gameHandler) Start() {
 			h.handleUnregister(body.Player)
 		case PlayEvent:
 			body := event.Body.(PlayEventMsg)
-			h.handlePlayerMove(body.Player, body.Move)
+			h.handlePlayerMove(body.Player, body.Move, body.SAN)
 		case JoinWaitListEvent:
 			body := event.Body.(JoinWaitListEventMsg)
 			h.handleWait(body.Player, body.GameSetting)
@@ -248,20 +647,134 @@ func (h *gameHandler) Start() {
 		case RespondDrawEvent:
 			body := event.Body.(RespondDrawEventMsg)
 			h.handleRespondDraw(body.Player, body.Accepted)
+		case ClaimDrawEvent:
+			body := event.Body.(ClaimDrawEventMsg)
+			h.handleClaimDraw(body.Player)
+		case OfferTakebackEvent:
+			body := event.Body.(OfferTakebackEventMsg)
+			h.handleOfferTakeback(body.Player)
+		case RespondTakebackEvent:
+			body := event.Body.(RespondTakebackEventMsg)
+			h.handleRespondTakeback(body.Player, body.Accepted)
+		case WatchEvent:
+			body := event.Body.(WatchEventMsg)
+			h.handleWatch(body.Player, body.GameId)
+		case UnwatchEvent:
+			body := event.Body.(UnwatchEventMsg)
+			h.handleUnwatch(body.Player)
+		case LiveGamesEvent:
+			body := event.Body.(LiveGamesEventMsg)
+			body.Reply <- h.liveGames()
+		case ChatEvent:
+			body := event.Body.(ChatEventMsg)
+			h.handleChat(body.Player, body.Text)
+		case MuteEvent:
+			body := event.Body.(MuteEventMsg)
+			h.handleMute(body.Player, body.UserId)
+		case UnmuteEvent:
+			body := event.Body.(UnmuteEventMsg)
+			h.handleUnmute(body.Player, body.UserId)
+		case ReportEvent:
+			body := event.Body.(ReportEventMsg)
+			h.handleReport(body.Player, body.UserId, body.Reason)
+		case OfferRematchEvent:
+			body := event.Body.(OfferRematchEventMsg)
+			h.handleOfferRematch(body.Player)
+		case RespondRematchEvent:
+			body := event.Body.(RespondRematchEventMsg)
+			h.handleRespondRematch(body.Player, body.Accepted)
+		case ChallengeEvent:
+			body := event.Body.(ChallengeEventMsg)
+			h.handleChallenge(body.Player, body.UserId, body.GameSetting, body.Color)
+		case AcceptChallengeEvent:
+			body := event.Body.(AcceptChallengeEventMsg)
+			h.handleAcceptChallenge(body.Player, body.ChallengeId)
+		case DeclineChallengeEvent:
+			body := event.Body.(DeclineChallengeEventMsg)
+			h.handleDeclineChallenge(body.Player, body.ChallengeId)
+		case CancelChallengeEvent:
+			body := event.Body.(CancelChallengeEventMsg)
+			h.handleCancelChallenge(body.Player, body.ChallengeId)
+		case GetChallengeEvent:
+			body := event.Body.(GetChallengeEventMsg)
+			challenge, err := h.getChallenge(body.ChallengeId)
+			body.Reply <- challengeReply{challenge: challenge, err: err}
 		}
 	}
 }
 func (h *gameHandler) handleRegister(c Client, user auth.User) {
+	if d, ok := h.disconnected[user.GetId()]; ok {
+		delete(h.disconnected, user.GetId())
+		if d.player.currentGame != nil {
+			d.player.client = c
+			h.players.Add(c, d.player)
+			if err := d.player.currentGame.Resume(d.player); err != nil {
+				log.Printf("onlineGame.Resume: %s", err.Error())
+			}
+			h.sendPendingChallenges(d.player)
+			h.resumeChallenges(d.player)
+			return
+		}
+	}
+
 	op := &onlinePlayer{client: c, status: StatusConnected, user: user}
 	h.players.Add(c, op)
+	h.sendPendingChallenges(op)
+	h.resumeChallenges(op)
 }
 
 func (h *gameHandler) handleUnregister(p Client) {
+	player := h.players.Get(p)
+	if player != nil {
+		h.cancelRematch(player)
+		h.suspendChallenges(player)
+	}
+	if player != nil && player.status == StatusPlaying && h.gracePeriod > 0 {
+		h.players.Remove(p)
+		h.disconnect(player)
+		return
+	}
 	h.handleExit(p)
 	h.players.Remove(p)
 }
 
-func (h *gameHandler) handlePlayerMove(c Client, move chess.Move) {
+// Keep the player's game going for the grace period, so the player can
+// resume it from a new connection
+func (h *gameHandler) disconnect(player *onlinePlayer) {
+	player.client = disconnectedClient{}
+	h.disconnected[player.user.GetId()] = &disconnection{
+		player:   player,
+		deadline: time.Now().Add(h.gracePeriod),
+	}
+
+	opponent, err := player.currentGame.GetOpponentPlayer(player)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	opponent.client.Send(types.OpponentDisconnectedMsgOut{
+		Type: types.OpponentDisconnectedClientEvent,
+		Payload: types.OpponentDisconnectedPayloadMsgOut{
+			GracePeriod: int(h.gracePeriod.Seconds()),
+		},
+	})
+}
+
+// Declare the games of the players who didn't come back in time abandoned
+func (h *gameHandler) expireDisconnections() {
+	now := time.Now()
+	for userId, d := range h.disconnected {
+		if now.Before(d.deadline) {
+			continue
+		}
+		delete(h.disconnected, userId)
+		if d.player.currentGame != nil {
+			h.handleExitGame(d.player)
+		}
+	}
+}
+
+func (h *gameHandler) handlePlayerMove(c Client, move chess.Move, san string) {
 	player := h.players.Get(c)
 	if player == nil {
 		log.Printf("player with client %v is not in the players list", c)
@@ -273,14 +786,31 @@ func (h *gameHandler) handlePlayerMove(c Client, move chess.Move) {
 		return
 	}
 
+	if san != "" {
+		var err error
+		if move, err = player.currentGame.Game.ParseSAN(san); err != nil {
+			player.client.SendErr(err)
+			return
+		}
+	}
+
 	if err := player.currentGame.Play(player, move); err != nil {
 		log.Printf("onlineGame.Play: %s", err.Error())
 		return
 	}
 }
 
-func createWaitListKey(gs GameSetting) string {
-	return fmt.Sprintf("<%d>", gs.Duration)
+// Return the rating the player is matched by, the initial one for guests
+func (h *gameHandler) matchRating(player *onlinePlayer, gs GameSetting) float64 {
+	if !player.user.IsAuthenticated() {
+		return rating.DefaultRating
+	}
+	user, err := h.storage.GetUserById(context.Background(), player.user.GetId())
+	if err != nil {
+		log.Printf("fetching rating of %s: %s", player.user.GetId().Hex(), err.Error())
+		return rating.DefaultRating
+	}
+	return user.Rating(rating.CategoryOf(gs.TimeControl.Estimated())).Rating
 }
 
 func (h *gameHandler) handleWait(c Client, gs GameSetting) {
@@ -300,19 +830,208 @@ func (h *gameHandler) handleWait(c Client, gs GameSetting) {
 		return
 	}
 
-	c2, err := h.waitList.Pop(createWaitListKey(gs))
+	if gs.Engine && h.engine == nil {
+		c.SendErr(ErrNoEngine)
+		return
+	}
 
-	// Wait, list is empty
-	if err != nil {
-		if err := h.waitList.Add(createWaitListKey(gs), c); err != nil {
-			c.SendErr(err)
+	if player.status == StatusWatching {
+		player.watching.RemoveSpectator(player)
+	}
+	h.cancelRematch(player)
+
+	if gs.Computer {
+		h.startComputerGame(player, gs, randomColor())
+		return
+	}
+
+	if err := h.matchmaker.Add(c, player.user.GetId(), gs, h.matchRating(player, gs)); err != nil {
+		c.SendErr(err)
+		return
+	}
+	player.status = StatusWaiting
+	c.Send(types.WaitingMsgOut{
+		Type: types.WaitingClientEvent,
+		Payload: types.WaitingPayloadMsgOut{
+			EstimatedWait: int(h.matchmaker.EstimatedWait(gs).Seconds()),
+		},
+	})
+	h.matchPlayers()
+}
+
+// Start a game for every pair of waiting players the matchmaker found, with
+// a random color for each side
+func (h *gameHandler) matchPlayers() {
+	for _, p := range h.matchmaker.Match() {
+		first, second := h.players.Get(p.first.client), h.players.Get(p.second.client)
+		if first == nil || second == nil {
+			log.Printf("matched players %v and %v are not in the players list", p.first.client, p.second.client)
+			continue
+		}
+		if rand.Intn(2) == 0 {
+			first, second = second, first
+		}
+		NewOnlineGame(h.storage, h.analyzer, first, second, p.first.setting)
+	}
+}
+
+// Send the clocks to the players of every game, and end the games where
+// a flag fell
+func (h *gameHandler) syncClocks() {
+	for _, game := range h.games() {
+		if result := game.Game.GetResult(); result != chess.NoResult {
+			if err := game.endGame(result); err != nil {
+				log.Printf("ending game: %s", err.Error())
+			}
+			continue
+		}
+		for _, p := range game.audience() {
+			game.SendClock(p)
+		}
+	}
+}
+
+func randomColor() chess.Color {
+	if rand.Intn(2) == 0 {
+		return chess.White
+	}
+	return chess.Black
+}
+
+// Start a game between the player, with the given color, and a new computer
+// opponent. The computer leaves once the game ends.
+func (h *gameHandler) startComputerGame(player *onlinePlayer, gs GameSetting, color chess.Color) {
+	bot := NewComputerClient(h, gs.Level)
+	if gs.Engine {
+		bot = NewEngineClient(h, h.engine)
+	}
+	botPlayer := &onlinePlayer{client: bot, user: bot.User(), status: StatusConnected}
+	h.players.Add(bot, botPlayer)
+	go bot.Start()
+
+	if color == chess.White {
+		NewOnlineGame(h.storage, h.analyzer, player, botPlayer, gs)
+	} else {
+		NewOnlineGame(h.storage, h.analyzer, botPlayer, player, gs)
+	}
+}
+
+// Check if the player is still online and free to start the rematch of
+// the game
+func (h *gameHandler) canRematch(player *onlinePlayer, game *OnlineGame) bool {
+	if h.players.Get(player.client) != player || player.lastGame != game {
+		return false
+	}
+	return player.status == StatusConnected || player.status == StatusWatching
+}
+
+// Start a new game between the players of the game with the colors swapped
+func (h *gameHandler) startRematch(game *OnlineGame) {
+	white, black := game.Players[chess.Black], game.Players[chess.White]
+	for _, p := range []*onlinePlayer{white, black} {
+		p.lastGame = nil
+		if p.status == StatusWatching {
+			p.watching.RemoveSpectator(p)
+		}
+	}
+	NewOnlineGame(h.storage, h.analyzer, white, black, game.setting)
+}
+
+// Withdraw the rematch offers of the player's last game, the player left
+// or moved on to another game
+func (h *gameHandler) cancelRematch(player *onlinePlayer) {
+	game := player.lastGame
+	if game == nil {
+		return
+	}
+	player.lastGame = nil
+	if game.rematchOffered == nil {
+		return
+	}
+	game.rematchOffered = nil
+
+	opponent, err := game.GetOpponentPlayer(player)
+	if err == nil && h.players.Get(opponent.client) == opponent {
+		opponent.client.Send(map[string]string{
+			"type": string(types.RematchCanceledClientEvent),
+		})
+	}
+}
+
+func (h *gameHandler) handleOfferRematch(c Client) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	game := player.lastGame
+	if game == nil || (player.status != StatusConnected && player.status != StatusWatching) {
+		c.SendErr(ErrNoRematch)
+		return
+	}
+	color, _ := game.getPlayerColor(player)
+
+	// The computer leaves after a game, so a new one plays the rematch
+	if game.setting.Computer {
+		player.lastGame = nil
+		if player.status == StatusWatching {
+			player.watching.RemoveSpectator(player)
 		}
-		player.status = StatusWaiting
+		h.startComputerGame(player, game.setting, color.OppositeColor())
 		return
 	}
 
-	player2 := h.players.Get(c2)
-	NewOnlineGame(h.storage, player, player2, gs.Duration)
+	opponent := game.Players[color.OppositeColor()]
+	if !h.canRematch(opponent, game) {
+		c.SendErr(ErrOpponentLeft)
+		return
+	}
+	// Both players asked for a rematch
+	if game.rematchOffered == opponent {
+		game.rematchOffered = nil
+		h.startRematch(game)
+		return
+	}
+
+	game.rematchOffered = player
+	opponent.client.Send(map[string]string{
+		"type": string(types.RematchOfferedClientEvent),
+	})
+}
+
+func (h *gameHandler) handleRespondRematch(c Client, accepted bool) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	game := player.lastGame
+	if game == nil {
+		c.SendErr(ErrNoRematch)
+		return
+	}
+	opponent, err := game.GetOpponentPlayer(player)
+	if err != nil || game.rematchOffered != opponent {
+		return
+	}
+
+	game.rematchOffered = nil
+	if !accepted {
+		opponent.client.Send(map[string]any{
+			"type": "respondRematch",
+			"payload": map[string]string{
+				"result": "rejected",
+			},
+		})
+		return
+	}
+	if !h.canRematch(player, game) || !h.canRematch(opponent, game) {
+		c.SendErr(ErrOpponentLeft)
+		return
+	}
+	h.startRematch(game)
 }
 
 func (h *gameHandler) handleExit(c Client) {
@@ -323,8 +1042,10 @@ func (h *gameHandler) handleExit(c Client) {
 	}
 
 	if player.status == StatusWaiting {
-		h.waitList.Remove(c)
+		h.matchmaker.Remove(c)
 		player.status = StatusConnected
+	} else if player.status == StatusWatching {
+		player.watching.RemoveSpectator(player)
 	} else if player.status == StatusPlaying {
 		h.handleExitGame(player)
 		player.status = StatusConnected
@@ -360,6 +1081,57 @@ func (h *gameHandler) handleRespondDraw(c Client, accepted bool) {
 	player.currentGame.RespondDraw(player, accepted)
 }
 
+func (h *gameHandler) handleClaimDraw(c Client) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	if player.status != StatusPlaying {
+		player.client.SendErr(fmt.Errorf("you're not in any game"))
+		return
+	}
+
+	if err := player.currentGame.ClaimDraw(player); err != nil {
+		log.Printf("onlineGame.ClaimDraw: %s", err.Error())
+	}
+}
+
+func (h *gameHandler) handleOfferTakeback(c Client) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	if player.status != StatusPlaying {
+		player.client.SendErr(fmt.Errorf("you're not in any game"))
+		return
+	}
+
+	if err := player.currentGame.OfferTakeback(player); err != nil {
+		log.Printf("onlineGame.OfferTakeback: %s", err.Error())
+	}
+}
+
+func (h *gameHandler) handleRespondTakeback(c Client, accepted bool) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	if player.status != StatusPlaying {
+		player.client.SendErr(fmt.Errorf("you're not in any game"))
+		return
+	}
+
+	if err := player.currentGame.RespondTakeback(player, accepted); err != nil {
+		log.Printf("onlineGame.RespondTakeback: %s", err.Error())
+	}
+}
+
 func (h *gameHandler) handleExitGame(player *onlinePlayer) {
 	g := player.currentGame
 	if err := g.Exit(player); err != nil {
@@ -367,8 +1139,178 @@ func (h *gameHandler) handleExitGame(player *onlinePlayer) {
 	}
 }
 
+// Return the games being played, with the ones whose players are all
+// disconnected, each one once
+func (h *gameHandler) games() []*OnlineGame {
+	games := h.players.Games()
+	for _, d := range h.disconnected {
+		if d.player.currentGame != nil && !slices.Contains(games, d.player.currentGame) {
+			games = append(games, d.player.currentGame)
+		}
+	}
+	return games
+}
+
+// Return the game with the given id if it's being played
+func (h *gameHandler) findGame(gameId primitive.ObjectID) *OnlineGame {
+	for _, game := range h.games() {
+		if game.Id == gameId {
+			return game
+		}
+	}
+	return nil
+}
+
+func (h *gameHandler) liveGames() []types.LiveGame {
+	games := []types.LiveGame{}
+	for _, game := range h.games() {
+		games = append(games, game.Live())
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if games[i].Spectators != games[j].Spectators {
+			return games[i].Spectators > games[j].Spectators
+		}
+		return games[i].StartedAt.After(games[j].StartedAt)
+	})
+	return games
+}
+
+func (h *gameHandler) handleWatch(c Client, gameId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	switch player.status {
+	case StatusPlaying:
+		c.SendErr(fmt.Errorf("already in a game"))
+		return
+	case StatusWaiting:
+		c.SendErr(fmt.Errorf("already in a waiting list"))
+		return
+	}
+
+	game := h.findGame(gameId)
+	if game == nil {
+		c.SendErr(ErrGameNotFound)
+		return
+	}
+	if player.status == StatusWatching {
+		player.watching.RemoveSpectator(player)
+	}
+	game.AddSpectator(player)
+}
+
+func (h *gameHandler) handleUnwatch(c Client) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	if player.status != StatusWatching {
+		c.SendErr(fmt.Errorf("you're not watching any game"))
+		return
+	}
+	player.watching.RemoveSpectator(player)
+}
+
+// Send the message to the player's chat room, except to the members who
+// muted the player
+func (h *gameHandler) handleChat(c Client, text string) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	game := player.chatGame()
+	if game == nil {
+		c.SendErr(fmt.Errorf("you're not in any game"))
+		return
+	}
+	room := game.chatRoomOf(player)
+
+	text, err := h.chat.Prepare(player.user.GetId(), text)
+	if err != nil {
+		c.SendErr(err)
+		return
+	}
+	msg := types.ChatMessage{
+		UserId: player.user.GetId(),
+		Name:   player.user.GetName(),
+		Room:   room,
+		Text:   text,
+		Time:   time.Now(),
+	}
+	game.chat = append(game.chat, msg)
+
+	for _, member := range game.chatMembers(room) {
+		if !h.chat.IsMuted(member.user.GetId(), msg.UserId) {
+			member.client.Send(types.ChatMsgOut{Type: types.ChatClientEvent, Payload: msg})
+		}
+	}
+}
+
+func (h *gameHandler) handleMute(c Client, userId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+	if err := h.chat.Mute(player.user.GetId(), userId); err != nil {
+		c.SendErr(err)
+	}
+}
+
+func (h *gameHandler) handleUnmute(c Client, userId primitive.ObjectID) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+	h.chat.Unmute(player.user.GetId(), userId)
+}
+
+// Save a report of the user with what the user wrote in the game
+func (h *gameHandler) handleReport(c Client, userId primitive.ObjectID, reason string) {
+	player := h.players.Get(c)
+	if player == nil {
+		log.Printf("player with client %v is not in the players list", c)
+		return
+	}
+
+	game := player.chatGame()
+	if game == nil {
+		c.SendErr(fmt.Errorf("you're not in any game"))
+		return
+	}
+	if utf8.RuneCountInString(reason) > maxChatMessageLength {
+		c.SendErr(ErrChatMessageTooLong)
+		return
+	}
+
+	report := &types.ChatReport{
+		GameId:     game.Id,
+		ReporterId: player.user.GetId(),
+		UserId:     userId,
+		Reason:     strings.TrimSpace(reason),
+		Messages:   game.chatMessagesOf(userId),
+		Time:       time.Now(),
+	}
+	if err := h.storage.InsertChatReport(context.Background(), report); err != nil {
+		log.Printf("saving chat report: %s", err.Error())
+		c.SendErr(fmt.Errorf("failed to save the report"))
+	}
+}
+
 func (h *gameHandler) handleExitWaitList(c Client) {
-	if err := h.waitList.Remove(c); err != nil {
+	if err := h.matchmaker.Remove(c); err != nil {
 		c.SendErr(err)
+		return
+	}
+	if player := h.players.Get(c); player != nil {
+		player.status = StatusConnected
 	}
 }
@@ -0,0 +1,183 @@
+package game
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAlreadySeeking = errors.New("already in the waiting list")
+	ErrNotSeeking     = errors.New("not in the waiting list")
+)
+
+const (
+	// Rating gap accepted as soon as a player starts waiting, it widens by
+	// ratingWindowGrowth every second up to maxRatingWindow
+	initialRatingWindow = 100
+	ratingWindowGrowth  = 25
+	maxRatingWindow     = 1000
+
+	// Players who just played each other are paired again only when they
+	// have both waited this long without finding anybody else
+	rematchCooldown = 30 * time.Second
+
+	// Estimated wait before any game was matched in a pool
+	defaultEstimatedWait = 30 * time.Second
+	// Weight of the last wait in the estimate of a pool
+	waitEstimateWeight = 0.3
+
+	matchInterval = time.Second
+)
+
+// A player waiting for an opponent
+type seek struct {
+	client  Client
+	userId  primitive.ObjectID
+	setting GameSetting
+	rating  float64
+	since   time.Time
+}
+
+type pairing struct {
+	first, second *seek
+}
+
+// Pairs waiting players with the same game setting and a similar rating.
+// The accepted rating gap widens the longer a player waits.
+type Matchmaker struct {
+	seeks         []*seek
+	lastOpponents map[primitive.ObjectID]primitive.ObjectID
+	waits         map[string]time.Duration // Average wait of each pool
+	now           func() time.Time
+}
+
+func NewMatchmaker() *Matchmaker {
+	return &Matchmaker{
+		seeks:         []*seek{},
+		lastOpponents: map[primitive.ObjectID]primitive.ObjectID{},
+		waits:         map[string]time.Duration{},
+		now:           time.Now,
+	}
+}
+
+// Players are only paired with players of the same pool
+func poolKey(gs GameSetting) string {
+	return gs.TimeControl.String()
+}
+
+func (m *Matchmaker) find(c Client) int {
+	for i, s := range m.seeks {
+		if s.client == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Matchmaker) Add(c Client, userId primitive.ObjectID, gs GameSetting, rating float64) error {
+	if m.find(c) >= 0 {
+		return ErrAlreadySeeking
+	}
+	m.seeks = append(m.seeks, &seek{client: c, userId: userId, setting: gs, rating: rating, since: m.now()})
+	return nil
+}
+
+func (m *Matchmaker) Remove(c Client) error {
+	i := m.find(c)
+	if i < 0 {
+		return ErrNotSeeking
+	}
+	m.seeks = append(m.seeks[:i], m.seeks[i+1:]...)
+	return nil
+}
+
+func (m *Matchmaker) Len() int {
+	return len(m.seeks)
+}
+
+// Return the rating gap the player accepts after waiting for the given time
+func ratingWindow(waited time.Duration) float64 {
+	return math.Min(initialRatingWindow+ratingWindowGrowth*waited.Seconds(), maxRatingWindow)
+}
+
+// Check if both players accept each other
+func (m *Matchmaker) compatible(a, b *seek, now time.Time) bool {
+	if a.userId == b.userId || poolKey(a.setting) != poolKey(b.setting) {
+		return false
+	}
+	gap := math.Abs(a.rating - b.rating)
+	if gap > ratingWindow(now.Sub(a.since)) || gap > ratingWindow(now.Sub(b.since)) {
+		return false
+	}
+	if m.lastOpponents[a.userId] == b.userId || m.lastOpponents[b.userId] == a.userId {
+		return now.Sub(a.since) >= rematchCooldown && now.Sub(b.since) >= rematchCooldown
+	}
+	return true
+}
+
+// Pair every player who has an acceptable opponent and take them off the
+// list. Players who waited the longest choose first, and get the closest
+// rating among their acceptable opponents.
+func (m *Matchmaker) Match() []pairing {
+	now := m.now()
+	sort.SliceStable(m.seeks, func(i, j int) bool {
+		return m.seeks[i].since.Before(m.seeks[j].since)
+	})
+
+	pairings := []pairing{}
+	matched := map[*seek]bool{}
+	for i, a := range m.seeks {
+		if matched[a] {
+			continue
+		}
+		var best *seek
+		for _, b := range m.seeks[i+1:] {
+			if matched[b] || !m.compatible(a, b, now) {
+				continue
+			}
+			if best == nil || math.Abs(a.rating-b.rating) < math.Abs(a.rating-best.rating) {
+				best = b
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		matched[a], matched[best] = true, true
+		pairings = append(pairings, pairing{first: a, second: best})
+		m.lastOpponents[a.userId], m.lastOpponents[best.userId] = best.userId, a.userId
+		m.recordWait(poolKey(a.setting), now.Sub(a.since))
+		m.recordWait(poolKey(best.setting), now.Sub(best.since))
+	}
+
+	waiting := m.seeks[:0]
+	for _, s := range m.seeks {
+		if !matched[s] {
+			waiting = append(waiting, s)
+		}
+	}
+	m.seeks = waiting
+	return pairings
+}
+
+func (m *Matchmaker) recordWait(key string, wait time.Duration) {
+	average, ok := m.waits[key]
+	if !ok {
+		m.waits[key] = wait
+		return
+	}
+	m.waits[key] = time.Duration(waitEstimateWeight*float64(wait) + (1-waitEstimateWeight)*float64(average))
+}
+
+// Return how long a player is expected to wait for an opponent, from the
+// recent waits in the pool of the game setting
+func (m *Matchmaker) EstimatedWait(gs GameSetting) time.Duration {
+	if wait, ok := m.waits[poolKey(gs)]; ok {
+		return wait
+	}
+	return defaultEstimatedWait
+}
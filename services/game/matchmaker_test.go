@@ -0,0 +1,133 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/storage"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return a matchmaker with a clock moved forward by the returned function
+func newTestMatchmaker() (*Matchmaker, func(time.Duration)) {
+	m := NewMatchmaker()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func newSeeker() (Client, primitive.ObjectID) {
+	return newRecordingClient(), primitive.NewObjectID()
+}
+
+var blitz = GameSetting{TimeControl: chess.SuddenDeath(5 * time.Minute)}
+
+func TestMatchmakerPairs(t *testing.T) {
+	m, _ := newTestMatchmaker()
+	a, aId := newSeeker()
+	b, bId := newSeeker()
+	c, cId := newSeeker()
+
+	assert.Nil(t, m.Add(a, aId, blitz, 1500))
+	assert.ErrorIs(t, m.Add(a, aId, blitz, 1500), ErrAlreadySeeking)
+	assert.Nil(t, m.Add(b, bId, GameSetting{TimeControl: chess.SuddenDeath(time.Minute)}, 1500))
+	assert.Empty(t, m.Match())
+
+	assert.Nil(t, m.Add(c, cId, blitz, 1550))
+	pairings := m.Match()
+	assert.Len(t, pairings, 1)
+	assert.Equal(t, a, pairings[0].first.client)
+	assert.Equal(t, c, pairings[0].second.client)
+	assert.Equal(t, 1, m.Len())
+
+	assert.Nil(t, m.Remove(b))
+	assert.ErrorIs(t, m.Remove(b), ErrNotSeeking)
+}
+
+func TestMatchmakerWidensWindow(t *testing.T) {
+	m, wait := newTestMatchmaker()
+	a, aId := newSeeker()
+	b, bId := newSeeker()
+	c, cId := newSeeker()
+
+	m.Add(a, aId, blitz, 1500)
+	m.Add(b, bId, blitz, 1900)
+	assert.Empty(t, m.Match())
+
+	wait(7 * time.Second)
+	assert.Empty(t, m.Match())
+	wait(time.Second)
+	// A newcomer closer in rating is preferred, but still has to accept the gap
+	m.Add(c, cId, blitz, 1650)
+	assert.Empty(t, m.Match())
+
+	wait(2 * time.Second)
+	pairings := m.Match()
+	assert.Len(t, pairings, 1)
+	assert.Equal(t, a, pairings[0].first.client)
+	assert.Equal(t, c, pairings[0].second.client)
+}
+
+func TestMatchmakerAvoidsRematch(t *testing.T) {
+	m, wait := newTestMatchmaker()
+	a, aId := newSeeker()
+	b, bId := newSeeker()
+
+	m.Add(a, aId, blitz, 1500)
+	m.Add(b, bId, blitz, 1500)
+	assert.Len(t, m.Match(), 1)
+
+	m.Add(a, aId, blitz, 1500)
+	m.Add(b, bId, blitz, 1500)
+	assert.Empty(t, m.Match())
+	wait(rematchCooldown)
+	assert.Len(t, m.Match(), 1)
+
+	// The same user never plays themselves
+	m.Add(a, aId, blitz, 1500)
+	m.Add(b, aId, blitz, 1500)
+	wait(time.Minute)
+	assert.Empty(t, m.Match())
+}
+
+func TestEstimatedWait(t *testing.T) {
+	m, wait := newTestMatchmaker()
+	assert.Equal(t, defaultEstimatedWait, m.EstimatedWait(blitz))
+
+	a, aId := newSeeker()
+	b, bId := newSeeker()
+	m.Add(a, aId, blitz, 1500)
+	wait(10 * time.Second)
+	m.Add(b, bId, blitz, 1500)
+	assert.Len(t, m.Match(), 1)
+
+	// The average of the two players' waits
+	assert.Equal(t, 7*time.Second, m.EstimatedWait(blitz))
+	assert.Equal(t, defaultEstimatedWait, m.EstimatedWait(GameSetting{TimeControl: chess.SuddenDeath(time.Minute)}))
+}
+
+func TestHandleWaitStartsGame(t *testing.T) {
+	h := NewGameHandler(NewMatchmaker(), NewChat(nil), storage.NewMemoryStorage(), nil, 0, nil).(*gameHandler)
+	a := newRecordingClient()
+	b := newRecordingClient()
+	h.handleRegister(a, auth.NewAnonymousUser())
+	h.handleRegister(b, auth.NewAnonymousUser())
+
+	h.handleWait(a, blitz)
+	assert.Equal(t, StatusWaiting, h.players.Get(a).status)
+	waiting, ok := a.sent()[0].(types.WaitingMsgOut)
+	assert.True(t, ok)
+	assert.Equal(t, int(defaultEstimatedWait.Seconds()), waiting.Payload.EstimatedWait)
+
+	h.handleWait(b, blitz)
+	assert.Equal(t, StatusPlaying, h.players.Get(a).status)
+	assert.Equal(t, StatusPlaying, h.players.Get(b).status)
+	assert.Same(t, h.players.Get(a).currentGame, h.players.Get(b).currentGame)
+	assert.Equal(t, 0, h.matchmaker.Len())
+
+	h.players.Get(a).currentGame.Game.Exit()
+}
@@ -0,0 +1,146 @@
+// Package rating rates players with the Glicko-2 system, described in
+// http://www.glicko.net/glicko/glicko2.pdf
+package rating
+
+import (
+	"math"
+	"time"
+)
+
+type Category string
+
+const (
+	Bullet Category = "bullet"
+	Blitz  Category = "blitz"
+	Rapid  Category = "rapid"
+)
+
+var Categories = []Category{Bullet, Blitz, Rapid}
+
+// Return the category of games expected to last the given time per player
+func CategoryOf(estimated time.Duration) Category {
+	switch {
+	case estimated < 3*time.Minute:
+		return Bullet
+	case estimated < 8*time.Minute:
+		return Blitz
+	}
+	return Rapid
+}
+
+const (
+	DefaultRating     = 1500
+	DefaultDeviation  = 350
+	DefaultVolatility = 0.06
+
+	// Deviation never gets lower, so ratings keep moving with results
+	MinDeviation = 45
+
+	// Constrains the change in volatility over time
+	tau = 0.5
+	// Converts ratings to and from the Glicko-2 scale
+	scale = 173.7178
+	// Precision of the volatility
+	epsilon = 0.000001
+)
+
+type Rating struct {
+	Rating     float64 `json:"rating" bson:"rating"`
+	Deviation  float64 `json:"deviation" bson:"deviation"`
+	Volatility float64 `json:"volatility" bson:"volatility"`
+}
+
+// Return the rating of a player without any rated game
+func New() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Score is 1 for a win, 0.5 for a draw and 0 for a loss
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expectedScore(mu, muOpponent, phiOpponent float64) float64 {
+	return 1 / (1 + math.Exp(-g(phiOpponent)*(mu-muOpponent)))
+}
+
+// Return the rating after a rating period with the given results. Without
+// results only the deviation grows.
+func (r Rating) Update(results []Result) Rating {
+	mu := (r.Rating - DefaultRating) / scale
+	phi := r.Deviation / scale
+
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + r.Volatility*r.Volatility)
+		return Rating{Rating: r.Rating, Deviation: math.Min(phi*scale, DefaultDeviation), Volatility: r.Volatility}
+	}
+
+	var vInv, sum float64
+	for _, result := range results {
+		muOpponent := (result.Opponent.Rating - DefaultRating) / scale
+		phiOpponent := result.Opponent.Deviation / scale
+		e := expectedScore(mu, muOpponent, phiOpponent)
+		vInv += g(phiOpponent) * g(phiOpponent) * e * (1 - e)
+		sum += g(phiOpponent) * (result.Score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma := newVolatility(phi, r.Volatility, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	return Rating{
+		Rating:     mu*scale + DefaultRating,
+		Deviation:  math.Max(math.Min(phi*scale, DefaultDeviation), MinDeviation),
+		Volatility: sigma,
+	}
+}
+
+// Find the new volatility with the Illinois algorithm, step 5 of the paper
+func newVolatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// Return the new ratings of two players after a game between them. Score is
+// the first player's.
+func Game(first, second Rating, score float64) (Rating, Rating) {
+	return first.Update([]Result{{Opponent: second, Score: score}}),
+		second.Update([]Result{{Opponent: first, Score: 1 - score}})
+}
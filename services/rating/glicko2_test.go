@@ -0,0 +1,51 @@
+package rating
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	// Example from the Glicko-2 paper
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	updated := player.Update([]Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: 0},
+	})
+	assert.InDelta(t, 1464.06, updated.Rating, 0.01)
+	assert.InDelta(t, 151.52, updated.Deviation, 0.01)
+	assert.InDelta(t, 0.05999, updated.Volatility, 0.00001)
+
+	idle := player.Update(nil)
+	assert.Equal(t, player.Rating, idle.Rating)
+	assert.Greater(t, idle.Deviation, player.Deviation)
+	assert.LessOrEqual(t, New().Update(nil).Deviation, float64(DefaultDeviation))
+}
+
+func TestGame(t *testing.T) {
+	winner, loser := Game(New(), New(), 1)
+	assert.Greater(t, winner.Rating, float64(DefaultRating))
+	assert.InDelta(t, DefaultRating-loser.Rating, winner.Rating-DefaultRating, 0.01)
+	assert.Less(t, winner.Deviation, float64(DefaultDeviation))
+
+	first, second := Game(New(), New(), 0.5)
+	assert.InDelta(t, DefaultRating, first.Rating, 0.01)
+	assert.InDelta(t, DefaultRating, second.Rating, 0.01)
+
+	// Beating a much weaker player gains little
+	strong := Rating{Rating: 2000, Deviation: 60, Volatility: 0.06}
+	weak := Rating{Rating: 1200, Deviation: 60, Volatility: 0.06}
+	after, _ := Game(strong, weak, 1)
+	assert.Less(t, after.Rating-strong.Rating, 2.0)
+	assert.GreaterOrEqual(t, after.Deviation, float64(MinDeviation))
+}
+
+func TestCategoryOf(t *testing.T) {
+	assert.Equal(t, Bullet, CategoryOf(time.Minute))
+	assert.Equal(t, Blitz, CategoryOf(3*time.Minute))
+	assert.Equal(t, Blitz, CategoryOf(5*time.Minute))
+	assert.Equal(t, Rapid, CategoryOf(10*time.Minute))
+}
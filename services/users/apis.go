@@ -3,12 +3,15 @@ package users
 import (
 	"errors"
 	"net/http"
+	"slices"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sina-am/chess/core"
 	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/storage"
 	"github.com/sina-am/chess/types"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type APIService struct {
@@ -39,6 +42,13 @@ func (s *APIService) RegistrationAPI(c echo.Context) error {
 		return err
 	}
 
+	// Games played before registering belong to the new account
+	if guest := s.Authenticator.GetUser(c); !guest.IsAuthenticated() {
+		if _, err := s.Storage.ClaimGames(c.Request().Context(), guest.GetId(), user); err != nil {
+			return err
+		}
+	}
+
 	return c.JSON(http.StatusCreated, map[string]string{"message": "created"})
 }
 
@@ -63,6 +73,13 @@ func (s *APIService) AuthenticationPOST(c echo.Context) error {
 		return err
 	}
 
+	// Games played as a guest since registering belong to the account too
+	if guest := s.Authenticator.GetUser(c); !guest.IsAuthenticated() {
+		if _, err := s.Storage.ClaimGames(c.Request().Context(), guest.GetId(), user); err != nil {
+			return err
+		}
+	}
+
 	if err := s.Authenticator.Login(c, user); err != nil {
 		return err
 	}
@@ -81,3 +98,28 @@ func (s *APIService) UsersAPI(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, users)
 }
+
+type ratingHistoryIn struct {
+	Category rating.Category `query:"category"`
+}
+
+// Return the ratings of a user after each rated game in a category, for graphs
+func (s *APIService) RatingHistoryAPI(c echo.Context) error {
+	userId, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid user id"})
+	}
+	in := ratingHistoryIn{}
+	if err := c.Bind(&in); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": err.Error()})
+	}
+	if !slices.Contains(rating.Categories, in.Category) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "invalid rating category"})
+	}
+
+	history, err := s.Storage.GetRatingHistory(c.Request().Context(), userId, in.Category)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, history)
+}
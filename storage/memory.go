@@ -4,25 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
 
 	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Games, ratings and analyses are saved outside the request goroutines, so
+// every method holds mu
 type memoryStorage struct {
+	mu    sync.Mutex
 	users []*types.User
 	games []*types.Game
+
+	ratingHistory []*types.RatingChange
+	analyses      map[primitive.ObjectID]types.GameAnalysis
+	chatReports   []*types.ChatReport
 }
 
 func NewMemoryStorage() *memoryStorage {
 	return &memoryStorage{
 		users: make([]*types.User, 0),
 		games: make([]*types.Game, 0),
+
+		ratingHistory: make([]*types.RatingChange, 0),
+		analyses:      make(map[primitive.ObjectID]types.GameAnalysis),
+		chatReports:   make([]*types.ChatReport, 0),
 	}
 }
 
 func (db *memoryStorage) UpdateUser(ctx context.Context, user *types.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	for i := range db.users {
 		if db.users[i].Id == user.Id {
 			db.users[i] = user
@@ -33,16 +50,26 @@ func (db *memoryStorage) UpdateUser(ctx context.Context, user *types.User) error
 }
 
 func (db *memoryStorage) GetAllUsers(ctx context.Context) ([]*types.User, error) {
-	return db.users, nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]*types.User{}, db.users...), nil
 }
 
 func (db *memoryStorage) InsertUser(ctx context.Context, user *types.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	user.Id = primitive.NewObjectID()
 	db.users = append(db.users, user)
 	return nil
 }
 
 func (db *memoryStorage) GetUserById(ctx context.Context, id primitive.ObjectID) (*types.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.userById(id)
+}
+
+func (db *memoryStorage) userById(id primitive.ObjectID) (*types.User, error) {
 	for _, user := range db.users {
 		if user.Id == id {
 			return user, nil
@@ -51,7 +78,19 @@ func (db *memoryStorage) GetUserById(ctx context.Context, id primitive.ObjectID)
 	return nil, ErrNoRecord
 }
 
+// Put the user in place of the stored one with the same id
+func (db *memoryStorage) replaceUser(user *types.User) {
+	for i := range db.users {
+		if db.users[i].Id == user.Id {
+			db.users[i] = user
+			return
+		}
+	}
+}
+
 func (db *memoryStorage) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	for _, user := range db.users {
 		if user.Email == email {
 			return user, nil
@@ -79,15 +118,174 @@ func (db *memoryStorage) InsertGame(ctx context.Context, game *types.Game) error
 	if len(game.Players) != 2 {
 		return fmt.Errorf("invalid number of players")
 	}
-	user1, err := db.GetUserById(ctx, game.Players[0].UserId)
-	if err != nil {
-		return err
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if game.Id.IsZero() {
+		game.Id = primitive.NewObjectID()
 	}
-	user2, err := db.GetUserById(ctx, game.Players[1].UserId)
-	if err != nil {
-		return err
+	for i := range game.Players {
+		if user := db.userByGuestId(game.Players[i]); user != nil {
+			claimPlayer(&game.Players[i], user)
+		}
+	}
+	db.games = append(db.games, game)
+	return nil
+}
+
+func (db *memoryStorage) GetGameById(ctx context.Context, id primitive.ObjectID) (*types.Game, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, game := range db.games {
+		if game.Id == id {
+			return game, nil
+		}
+	}
+	return nil, ErrNoRecord
+}
+
+// Return the user's games, the most recent first
+func (db *memoryStorage) ListGamesByUser(ctx context.Context, userId primitive.ObjectID, page Page) ([]*types.Game, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	games := []*types.Game{}
+	for i := len(db.games) - 1; i >= 0; i-- {
+		for _, player := range db.games[i].Players {
+			if player.UserId == userId {
+				games = append(games, db.games[i])
+				break
+			}
+		}
+	}
+
+	page = page.normalize()
+	start := min(page.offset(), len(games))
+	end := min(start+page.Size, len(games))
+	return games[start:end], nil
+}
+
+// Return the user who was the anonymous player as a guest, if any
+func (db *memoryStorage) userByGuestId(player types.Player) *types.User {
+	if !player.Anonymous {
+		return nil
+	}
+	for _, user := range db.users {
+		if slices.Contains(user.GuestIds, player.UserId) {
+			return user
+		}
+	}
+	return nil
+}
+
+func claimPlayer(player *types.Player, user *types.User) {
+	player.UserId, player.Name, player.Anonymous = user.Id, user.Name, false
+}
+
+// Give the games played as a guest with the anonymous id to the user and
+// return how many were claimed. Games of the guest saved later, like one
+// still being played, are given to the user too.
+func (db *memoryStorage) ClaimGames(ctx context.Context, anonymousId primitive.ObjectID, user *types.User) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if stored, err := db.userById(user.Id); err == nil && !slices.Contains(stored.GuestIds, anonymousId) {
+		updated := *stored
+		updated.GuestIds = append(slices.Clone(stored.GuestIds), anonymousId)
+		db.replaceUser(&updated)
+	}
+
+	// Games handed out before keep their players, the claimed ones are copies
+	claimed := 0
+	for i, game := range db.games {
+		var players []types.Player
+		for j, player := range game.Players {
+			if player.Anonymous && player.UserId == anonymousId {
+				if players == nil {
+					players = slices.Clone(game.Players)
+				}
+				claimPlayer(&players[j], user)
+				claimed++
+			}
+		}
+		if players != nil {
+			updated := *game
+			updated.Players = players
+			db.games[i] = &updated
+		}
+	}
+	return claimed, nil
+}
+
+// Set the new ratings of the users and record the changes. Either every
+// change is applied or none is.
+func (db *memoryStorage) ApplyRatingChanges(ctx context.Context, changes []*types.RatingChange) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	users := make([]*types.User, len(changes))
+	for i, change := range changes {
+		user, err := db.userById(change.UserId)
+		if err != nil {
+			return err
+		}
+		users[i] = user
+	}
+
+	// Users handed out before keep their ratings, the changed ones are copies
+	updated := map[primitive.ObjectID]*types.User{}
+	for i, change := range changes {
+		user, ok := updated[users[i].Id]
+		if !ok {
+			copied := *users[i]
+			copied.Ratings = maps.Clone(users[i].Ratings)
+			if copied.Ratings == nil {
+				copied.Ratings = map[rating.Category]rating.Rating{}
+			}
+			user = &copied
+			updated[user.Id] = user
+		}
+		user.Ratings[change.Category] = change.After
+		db.ratingHistory = append(db.ratingHistory, change)
+	}
+	for _, user := range updated {
+		db.replaceUser(user)
+	}
+	return nil
+}
+
+// Return the rating changes of the user in the category, the oldest first
+func (db *memoryStorage) GetRatingHistory(ctx context.Context, userId primitive.ObjectID, category rating.Category) ([]*types.RatingChange, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	history := []*types.RatingChange{}
+	for _, change := range db.ratingHistory {
+		if change.UserId == userId && change.Category == category {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+func (db *memoryStorage) SaveAnalysis(ctx context.Context, analysis *types.GameAnalysis) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.analyses[analysis.GameId] = *analysis
+	return nil
+}
+
+func (db *memoryStorage) GetAnalysisByGameId(ctx context.Context, gameId primitive.ObjectID) (*types.GameAnalysis, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	analysis, ok := db.analyses[gameId]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+	return &analysis, nil
+}
+
+func (db *memoryStorage) InsertChatReport(ctx context.Context, report *types.ChatReport) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if report.Id.IsZero() {
+		report.Id = primitive.NewObjectID()
 	}
-	user1.Games = append(user1.Games, *game)
-	user2.Games = append(user2.Games, *game)
+	db.chatReports = append(db.chatReports, report)
 	return nil
 }
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sina-am/chess/chess"
+	"github.com/sina-am/chess/services/rating"
+	"github.com/sina-am/chess/types"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryGames(t *testing.T) {
+	db := NewMemoryStorage()
+	ctx := context.Background()
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+
+	ids := []primitive.ObjectID{}
+	for i := 0; i < 5; i++ {
+		game := &types.Game{Players: []types.Player{
+			{UserId: user, Color: chess.White},
+			{UserId: other, Color: chess.Black},
+		}}
+		assert.Nil(t, db.InsertGame(ctx, game))
+		assert.False(t, game.Id.IsZero())
+		ids = append(ids, game.Id)
+	}
+	assert.NotNil(t, db.InsertGame(ctx, &types.Game{}))
+
+	game, err := db.GetGameById(ctx, ids[2])
+	assert.Nil(t, err)
+	assert.Equal(t, ids[2], game.Id)
+	_, err = db.GetGameById(ctx, primitive.NewObjectID())
+	assert.ErrorIs(t, err, ErrNoRecord)
+
+	games, err := db.ListGamesByUser(ctx, user, Page{Number: 1, Size: 2})
+	assert.Nil(t, err)
+	assert.Len(t, games, 2)
+	assert.Equal(t, ids[4], games[0].Id)
+
+	games, err = db.ListGamesByUser(ctx, other, Page{Number: 3, Size: 2})
+	assert.Nil(t, err)
+	assert.Len(t, games, 1)
+	assert.Equal(t, ids[0], games[0].Id)
+
+	games, err = db.ListGamesByUser(ctx, other, Page{Number: 4, Size: 2})
+	assert.Nil(t, err)
+	assert.Empty(t, games)
+
+	games, err = db.ListGamesByUser(ctx, primitive.NewObjectID(), Page{})
+	assert.Nil(t, err)
+	assert.Empty(t, games)
+}
+
+func TestMemoryClaimGames(t *testing.T) {
+	db := NewMemoryStorage()
+	ctx := context.Background()
+	guest, opponent := primitive.NewObjectID(), primitive.NewObjectID()
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, db.InsertGame(ctx, &types.Game{Players: []types.Player{
+			{UserId: guest, Name: "anonymous", Color: chess.White, Anonymous: true},
+			{UserId: opponent, Name: "opponent", Color: chess.Black},
+		}}))
+	}
+
+	before, err := db.ListGamesByUser(ctx, guest, Page{})
+	assert.Nil(t, err)
+
+	user := types.NewUser("guest@example.com", "guest", "password")
+	assert.Nil(t, db.InsertUser(ctx, user))
+	claimed, err := db.ClaimGames(ctx, guest, user)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, claimed)
+
+	games, err := db.ListGamesByUser(ctx, user.Id, Page{})
+	assert.Nil(t, err)
+	assert.Len(t, games, 2)
+	assert.Equal(t, "guest", games[0].Players[0].Name)
+	assert.False(t, games[0].Players[0].Anonymous)
+
+	// Games read before the claim stay as they were
+	assert.True(t, before[0].Players[0].Anonymous)
+
+	// Claimed games can't be claimed again
+	claimed, err = db.ClaimGames(ctx, guest, user)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, claimed)
+	claimed, err = db.ClaimGames(ctx, opponent, user)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, claimed)
+}
+
+func TestMemoryClaimGamesSavedLater(t *testing.T) {
+	db := NewMemoryStorage()
+	ctx := context.Background()
+	user := types.NewUser("guest@example.com", "guest", "password")
+	assert.Nil(t, db.InsertUser(ctx, user))
+
+	// The guest registers mid-game and the game is saved when it ends
+	guest, opponent := primitive.NewObjectID(), primitive.NewObjectID()
+	claimed, err := db.ClaimGames(ctx, guest, user)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, claimed)
+	assert.Nil(t, db.InsertGame(ctx, &types.Game{Players: []types.Player{
+		{UserId: opponent, Name: "anonymous", Color: chess.White, Anonymous: true},
+		{UserId: guest, Name: "anonymous", Color: chess.Black, Anonymous: true},
+	}}))
+
+	games, err := db.ListGamesByUser(ctx, user.Id, Page{})
+	assert.Nil(t, err)
+	assert.Len(t, games, 1)
+	assert.Equal(t, "guest", games[0].Players[1].Name)
+	assert.False(t, games[0].Players[1].Anonymous)
+	assert.True(t, games[0].Players[0].Anonymous)
+}
+
+// Users are encoded by the HTTP handlers while games end and change their
+// ratings, run with -race
+func TestMemoryRatingChangesWhileReading(t *testing.T) {
+	db := NewMemoryStorage()
+	ctx := context.Background()
+	user := types.NewUser("user@example.com", "user", "password")
+	assert.Nil(t, db.InsertUser(ctx, user))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.ApplyRatingChanges(ctx, []*types.RatingChange{{
+				UserId:   user.Id,
+				Category: rating.Categories[i%len(rating.Categories)],
+				After:    rating.Rating{Rating: float64(1500 + i)},
+			}}))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		users, err := db.GetAllUsers(ctx)
+		assert.Nil(t, err)
+		_, err = json.Marshal(users)
+		assert.Nil(t, err)
+	}
+	<-done
+
+	stored, err := db.GetUserById(ctx, user.Id)
+	assert.Nil(t, err)
+	assert.Len(t, stored.Ratings, len(rating.Categories))
+	assert.Equal(t, float64(1599), stored.Rating(rating.Categories[99%len(rating.Categories)]).Rating)
+}
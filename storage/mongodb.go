@@ -7,6 +7,7 @@ import (
 
 	"github.com/sina-am/chess/config"
 	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -30,6 +31,9 @@ func NewMongoStorage(ctx context.Context, cfg *config.Database) (*mongoStorage,
 	}
 
 	insertMongoIndexes(ctx, client.Database(cfg.Name))
+	if err := migrateUserGames(ctx, client.Database(cfg.Name)); err != nil {
+		return nil, fmt.Errorf("database error: migrating user games: %s", err.Error())
+	}
 	return &mongoStorage{
 		client:       client,
 		databaseName: cfg.Name,
@@ -44,12 +48,71 @@ func insertMongoIndexes(ctx context.Context, database *mongo.Database) {
 	}
 	collection.Indexes().CreateOne(ctx, indexModel)
 
+	database.Collection("rating_history").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "category", Value: 1}, {Key: "time", Value: 1}},
+	})
+	database.Collection("games").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "players.user_id", Value: 1}, {Key: "ended_at", Value: -1}},
+	})
+}
+
+// Games used to be pushed to the games field of both players. Move them to
+// the games collection, where they're kept since, and drop the field. It
+// does nothing once no user has the field left.
+func migrateUserGames(ctx context.Context, database *mongo.Database) error {
+	users := database.Collection("users")
+	hasGames := bson.M{"games": bson.M{"$exists": true}}
+	cur, err := users.Find(ctx, hasGames)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	games := database.Collection("games")
+	for cur.Next(ctx) {
+		user := struct {
+			Games []bson.M `bson:"games"`
+		}{}
+		if err := cur.Decode(&user); err != nil {
+			return err
+		}
+		for _, game := range user.Games {
+			id := game["_id"]
+			delete(game, "_id")
+			_, err := games.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$setOnInsert": game}, options.Update().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	_, err = users.UpdateMany(ctx, hasGames, bson.M{"$unset": bson.M{"games": ""}})
+	return err
 }
 
 func (db *mongoStorage) getUserCollection() *mongo.Collection {
 	return db.client.Database(db.databaseName).Collection("users")
 }
 
+func (db *mongoStorage) getGameCollection() *mongo.Collection {
+	return db.client.Database(db.databaseName).Collection("games")
+}
+
+func (db *mongoStorage) getRatingHistoryCollection() *mongo.Collection {
+	return db.client.Database(db.databaseName).Collection("rating_history")
+}
+
+func (db *mongoStorage) getAnalysisCollection() *mongo.Collection {
+	return db.client.Database(db.databaseName).Collection("analyses")
+}
+
+func (db *mongoStorage) getChatReportCollection() *mongo.Collection {
+	return db.client.Database(db.databaseName).Collection("chat_reports")
+}
+
 func (db *mongoStorage) findUser(ctx context.Context, filter any) (*types.User, error) {
 	collection := db.getUserCollection()
 	document := collection.FindOne(ctx, filter)
@@ -94,6 +157,9 @@ func (db *mongoStorage) InsertUser(ctx context.Context, user *types.User) error
 	if _, err := db.GetUserByEmail(ctx, user.Email); err == nil {
 		return fmt.Errorf("user with email %s already exist", user.Email)
 	}
+	if user.Id.IsZero() {
+		user.Id = primitive.NewObjectID()
+	}
 	_, err := collection.InsertOne(ctx, user)
 
 	return err
@@ -117,17 +183,142 @@ func (db *mongoStorage) InsertGame(ctx context.Context, game *types.Game) error
 	if len(game.Players) != 2 {
 		return fmt.Errorf("invalid number of players")
 	}
-	collection := db.getUserCollection()
-	game.Id = primitive.NewObjectID()
-	_, err := collection.UpdateMany(
+	collection := db.getGameCollection()
+	if game.Id.IsZero() {
+		game.Id = primitive.NewObjectID()
+	}
+	for i := range game.Players {
+		player := &game.Players[i]
+		if !player.Anonymous {
+			continue
+		}
+		user, err := db.findUser(ctx, bson.M{"guest_ids": player.UserId})
+		if err == nil {
+			player.UserId, player.Name, player.Anonymous = user.Id, user.Name, false
+		} else if !errors.Is(err, ErrNoRecord) {
+			return err
+		}
+	}
+	_, err := collection.InsertOne(ctx, game)
+
+	return err
+}
+
+func (db *mongoStorage) GetGameById(ctx context.Context, id primitive.ObjectID) (*types.Game, error) {
+	collection := db.getGameCollection()
+	game := &types.Game{}
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(game); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return game, nil
+}
+
+// Return the user's games, the most recent first
+func (db *mongoStorage) ListGamesByUser(ctx context.Context, userId primitive.ObjectID, page Page) ([]*types.Game, error) {
+	collection := db.getGameCollection()
+	page = page.normalize()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ended_at", Value: -1}}).
+		SetSkip(int64(page.offset())).
+		SetLimit(int64(page.Size))
+	cur, err := collection.Find(ctx, bson.M{"players.user_id": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	games := []*types.Game{}
+	if err := cur.All(ctx, &games); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// Give the games played as a guest with the anonymous id to the user and
+// return how many were claimed. Games of the guest saved later, like one
+// still being played, are given to the user too.
+func (db *mongoStorage) ClaimGames(ctx context.Context, anonymousId primitive.ObjectID, user *types.User) (int, error) {
+	_, err := db.getUserCollection().UpdateOne(
 		ctx,
-		bson.M{"$or": bson.A{bson.M{"_id": game.Players[0].UserId}, bson.M{"_id": game.Players[1].UserId}}},
-		bson.M{"$push": bson.M{"games": game}},
+		bson.M{"_id": user.Id},
+		bson.M{"$addToSet": bson.M{"guest_ids": anonymousId}},
 	)
+	if err != nil {
+		return 0, err
+	}
 
+	collection := db.getGameCollection()
+	guest := bson.M{"user_id": anonymousId, "anonymous": true}
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{"players": bson.M{"$elemMatch": guest}},
+		bson.M{"$set": bson.M{
+			"players.$[guest].user_id":   user.Id,
+			"players.$[guest].name":      user.Name,
+			"players.$[guest].anonymous": false,
+		}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []any{bson.M{"guest.user_id": anonymousId, "guest.anonymous": true}},
+		}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// Set the new ratings of the users and record the changes in a transaction,
+// which needs MongoDB to run as a replica set
+func (db *mongoStorage) ApplyRatingChanges(ctx context.Context, changes []*types.RatingChange) error {
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		for _, change := range changes {
+			result, err := db.getUserCollection().UpdateOne(
+				ctx,
+				bson.M{"_id": change.UserId},
+				bson.M{"$set": bson.M{"ratings." + string(change.Category): change.After}},
+			)
+			if err != nil {
+				return nil, err
+			}
+			if result.MatchedCount == 0 {
+				return nil, ErrNoRecord
+			}
+			if _, err := db.getRatingHistoryCollection().InsertOne(ctx, change); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
 	return err
 }
 
+// Return the rating changes of the user in the category, the oldest first
+func (db *mongoStorage) GetRatingHistory(ctx context.Context, userId primitive.ObjectID, category rating.Category) ([]*types.RatingChange, error) {
+	collection := db.getRatingHistoryCollection()
+	cur, err := collection.Find(
+		ctx,
+		bson.M{"user_id": userId, "category": category},
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []*types.RatingChange{}
+	if err := cur.All(ctx, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
 func (db *mongoStorage) AuthenticateUser(ctx context.Context, email string, plainPassword string) (*types.User, error) {
 	user, err := db.GetUserByEmail(ctx, email)
 	if err != nil {
@@ -142,3 +333,35 @@ func (db *mongoStorage) AuthenticateUser(ctx context.Context, email string, plai
 	}
 	return user, nil
 }
+
+func (db *mongoStorage) SaveAnalysis(ctx context.Context, analysis *types.GameAnalysis) error {
+	collection := db.getAnalysisCollection()
+	_, err := collection.ReplaceOne(
+		ctx,
+		bson.M{"_id": analysis.GameId},
+		analysis,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (db *mongoStorage) GetAnalysisByGameId(ctx context.Context, gameId primitive.ObjectID) (*types.GameAnalysis, error) {
+	collection := db.getAnalysisCollection()
+	analysis := &types.GameAnalysis{}
+	if err := collection.FindOne(ctx, bson.M{"_id": gameId}).Decode(analysis); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return analysis, nil
+}
+
+func (db *mongoStorage) InsertChatReport(ctx context.Context, report *types.ChatReport) error {
+	collection := db.getChatReportCollection()
+	if report.Id.IsZero() {
+		report.Id = primitive.NewObjectID()
+	}
+	_, err := collection.InsertOne(ctx, report)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/sina-am/chess/services/rating"
 	"github.com/sina-am/chess/types"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -21,4 +22,40 @@ type Storage interface {
 	GetUserByEmail(ctx context.Context, email string) (*types.User, error)
 	AuthenticateUser(ctx context.Context, email string, plainPassword string) (*types.User, error)
 	InsertGame(ctx context.Context, game *types.Game) error
+	GetGameById(ctx context.Context, id primitive.ObjectID) (*types.Game, error)
+	ListGamesByUser(ctx context.Context, userId primitive.ObjectID, page Page) ([]*types.Game, error)
+	ClaimGames(ctx context.Context, anonymousId primitive.ObjectID, user *types.User) (int, error)
+	ApplyRatingChanges(ctx context.Context, changes []*types.RatingChange) error
+	GetRatingHistory(ctx context.Context, userId primitive.ObjectID, category rating.Category) ([]*types.RatingChange, error)
+	SaveAnalysis(ctx context.Context, analysis *types.GameAnalysis) error
+	GetAnalysisByGameId(ctx context.Context, gameId primitive.ObjectID) (*types.GameAnalysis, error)
+	InsertChatReport(ctx context.Context, report *types.ChatReport) error
+}
+
+// A page of a list, counted from 1
+type Page struct {
+	Number int
+	Size   int
+}
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Return the page with its number and size brought within limits
+func (p Page) normalize() Page {
+	if p.Number < 1 {
+		p.Number = 1
+	}
+	if p.Size < 1 {
+		p.Size = DefaultPageSize
+	} else if p.Size > MaxPageSize {
+		p.Size = MaxPageSize
+	}
+	return p
+}
+
+func (p Page) offset() int {
+	return (p.Number - 1) * p.Size
 }
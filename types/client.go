@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/sina-am/chess/chess"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -11,6 +13,29 @@ const (
 	StartedClientEvent ClientEventType = "started"
 	EndGameClientEvent ClientEventType = "ended"
 	PlayedClientEvent  ClientEventType = "played"
+	WaitingClientEvent ClientEventType = "waiting"
+	ClockClientEvent   ClientEventType = "clock"
+	ResumedClientEvent ClientEventType = "resumed"
+
+	OpponentDisconnectedClientEvent ClientEventType = "opponentDisconnected"
+	OpponentReconnectedClientEvent  ClientEventType = "opponentReconnected"
+
+	TakebackOfferedClientEvent ClientEventType = "takebackOffered"
+	TakenBackClientEvent       ClientEventType = "takenBack"
+
+	WatchingClientEvent   ClientEventType = "watching"
+	SpectatorsClientEvent ClientEventType = "spectators"
+
+	ChatClientEvent ClientEventType = "chat"
+
+	RematchOfferedClientEvent  ClientEventType = "rematchOffered"
+	RematchCanceledClientEvent ClientEventType = "rematchCanceled"
+
+	ChallengeCreatedClientEvent  ClientEventType = "challengeCreated"
+	ChallengedClientEvent        ClientEventType = "challenged"
+	ChallengeDeclinedClientEvent ClientEventType = "challengeDeclined"
+	ChallengeCanceledClientEvent ClientEventType = "challengeCanceled"
+	ChallengeExpiredClientEvent  ClientEventType = "challengeExpired"
 )
 
 type ServerEventType string
@@ -21,12 +46,99 @@ const (
 	ExitServerEvent         ServerEventType = "exit"
 	OfferDrawServerEvent    ServerEventType = "offerDraw"
 	ResponseDrawServerEvent ServerEventType = "respondDraw"
+	ClaimDrawServerEvent    ServerEventType = "claimDraw"
+
+	OfferTakebackServerEvent    ServerEventType = "offerTakeback"
+	ResponseTakebackServerEvent ServerEventType = "respondTakeback"
+
+	WatchServerEvent   ServerEventType = "watch"
+	UnwatchServerEvent ServerEventType = "unwatch"
+
+	ChatServerEvent   ServerEventType = "chat"
+	MuteServerEvent   ServerEventType = "mute"
+	UnmuteServerEvent ServerEventType = "unmute"
+	ReportServerEvent ServerEventType = "report"
+
+	OfferRematchServerEvent    ServerEventType = "offerRematch"
+	ResponseRematchServerEvent ServerEventType = "respondRematch"
+
+	ChallengeServerEvent        ServerEventType = "challenge"
+	AcceptChallengeServerEvent  ServerEventType = "acceptChallenge"
+	DeclineChallengeServerEvent ServerEventType = "declineChallenge"
+	CancelChallengeServerEvent  ServerEventType = "cancelChallenge"
+)
+
+type Opponent string
+
+const (
+	HumanOpponent    Opponent = "human"
+	ComputerOpponent Opponent = "computer"
+	EngineOpponent   Opponent = "engine" // The external UCI engine, if the server has one
 )
 
+// Moves is 0 in the last stage, which lasts until the end of the game
+type TimeStageMsg struct {
+	Moves   int `json:"moves,omitempty"`
+	Seconds int `json:"seconds"`
+}
+
+// Bonus is the increment or delay in seconds, depending on the mode. Name
+// is a short description like 3+2, set only in messages from the server.
+type TimeControlMsg struct {
+	Name   string          `json:"name,omitempty"`
+	Stages []TimeStageMsg  `json:"stages"`
+	Mode   chess.ClockMode `json:"mode"`
+	Bonus  int             `json:"bonus"`
+}
+
+func NewTimeControlMsg(tc chess.TimeControl) TimeControlMsg {
+	msg := TimeControlMsg{
+		Name:   tc.String(),
+		Stages: make([]TimeStageMsg, len(tc.Stages)),
+		Mode:   tc.Mode,
+		Bonus:  int(tc.Bonus.Seconds()),
+	}
+	for i, stage := range tc.Stages {
+		msg.Stages[i] = TimeStageMsg{Moves: stage.Moves, Seconds: int(stage.Time.Seconds())}
+	}
+	return msg
+}
+
+func (m TimeControlMsg) TimeControl() chess.TimeControl {
+	tc := chess.TimeControl{
+		Stages: make([]chess.TimeStage, len(m.Stages)),
+		Mode:   m.Mode,
+		Bonus:  time.Duration(m.Bonus) * time.Second,
+	}
+	if tc.Mode == "" {
+		tc.Mode = chess.Increment
+	}
+	for i, stage := range m.Stages {
+		tc.Stages[i] = chess.TimeStage{Moves: stage.Moves, Time: time.Duration(stage.Seconds) * time.Second}
+	}
+	return tc
+}
+
+// Duration is the minutes of a game without bonus, used when TimeControl
+// isn't set. Level is the strength of the computer from 1 to 5, used only
+// when playing against the computer.
 type StartGameMsgIn struct {
-	Id       string `json:"id,omitempty"`
-	Name     string `json:"name"`
-	Duration int    `json:"duration"`
+	Id          string          `json:"id,omitempty"`
+	Name        string          `json:"name"`
+	Duration    int             `json:"duration"`
+	TimeControl *TimeControlMsg `json:"timeControl,omitempty"`
+	Opponent    Opponent        `json:"opponent,omitempty"`
+	Level       int             `json:"level,omitempty"`
+}
+
+type WaitingMsgOut struct {
+	Type    ClientEventType      `json:"type"`
+	Payload WaitingPayloadMsgOut `json:"payload"`
+}
+
+// EstimatedWait is in seconds
+type WaitingPayloadMsgOut struct {
+	EstimatedWait int `json:"estimatedWait"`
 }
 
 type StartGameMsgOut struct {
@@ -35,12 +147,160 @@ type StartGameMsgOut struct {
 }
 
 type StartGamePayloadMsgOut struct {
-	Opponent Player `json:"opponent"`
-	You      Player `json:"you"`
+	Opponent    Player         `json:"opponent"`
+	You         Player         `json:"you"`
+	TimeControl TimeControlMsg `json:"timeControl"`
+	Clock       *ClockMsg      `json:"clock,omitempty"`
+}
+
+type ResumeGameMsgOut struct {
+	Type    ClientEventType         `json:"type"`
+	Payload ResumeGamePayloadMsgOut `json:"payload"`
+}
+
+// The state of a game a player gets back after reconnecting
+type ResumeGamePayloadMsgOut struct {
+	Opponent    Player         `json:"opponent"`
+	You         Player         `json:"you"`
+	TimeControl TimeControlMsg `json:"timeControl"`
+	FEN         string         `json:"fen"`
+	Moves       []GameMove     `json:"moves"`
+	Clock       *ClockMsg      `json:"clock,omitempty"`
+
+	// Legal moves of the side to move
+	LegalMoves []chess.Move `json:"legalMoves"`
+}
+
+type ChatMsgIn struct {
+	Text string `json:"text"`
+}
+
+// The user muted, unmuted or reported. Reason is only used in reports.
+type ChatUserMsgIn struct {
+	UserId primitive.ObjectID `json:"userId"`
+	Reason string             `json:"reason,omitempty"`
+}
+
+type ChatMsgOut struct {
+	Type    ClientEventType `json:"type"`
+	Payload ChatMessage     `json:"payload"`
+}
+
+// The color the challenger plays
+type ChallengeColor string
+
+const (
+	RandomChallengeColor ChallengeColor = "random"
+	WhiteChallengeColor  ChallengeColor = "white"
+	BlackChallengeColor  ChallengeColor = "black"
+)
+
+// UserId is the challenged user, anybody with the link of the challenge
+// can accept it if it's not set. The time control is given like in
+// StartGameMsgIn and the color is random if it's not set.
+type ChallengeMsgIn struct {
+	UserId      primitive.ObjectID `json:"userId,omitempty"`
+	Duration    int                `json:"duration"`
+	TimeControl *TimeControlMsg    `json:"timeControl,omitempty"`
+	Color       ChallengeColor     `json:"color,omitempty"`
+}
+
+// Used to accept, decline or cancel a challenge
+type ChallengeIdMsgIn struct {
+	ChallengeId primitive.ObjectID `json:"challengeId"`
+}
+
+type ChallengeMsgOut struct {
+	Type    ClientEventType `json:"type"`
+	Payload Challenge       `json:"payload"`
+}
+
+// ChallengedId is zero for a challenge open to anybody with its URL
+type Challenge struct {
+	Id           primitive.ObjectID `json:"id"`
+	Challenger   Player             `json:"challenger"`
+	ChallengedId primitive.ObjectID `json:"challengedId,omitempty"`
+	TimeControl  TimeControlMsg     `json:"timeControl"`
+	Color        ChallengeColor     `json:"color"`
+	URL          string             `json:"url"`
+	ExpiresAt    time.Time          `json:"expiresAt"`
 }
 
+type WatchGameMsgIn struct {
+	GameId primitive.ObjectID `json:"gameId"`
+}
+
+type WatchGameMsgOut struct {
+	Type    ClientEventType        `json:"type"`
+	Payload WatchGamePayloadMsgOut `json:"payload"`
+}
+
+// The state of a game a spectator gets when starting to watch it, the
+// moves that follow are sent like to the players
+type WatchGamePayloadMsgOut struct {
+	GameId      primitive.ObjectID `json:"gameId"`
+	White       Player             `json:"white"`
+	Black       Player             `json:"black"`
+	TimeControl TimeControlMsg     `json:"timeControl"`
+	FEN         string             `json:"fen"`
+	Moves       []GameMove         `json:"moves"`
+	Clock       *ClockMsg          `json:"clock,omitempty"`
+	Spectators  int                `json:"spectators"`
+}
+
+type SpectatorsMsgOut struct {
+	Type    ClientEventType         `json:"type"`
+	Payload SpectatorsPayloadMsgOut `json:"payload"`
+}
+
+type SpectatorsPayloadMsgOut struct {
+	Count int `json:"count"`
+}
+
+// A game being played, as listed to the players looking for one to watch
+type LiveGame struct {
+	Id          primitive.ObjectID `json:"id"`
+	White       Player             `json:"white"`
+	Black       Player             `json:"black"`
+	TimeControl string             `json:"timeControl"`
+	Moves       int                `json:"moves"`
+	Spectators  int                `json:"spectators"`
+	StartedAt   time.Time          `json:"startedAt"`
+}
+
+type OpponentDisconnectedMsgOut struct {
+	Type    ClientEventType                   `json:"type"`
+	Payload OpponentDisconnectedPayloadMsgOut `json:"payload"`
+}
+
+// GracePeriod is the number of seconds the opponent has to come back
+type OpponentDisconnectedPayloadMsgOut struct {
+	GracePeriod int `json:"gracePeriod"`
+}
+
+// Remaining times of both players in milliseconds. The clock of the side
+// to move is already reduced by Lag, the measured delay until the message
+// reaches the player. ServerTime is the unix time in milliseconds when the
+// message was sent.
+type ClockMsg struct {
+	White      int64       `json:"white"`
+	Black      int64       `json:"black"`
+	Turn       chess.Color `json:"turn"`
+	Lag        int64       `json:"lag"`
+	ServerTime int64       `json:"serverTime"`
+}
+
+type ClockMsgOut struct {
+	Type    ClientEventType `json:"type"`
+	Payload ClockMsg        `json:"payload"`
+}
+
+// A move is given either as a coordinate object or as a string in
+// standard algebraic (san) or long algebraic (uci) notation
 type PlayGameMsgIn struct {
 	Move chess.Move `json:"move"`
+	SAN  string     `json:"san,omitempty"`
+	UCI  string     `json:"uci,omitempty"`
 }
 
 type PlayGameMsgOut struct {
@@ -51,6 +311,13 @@ type PlayGameMsgOut struct {
 type PlayGamePayloadMsgOut struct {
 	Player primitive.ObjectID `json:"player"`
 	Move   chess.Move         `json:"move"`
+	SAN    string             `json:"san"`
+	UCI    string             `json:"uci"`
+
+	// Legal moves of the side to move after this move
+	LegalMoves []chess.Move `json:"legalMoves"`
+
+	Clock *ClockMsg `json:"clock,omitempty"`
 }
 
 type EndGameMsgOut struct {
@@ -58,8 +325,27 @@ type EndGameMsgOut struct {
 	Payload EndGamePayloadMsgOut `json:"payload"`
 }
 
+// GameId identifies the game in the analysis API. Score is the change of
+// the player's rating and Rating the new one, both 0 if the game is unrated.
 type EndGamePayloadMsgOut struct {
-	Winner chess.Color  `json:"winner"`
-	Score  int          `json:"score"`
-	Reason chess.Reason `json:"reason"`
+	GameId primitive.ObjectID `json:"gameId"`
+	Winner chess.Color        `json:"winner"`
+	Score  int                `json:"score"`
+	Rating int                `json:"rating"`
+	Reason chess.Reason       `json:"reason"`
+}
+
+type TakenBackMsgOut struct {
+	Type    ClientEventType        `json:"type"`
+	Payload TakenBackPayloadMsgOut `json:"payload"`
+}
+
+// Plies is the number of plies taken back, either one or two
+type TakenBackPayloadMsgOut struct {
+	Plies int `json:"plies"`
+
+	// Legal moves of the side to move after the takeback
+	LegalMoves []chess.Move `json:"legalMoves"`
+
+	Clock *ClockMsg `json:"clock,omitempty"`
 }
@@ -1,8 +1,12 @@
 package types
 
 import (
+	"math"
+	"time"
+
 	"github.com/sina-am/chess/chess"
 	"github.com/sina-am/chess/services/auth"
+	"github.com/sina-am/chess/services/rating"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,16 +18,95 @@ const (
 	OtherGender  Gender = "other"
 )
 
+// A guest is recorded by their anonymous id, until they register and
+// claim the game
 type Player struct {
-	UserId primitive.ObjectID `json:"user_id" bson:"user_id"`
-	Name   string             `json:"name"`
-	Color  chess.Color        `json:"color" bson:"color"`
+	UserId    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name      string             `json:"name" bson:"name"`
+	Color     chess.Color        `json:"color" bson:"color"`
+	Anonymous bool               `json:"anonymous" bson:"anonymous"`
+}
+
+// A ply of a game record. Clock is the time in milliseconds the player had
+// left after it.
+type GameMove struct {
+	UCI   string `json:"uci" bson:"uci"`
+	SAN   string `json:"san" bson:"san"`
+	Clock int64  `json:"clock" bson:"clock"`
 }
+
 type Game struct {
-	Id      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Players []Player           `json:"players" bson:"players"`
-	Winner  string             `json:"winner" bson:"winner"`
-	Reason  string             `json:"reason" bson:"reason"`
+	Id          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Players     []Player           `json:"players" bson:"players"`
+	Winner      string             `json:"winner" bson:"winner"`
+	Reason      string             `json:"reason" bson:"reason"`
+	InitialFEN  string             `json:"initialFen" bson:"initial_fen"`
+	TimeControl string             `json:"timeControl" bson:"time_control"`
+	Rated       bool               `json:"rated" bson:"rated"`
+	Moves       []GameMove         `json:"moves" bson:"moves"`
+	StartedAt   time.Time          `json:"startedAt" bson:"started_at"`
+	EndedAt     time.Time          `json:"endedAt" bson:"ended_at"`
+	Chat        []ChatMessage      `json:"chat,omitempty" bson:"chat"`
+}
+
+// Players and spectators of a game chat in separate rooms
+type ChatRoom string
+
+const (
+	PlayersRoom    ChatRoom = "players"
+	SpectatorsRoom ChatRoom = "spectators"
+)
+
+type ChatMessage struct {
+	UserId primitive.ObjectID `json:"userId" bson:"user_id"`
+	Name   string             `json:"name" bson:"name"`
+	Room   ChatRoom           `json:"room" bson:"room"`
+	Text   string             `json:"text" bson:"text"`
+	Time   time.Time          `json:"time" bson:"time"`
+}
+
+// A user reported for what they wrote in the chat of a game. Messages are
+// the ones the user sent in the game until the report.
+type ChatReport struct {
+	Id         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	GameId     primitive.ObjectID `json:"gameId" bson:"game_id"`
+	ReporterId primitive.ObjectID `json:"reporterId" bson:"reporter_id"`
+	UserId     primitive.ObjectID `json:"userId" bson:"user_id"`
+	Reason     string             `json:"reason" bson:"reason"`
+	Messages   []ChatMessage      `json:"messages" bson:"messages"`
+	Time       time.Time          `json:"time" bson:"time"`
+}
+
+type AnalysisStatus string
+
+const (
+	AnalysisPending AnalysisStatus = "pending"
+	AnalysisDone    AnalysisStatus = "done"
+	AnalysisFailed  AnalysisStatus = "failed"
+)
+
+// Engine report of a finished game. Analysis is set once Status is done
+// and Error once it's failed.
+type GameAnalysis struct {
+	GameId   primitive.ObjectID `json:"gameId" bson:"_id"`
+	Status   AnalysisStatus     `json:"status" bson:"status"`
+	Analysis *chess.Analysis    `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	Error    string             `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// A rated game changing a user's rating, kept for the rating history
+type RatingChange struct {
+	UserId   primitive.ObjectID `json:"userId" bson:"user_id"`
+	GameId   primitive.ObjectID `json:"gameId" bson:"game_id"`
+	Category rating.Category    `json:"category" bson:"category"`
+	Before   rating.Rating      `json:"before" bson:"before"`
+	After    rating.Rating      `json:"after" bson:"after"`
+	Time     time.Time          `json:"time" bson:"time"`
+}
+
+// Return the change of the rating rounded to a whole number, as shown to players
+func (c *RatingChange) Delta() int {
+	return int(math.Round(c.After.Rating)) - int(math.Round(c.Before.Rating))
 }
 
 func NewUserId() primitive.ObjectID {
@@ -38,7 +121,11 @@ type User struct {
 	Gender      Gender             `json:"gender" bson:"gender,omitempty"`
 	Name        string             `json:"name" bson:"name"`
 	Nationality string             `json:"nationality" bson:"nationality,omitempty"`
-	Games       []Game             `json:"games" bson:"games"`
+
+	Ratings map[rating.Category]rating.Rating `json:"ratings" bson:"ratings,omitempty"`
+
+	// Ids the user had as a guest, games of these guests are the user's
+	GuestIds []primitive.ObjectID `json:"-" bson:"guest_ids,omitempty"`
 }
 
 func NewUser(email, name, plainPassword string) *User {
@@ -46,10 +133,18 @@ func NewUser(email, name, plainPassword string) *User {
 		Email:    email,
 		Name:     name,
 		Password: auth.HashPassword(plainPassword),
-		Games:    make([]Game, 0),
 	}
 }
 
+// Return the user's rating in the category, the initial one if the user
+// hasn't played a rated game in it yet
+func (u *User) Rating(category rating.Category) rating.Rating {
+	if r, ok := u.Ratings[category]; ok {
+		return r
+	}
+	return rating.New()
+}
+
 func (u *User) IsAuthenticated() bool {
 	return true
 }